@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"strings"
@@ -10,7 +12,9 @@ import (
 
 	"github.com/hylandsoftware/spot/pkg/spot"
 	"github.com/hylandsoftware/spot/pkg/spot/bamboo"
+	"github.com/hylandsoftware/spot/pkg/spot/config"
 	"github.com/hylandsoftware/spot/pkg/spot/jenkins"
+	"github.com/hylandsoftware/spot/pkg/spot/redact"
 
 	arg "github.com/alexflint/go-arg"
 	colorable "github.com/mattn/go-colorable"
@@ -18,28 +22,37 @@ import (
 )
 
 type applicationArgs struct {
-	Bamboo    []string `arg:"-b,separate" help:"Bamboo Url & credentials in the form of https://bamboo/,username,password"`
-	Jenkins   []string `arg:"-j,separate" help:"Jenkins Url & credentials in the form of https://jenkins/,username,password"`
-	Slack     string   `arg:"-s" help:"Slack-Compatible Incoming Webhook URL"`
-	Template  string   `arg:"-t" help:"Path to template for notifications"`
-	Verbosity string   `arg:"-v" help:"Verbosity [panic, fatal, error, warn, info, debug]"`
-	Period    string   `arg:"-p" help:"How long to wait between checks"`
-	Once      bool     `arg:"-o" help:"Run checks once and exit"`
-	WarmUp    bool     `arg:"-w" help:"Run checks without notifications once before starting the watchdog"`
-
-	JenkinsClassWhitelist []string `arg:"-c,separate" help:"Only consider jenkins agents with the specified class(es)"`
+	Config       string   `arg:"-f" help:"Path to a YAML or TOML config file. Flags override or add to its settings"`
+	Bamboo       []string `arg:"-b,separate" help:"Bamboo Url & credentials in the form of https://bamboo/,username,password. See Credentials in the README for alternatives to plain text"`
+	Jenkins      []string `arg:"-j,separate" help:"Jenkins Url & credentials in the form of https://jenkins/,username,password. See Credentials in the README for alternatives to plain text"`
+	Slack        []string `arg:"-s,separate" help:"Slack-Compatible Incoming Webhook URL(s)"`
+	SlackToken   string   `help:"Slack bot token for posting with the Web API instead of a webhook"`
+	SlackChannel string   `help:"Slack channel to post to when using a bot token"`
+	Discord      []string `arg:"-d,separate" help:"Discord Webhook URL(s)"`
+	Alertmanager []string `arg:"-a,separate" help:"Prometheus Alertmanager URL(s). Use with --reminder to keep alerts firing"`
+	Reminder     string   `arg:"-r" help:"How long to wait before reminding about agents that are still offline"`
+	Retries      int      `help:"How many times to attempt failed notifications. Use 1 to disable retrying [default: 5]"`
+	RetryBackoff string   `help:"How long to wait before the first retry. Doubles after every attempt [default: 5s]"`
+	Route        []string `arg:"separate" help:"Send matching agents to specific notifiers, e.g. agent=^win-;label=docker;notify=slack-1;continue"`
+	DefaultRoute string   `help:"Comma separated notifiers for agents that match no route [default: all notifiers]"`
+	Silence      []string `arg:"separate" help:"Suppress notifications for matching agents, e.g. agent=win-*;cron=0 2 * * 2;duration=4h"`
+	Template     string   `arg:"-t" help:"Path to template for notifications"`
+	Verbosity    string   `arg:"-v" help:"Verbosity [panic, fatal, error, warn, info, debug] [default: info]"`
+	Period       string   `arg:"-p" help:"How long to wait between checks"`
+	Once         bool     `arg:"-o" help:"Run checks once and exit"`
+	WarmUp       bool     `arg:"-w" help:"Run checks without notifications once before starting the watchdog"`
+	Listen       string   `arg:"-l" help:"Address to serve the HTTP API on, e.g. :8080. Disabled when empty"`
+	APIToken     string   `help:"Bearer token required to acknowledge agents and manage silences through the HTTP API. Read-only when empty"`
+
+	JenkinsClassWhitelist []string `arg:"-c,separate" help:"Only consider jenkins agents with the specified class(es) unless a detector in the config file sets its own classWhitelist [default: hudson.slaves.SlaveComputer]"`
 }
 
 func (applicationArgs) Description() string {
 	return "alerts for disconnected build agents"
 }
 
-type dummyNotifier struct{}
-
-func (d *dummyNotifier) Notify(agents map[string][]string) error { return nil }
-
 func initLogrus(level string) {
-	log.SetFormatter(&log.TextFormatter{ForceColors: true})
+	log.SetFormatter(&redact.Formatter{Formatter: &log.TextFormatter{ForceColors: true}})
 	log.SetOutput(colorable.NewColorableStdout())
 
 	if level, err := log.ParseLevel(strings.ToLower(level)); err != nil {
@@ -97,92 +110,248 @@ func watchAllTheThings(warmUp bool, interval time.Duration, w *spot.Watchdog, sh
 	}
 }
 
-func (a *applicationArgs) populateBamboo(p *arg.Parser) []spot.OfflineAgentDetector {
-	result := []spot.OfflineAgentDetector{}
+// loadConfig loads the config file, if any, and applies the flags on top
+// of it. Scalar flags override the file while detectors, notifiers, routes
+// and silences are added to those in the file.
+func (a *applicationArgs) loadConfig() (*config.Config, error) {
+	result := &config.Config{}
+
+	if a.Config != "" {
+		loaded, err := config.Load(a.Config)
+		if err != nil {
+			return nil, err
+		}
+
+		result = loaded
+	}
 
 	for _, v := range a.Bamboo {
-		l := log.WithField("bamboo", v)
-		l.Debug("Trying to parse bamboo instance")
+		detector, err := bamboo.NewDetectorFromArg(v)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse bamboo configuration: %s", err.Error())
+		}
 
-		if detector, err := bamboo.NewDetectorFromArg(v); err != nil {
-			p.Fail(fmt.Sprintf("Failed to parse bamboo configuration: %s", err.Error()))
-		} else {
-			result = append(result, spot.OfflineAgentDetector(detector))
+		result.Detectors = append(result.Detectors, config.Detector{
+			Type:     config.DetectorBamboo,
+			URL:      detector.APIEndpoint,
+			Username: detector.Username,
+			Password: detector.Password,
+		})
+	}
+
+	for _, v := range a.Jenkins {
+		detector, err := jenkins.NewDetectorFromArg(v)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse jenkins configuration: %s", err.Error())
 		}
+
+		result.Detectors = append(result.Detectors, config.Detector{
+			Type:     config.DetectorJenkins,
+			URL:      detector.APIEndpoint,
+			Username: detector.Username,
+			Password: detector.Password,
+		})
+	}
+
+	for _, v := range a.Slack {
+		result.Notifiers = append(result.Notifiers, config.Notifier{Type: config.NotifierSlack, URL: v})
+	}
+
+	if a.SlackToken != "" {
+		result.Notifiers = append(result.Notifiers, config.Notifier{
+			Type:    config.NotifierSlackBot,
+			Name:    config.NotifierSlackBot,
+			Token:   a.SlackToken,
+			Channel: a.SlackChannel,
+		})
+	}
+
+	for _, v := range a.Discord {
+		result.Notifiers = append(result.Notifiers, config.Notifier{Type: config.NotifierDiscord, URL: v})
+	}
+
+	for _, v := range a.Alertmanager {
+		result.Notifiers = append(result.Notifiers, config.Notifier{Type: config.NotifierAlertmanager, URL: v})
+	}
+
+	// The class whitelist flag applies to every jenkins detector that does
+	// not have its own
+	for i := range result.Detectors {
+		d := &result.Detectors[i]
+		if d.Type == config.DetectorJenkins && len(d.ClassWhitelist) == 0 {
+			d.ClassWhitelist = a.JenkinsClassWhitelist
+		}
+	}
+
+	result.Routes = append(result.Routes, a.Route...)
+	result.Silences = append(result.Silences, a.Silence...)
+
+	if a.DefaultRoute != "" {
+		result.DefaultRoute = []string{}
+		for _, name := range strings.Split(a.DefaultRoute, ",") {
+			result.DefaultRoute = append(result.DefaultRoute, strings.TrimSpace(name))
+		}
+	}
+
+	override := func(target *string, value string) {
+		if value != "" {
+			*target = value
+		}
+	}
+
+	override(&result.Period, a.Period)
+	override(&result.Reminder, a.Reminder)
+	override(&result.RetryBackoff, a.RetryBackoff)
+	override(&result.Verbosity, a.Verbosity)
+	override(&result.Listen, a.Listen)
+	override(&result.APIToken, a.APIToken)
+	override(&result.Template, a.Template)
+
+	if a.Retries > 0 {
+		result.Retries = a.Retries
+	}
+
+	if a.WarmUp {
+		result.WarmUp = true
 	}
 
-	return result
+	if result.Verbosity == "" {
+		result.Verbosity = "info"
+	}
+
+	if err := result.Validate(!a.Once); err != nil {
+		return nil, err
+	}
+
+	return result, nil
 }
 
-func (a *applicationArgs) populateJenkins(p *arg.Parser) []spot.OfflineAgentDetector {
-	result := []spot.OfflineAgentDetector{}
+// configPollInterval is how often the config file is checked for changes
+const configPollInterval = 10 * time.Second
 
-	for _, v := range a.Jenkins {
-		l := log.WithField("jenkins", v)
-		l.Debug("Trying to parse jenkins instance")
+// reload applies a reloaded config to a running watchdog
+func reload(watchdog *spot.Watchdog, remediator *jenkins.Remediator, initial *config.Config) func(*config.Config) error {
+	return func(c *config.Config) error {
+		if err := c.Configure(watchdog, remediator); err != nil {
+			return err
+		}
+
+		if level, err := log.ParseLevel(strings.ToLower(c.Verbosity)); err == nil {
+			log.SetLevel(level)
+		}
 
-		if detector, err := jenkins.NewDetectorFromArg(v); err != nil {
-			p.Fail(fmt.Sprintf("Failed to parse jenkins configuration: %s", err.Error()))
-		} else {
-			result = append(result, spot.OfflineAgentDetector(detector))
+		if changed := c.RequiresRestart(initial); len(changed) > 0 {
+			log.WithField("settings", changed).Warn("Some settings only take effect after a restart")
 		}
+
+		return nil
 	}
+}
 
-	return result
+// staleCycles is how many periods the watchdog may go without completing a
+// cycle before it is reported as unhealthy
+const staleCycles = 3
+
+func serve(address, token string, watchdog *spot.Watchdog, period time.Duration) *http.Server {
+	handler := spot.NewServer(watchdog)
+	handler.StaleAfter = staleCycles * period
+	handler.Token = token
+
+	server := &http.Server{
+		Addr:    address,
+		Handler: handler,
+	}
+
+	go func() {
+		log.WithField("address", address).Info("Serving HTTP API")
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.WithError(err).Fatal("HTTP server failed")
+		}
+	}()
+
+	return server
 }
 
 func main() {
 	args := &applicationArgs{}
-	args.Verbosity = "info"
-
 	p := arg.MustParse(args)
 
-	initLogrus(args.Verbosity)
+	cfg, err := args.loadConfig()
+	if err != nil {
+		p.Fail(redact.String(err.Error()))
+	}
+
+	initLogrus(cfg.Verbosity)
 	log.Info("Hello, World!")
 
-	if len(args.JenkinsClassWhitelist) > 0 {
-		jenkins.UseClassWhitelist(args.JenkinsClassWhitelist)
+	// The remediator outlives reloads so that they do not reset reconnect
+	// attempts
+	watchdog := spot.NewWatchdog(nil, nil)
+	remediator := jenkins.NewRemediator()
+	if err := cfg.Configure(watchdog, remediator); err != nil {
+		p.Fail(redact.String(err.Error()))
 	}
 
-	detectors := []spot.OfflineAgentDetector{}
-	var handler spot.Notifier = &dummyNotifier{}
-
-	if args.Slack != "" {
-		var err error
-		if handler, err = spot.NewSlackNotifier(args.Slack, args.Template); err != nil {
-			p.Fail(fmt.Sprintf("Invalid slack URL: %s", err.Error()))
-		}
+	if policy := cfg.RetryPolicy(); policy != nil {
+		watchdog.Retries = spot.NewRetryQueue(*policy)
+		defer watchdog.Retries.Stop()
 	}
 
-	bambooDetectors := args.populateBamboo(p)
-	detectors = append(detectors, bambooDetectors...)
+	var period time.Duration
+	if !args.Once {
+		period, _ = time.ParseDuration(cfg.Period)
+	}
 
-	jenkinsDetectors := args.populateJenkins(p)
-	detectors = append(detectors, jenkinsDetectors...)
+	if cfg.Listen != "" {
+		token, err := cfg.ResolveAPIToken()
+		if err != nil {
+			p.Fail(redact.String(err.Error()))
+		}
 
-	if len(detectors) == 0 {
-		p.Fail("Provide at least one watchdog configuration")
+		server := serve(cfg.Listen, token, watchdog, period)
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			server.Shutdown(ctx)
+		}()
 	}
 
-	watchdog := spot.NewWatchdog(detectors, handler)
-
 	if args.Once {
 		if err := watchdog.RunChecksAndNotify(); err != nil {
 			panic(err)
 		}
+
+		if watchdog.Retries != nil {
+			watchdog.Retries.Wait()
+		}
 	} else {
-		period, err := time.ParseDuration(args.Period)
-		if err != nil {
-			p.Fail(fmt.Sprintf("Failed to parse period: %s", err.Error()))
+		shutdown := make(chan bool)
+		go watchAllTheThings(cfg.WarmUp, period, watchdog, shutdown)
+
+		var watcher *config.Watcher
+		if args.Config != "" {
+			watcher = config.NewWatcher(args.Config, cfg, args.loadConfig, reload(watchdog, remediator, cfg))
+
+			stopWatching := make(chan bool)
+			defer close(stopWatching)
+			go watcher.Run(configPollInterval, stopWatching)
 		}
 
-		shutdown := make(chan bool)
-		go watchAllTheThings(args.WarmUp, period, watchdog, shutdown)
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
 
-		c := make(chan os.Signal)
-		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+		for sig := range c {
+			if sig != syscall.SIGHUP {
+				break
+			}
+
+			if watcher == nil {
+				log.Warn("Received SIGHUP but there is no config file to reload")
+			} else {
+				watcher.Reload()
+			}
+		}
 
-		<-c
 		shutdown <- true
 	}
 
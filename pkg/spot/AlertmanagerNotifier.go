@@ -0,0 +1,200 @@
+package spot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	alertmanagerAlertsAPICall = "api/v2/alerts"
+
+	alertmanagerOfflineAlert  = "BuildAgentOffline"
+	alertmanagerDegradedAlert = "BuildAgentDegraded"
+	alertmanagerStuckAlert    = "BuildAgentStuck"
+	alertmanagerStarvedAlert  = "BuildQueueStarved"
+)
+
+type alertmanagerAlert struct {
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+	StartsAt     string            `json:"startsAt,omitempty"`
+	EndsAt       string            `json:"endsAt,omitempty"`
+	GeneratorURL string            `json:"generatorURL,omitempty"`
+}
+
+// AlertmanagerNotifier is a FollowUpNotifier that pushes an alert for each
+// offline agent to the Prometheus Alertmanager v2 API. Alerts are resolved
+// by setting endsAt once an agent recovers.
+//
+// Alertmanager resolves alerts that have not been updated within its
+// resolve_timeout, so the watchdog's reminder interval should be shorter
+// than that to keep alerts firing for agents that remain offline.
+type AlertmanagerNotifier struct {
+	Endpoint string
+
+	api *http.Client
+	log *logrus.Entry
+	now func() time.Time
+}
+
+// NewAlertmanagerNotifier creates an instance of spot.AlertmanagerNotifier
+// for the alertmanager at the given base URL
+func NewAlertmanagerNotifier(endpoint string) (*AlertmanagerNotifier, error) {
+	if endpoint == "" {
+		return nil, fmt.Errorf("Cannot create a notifier for an empty endpoint")
+	}
+
+	if strings.HasSuffix(endpoint, "/") {
+		endpoint = strings.TrimSuffix(endpoint, "/")
+	}
+
+	return &AlertmanagerNotifier{
+		Endpoint: endpoint,
+		api:      &http.Client{},
+		log:      logrus.WithFields(logrus.Fields{"type": "alertmanager", "endpoint": endpoint}),
+		now:      time.Now,
+	}, nil
+}
+
+// detectorSystem returns the type of build system from a detector name
+// formatted as '[system] {endpoint}', or the whole name if it does not
+// follow that convention
+func detectorSystem(detector string) string {
+	if strings.HasPrefix(detector, "[") {
+		if end := strings.Index(detector, "]"); end > 0 {
+			return detector[1:end]
+		}
+	}
+
+	return detector
+}
+
+// alertName returns the name of the alert for an agent. Agents that are
+// both degraded and stuck are reported as degraded.
+func alertName(agent Agent) string {
+	switch {
+	case agent.Starved:
+		return alertmanagerStarvedAlert
+	case agent.Degraded:
+		return alertmanagerDegradedAlert
+	case agent.Stuck:
+		return alertmanagerStuckAlert
+	default:
+		return alertmanagerOfflineAlert
+	}
+}
+
+// buildAlerts builds an alert for each agent. Labels identify an alert, so
+// only the alert name, system, agent and detector are labels. The reason,
+// severity and tags are annotations since they can change while the agent
+// stays offline, e.g. when the reason includes the free disk space, and an
+// alert resolved with different labels would not resolve the alert that
+// fired.
+func (a *AlertmanagerNotifier) buildAlerts(agents map[string][]Agent, resolved bool) []alertmanagerAlert {
+	now := a.now().UTC().Format(time.RFC3339)
+	alerts := []alertmanagerAlert{}
+
+	for _, detector := range sortedSystems(agents) {
+		for _, agent := range agents[detector] {
+			alert := alertmanagerAlert{
+				Labels: map[string]string{
+					"alertname": alertName(agent),
+					"system":    detectorSystem(detector),
+					"agent":     agent.Name,
+					"detector":  detector,
+				},
+				Annotations: map[string]string{
+					"summary": fmt.Sprintf("Build agent %s is offline", agent.Name),
+				},
+			}
+
+			if agent.Reason != "" {
+				alert.Annotations["reason"] = agent.Reason
+			}
+
+			if agent.Severity != "" {
+				alert.Annotations["severity"] = agent.Severity
+			}
+
+			if agent.Remediation != "" {
+				alert.Annotations["remediation"] = agent.Remediation
+			}
+
+			if tags := agent.Tags(); len(tags) > 0 {
+				alert.Annotations["tags"] = strings.Join(tags, ",")
+			}
+
+			if agent.Degraded {
+				alert.Annotations["summary"] = fmt.Sprintf("Build agent %s is degraded", agent.Name)
+			}
+
+			if agent.Stuck && !agent.Degraded {
+				alert.Annotations["summary"] = fmt.Sprintf("Build agent %s is stuck", agent.Name)
+			}
+
+			if agent.Starved {
+				alert.Annotations["summary"] = fmt.Sprintf("Builds are starved of executors (%s)", agent.Name)
+			}
+
+			if resolved {
+				alert.EndsAt = now
+			} else {
+				alert.StartsAt = now
+			}
+
+			alerts = append(alerts, alert)
+		}
+	}
+
+	return alerts
+}
+
+func (a *AlertmanagerNotifier) send(agents map[string][]Agent, resolved bool) error {
+	if a.api == nil {
+		return fmt.Errorf("Use spot.NewAlertmanagerNotifier(...) to construct an AlertmanagerNotifier")
+	}
+
+	if len(agents) == 0 {
+		a.log.Debug("No agents to report, not sending alerts")
+		return nil
+	}
+
+	alerts := a.buildAlerts(agents, resolved)
+	a.log.WithFields(logrus.Fields{"alertCount": len(alerts), "resolved": resolved}).Debug("Sending Alerts")
+
+	buff := &bytes.Buffer{}
+	if err := json.NewEncoder(buff).Encode(alerts); err != nil {
+		return err
+	}
+
+	resp, err := a.api.Post(fmt.Sprintf("%s/%s", a.Endpoint, alertmanagerAlertsAPICall), "application/json", buff)
+	if err != nil {
+		return &RetryableError{Err: err}
+	}
+	resp.Body.Close()
+
+	return checkResponse(resp)
+}
+
+// Notify implements spot.Notifier.Notify by firing an alert for each agent
+func (a *AlertmanagerNotifier) Notify(agents map[string][]Agent) error {
+	return a.send(agents, false)
+}
+
+// Remind implements spot.FollowUpNotifier.Remind by re-sending the alert
+// for each agent so that alertmanager does not resolve it
+func (a *AlertmanagerNotifier) Remind(agents map[string][]Agent) error {
+	return a.send(agents, false)
+}
+
+// Recover implements spot.FollowUpNotifier.Recover by resolving the alert
+// for each agent
+func (a *AlertmanagerNotifier) Recover(agents map[string][]Agent) error {
+	return a.send(agents, true)
+}
@@ -0,0 +1,195 @@
+package spot
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type mockAlertmanagerServer struct {
+	mux      *http.ServeMux
+	server   *httptest.Server
+	alerts   [][]alertmanagerAlert
+	teardown func()
+}
+
+func mockAlertmanager() (*mockAlertmanagerServer, *AlertmanagerNotifier) {
+	m := http.NewServeMux()
+	s := httptest.NewServer(m)
+	n, _ := NewAlertmanagerNotifier(s.URL)
+	n.now = func() time.Time { return time.Date(2018, 9, 1, 12, 0, 0, 0, time.UTC) }
+
+	result := &mockAlertmanagerServer{
+		mux:    m,
+		server: s,
+		teardown: func() {
+			s.Close()
+		},
+	}
+
+	m.HandleFunc("/api/v2/alerts", func(w http.ResponseWriter, r *http.Request) {
+		alerts := []alertmanagerAlert{}
+		if err := json.NewDecoder(r.Body).Decode(&alerts); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		result.alerts = append(result.alerts, alerts)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	return result, n
+}
+
+func TestNewAlertmanagerNotifier_ErrorForEmptyEndpoint(t *testing.T) {
+	sut, err := NewAlertmanagerNotifier("")
+
+	require.Nil(t, sut)
+	require.EqualError(t, err, "Cannot create a notifier for an empty endpoint")
+}
+
+func TestNewAlertmanagerNotifier_StripsTrailingSlash(t *testing.T) {
+	sut, err := NewAlertmanagerNotifier("http://foo/")
+
+	require.NoError(t, err)
+	require.Equal(t, "http://foo", sut.Endpoint)
+}
+
+func TestAlertmanagerNotifier_ErrorForNilClient(t *testing.T) {
+	sut := &AlertmanagerNotifier{}
+
+	err := sut.Notify(map[string][]Agent{"a": agents("b")})
+
+	require.EqualError(t, err, "Use spot.NewAlertmanagerNotifier(...) to construct an AlertmanagerNotifier")
+}
+
+func TestAlertmanagerNotifier_NonSuccessResponse(t *testing.T) {
+	am, sut := mockAlertmanager()
+	defer am.teardown()
+
+	sut.Endpoint = am.server.URL + "/missing"
+	err := sut.Notify(map[string][]Agent{"a": agents("b")})
+
+	require.EqualError(t, err, "Failed to notify: 404 Not Found")
+}
+
+func TestAlertmanagerNotifier_NoAgents(t *testing.T) {
+	am, sut := mockAlertmanager()
+	defer am.teardown()
+
+	require.NoError(t, sut.Notify(map[string][]Agent{}))
+	require.Empty(t, am.alerts)
+}
+
+func TestAlertmanagerNotifier_Notify(t *testing.T) {
+	am, sut := mockAlertmanager()
+	defer am.teardown()
+
+	err := sut.Notify(map[string][]Agent{"[jenkins] http://jenkins": {{Name: "b", Reason: "disconnected"}}})
+
+	require.NoError(t, err)
+	require.Equal(t, [][]alertmanagerAlert{{{
+		Labels: map[string]string{
+			"alertname": "BuildAgentOffline",
+			"system":    "jenkins",
+			"agent":     "b",
+			"detector":  "[jenkins] http://jenkins",
+		},
+		Annotations: map[string]string{"summary": "Build agent b is offline", "reason": "disconnected"},
+		StartsAt:    "2018-09-01T12:00:00Z",
+	}}}, am.alerts)
+}
+
+func TestAlertmanagerNotifier_AnnotatesDowngradedManualAgents(t *testing.T) {
+	am, sut := mockAlertmanager()
+	defer am.teardown()
+
+	err := sut.Notify(map[string][]Agent{"[jenkins] http://jenkins": {{Name: "b", Manual: true, Severity: SeverityWarning}}})
+
+	require.NoError(t, err)
+	require.Equal(t, "warning", am.alerts[0][0].Annotations["severity"])
+	require.Equal(t, "manual,warning", am.alerts[0][0].Annotations["tags"])
+	require.Len(t, am.alerts[0][0].Labels, 4)
+}
+
+func TestAlertmanagerNotifier_NamesDegradedAgents(t *testing.T) {
+	am, sut := mockAlertmanager()
+	defer am.teardown()
+
+	err := sut.Notify(map[string][]Agent{"[jenkins] http://jenkins": {{Name: "b", Reason: "Low disk space", Degraded: true}}})
+
+	require.NoError(t, err)
+	require.Equal(t, "BuildAgentDegraded", am.alerts[0][0].Labels["alertname"])
+	require.Equal(t, "degraded", am.alerts[0][0].Annotations["tags"])
+	require.Equal(t, "Low disk space", am.alerts[0][0].Annotations["reason"])
+	require.Equal(t, "Build agent b is degraded", am.alerts[0][0].Annotations["summary"])
+}
+
+func TestAlertmanagerNotifier_NamesStuckAgents(t *testing.T) {
+	am, sut := mockAlertmanager()
+	defer am.teardown()
+
+	err := sut.Notify(map[string][]Agent{"[jenkins] http://jenkins": {{Name: "b", Reason: "Build has been running for 20h", Stuck: true}}})
+
+	require.NoError(t, err)
+	require.Equal(t, "BuildAgentStuck", am.alerts[0][0].Labels["alertname"])
+	require.Equal(t, "stuck", am.alerts[0][0].Annotations["tags"])
+	require.Equal(t, "Build agent b is stuck", am.alerts[0][0].Annotations["summary"])
+}
+
+func TestAlertmanagerNotifier_NamesStarvedQueues(t *testing.T) {
+	am, sut := mockAlertmanager()
+	defer am.teardown()
+
+	err := sut.Notify(map[string][]Agent{"[jenkins] http://jenkins": {{Name: "queue: windows", Starved: true}}})
+
+	require.NoError(t, err)
+	require.Equal(t, "BuildQueueStarved", am.alerts[0][0].Labels["alertname"])
+	require.Equal(t, "starved", am.alerts[0][0].Annotations["tags"])
+	require.Equal(t, "Builds are starved of executors (queue: windows)", am.alerts[0][0].Annotations["summary"])
+}
+
+func TestAlertmanagerNotifier_ChangingReasonKeepsLabels(t *testing.T) {
+	am, sut := mockAlertmanager()
+	defer am.teardown()
+
+	require.NoError(t, sut.Notify(map[string][]Agent{"a": {{Name: "b", Reason: "Clock is off by 2.1s", Degraded: true}}}))
+	require.NoError(t, sut.Recover(map[string][]Agent{"a": {{Name: "b", Reason: "Clock is off by 3.4s", Degraded: true, Manual: true, Severity: SeverityWarning}}}))
+
+	require.Equal(t, am.alerts[0][0].Labels, am.alerts[1][0].Labels)
+}
+
+func TestAlertmanagerNotifier_RemindKeepsAlertsFiring(t *testing.T) {
+	am, sut := mockAlertmanager()
+	defer am.teardown()
+
+	require.NoError(t, sut.Remind(map[string][]Agent{"a": agents("b", "c")}))
+
+	require.Len(t, am.alerts, 1)
+	require.Len(t, am.alerts[0], 2)
+	for _, alert := range am.alerts[0] {
+		require.Empty(t, alert.EndsAt)
+	}
+}
+
+func TestAlertmanagerNotifier_RecoverSetsEndsAt(t *testing.T) {
+	am, sut := mockAlertmanager()
+	defer am.teardown()
+
+	require.NoError(t, sut.Recover(map[string][]Agent{"[bamboo] http://bamboo": agents("b")}))
+
+	require.Len(t, am.alerts, 1)
+	require.Equal(t, "2018-09-01T12:00:00Z", am.alerts[0][0].EndsAt)
+	require.Empty(t, am.alerts[0][0].StartsAt)
+	require.Equal(t, "bamboo", am.alerts[0][0].Labels["system"])
+}
+
+func TestDetectorSystem(t *testing.T) {
+	require.Equal(t, "jenkins", detectorSystem("[jenkins] http://foo"))
+	require.Equal(t, "custom", detectorSystem("custom"))
+	require.Equal(t, "[broken", detectorSystem("[broken"))
+}
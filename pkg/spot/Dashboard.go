@@ -0,0 +1,130 @@
+package spot
+
+import (
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const dashboardTemplate = `<!DOCTYPE html>
+<html>
+<head>
+	<meta charset="utf-8">
+	<meta http-equiv="refresh" content="60">
+	<title>spot</title>
+	<style>
+		body { font-family: sans-serif; margin: 2em; color: #222; }
+		table { border-collapse: collapse; margin-bottom: 2em; width: 100%; }
+		th, td { border-bottom: 1px solid #ddd; padding: 0.4em 0.8em; text-align: left; }
+		th { background: #f4f4f4; }
+		.ok { color: #2EB886; }
+		.error, .offline { color: #D50200; }
+		.recovered { color: #2EB886; }
+		.muted { color: #888; }
+	</style>
+</head>
+<body>
+	<h1>spot</h1>
+	<p class="muted">Generated {{ .Now.Format "2006-01-02 15:04:05 MST" }}</p>
+
+	<h2>Detectors</h2>
+	<table>
+		<tr><th>Detector</th><th>Last Check</th><th>Duration</th><th>Result</th></tr>
+		{{- range .Detectors }}
+		<tr>
+			<td>{{ .Name }}</td>
+			{{- if .LastCheck.IsZero }}
+			<td class="muted">Never</td><td></td><td class="muted">Pending</td>
+			{{- else }}
+			<td>{{ ago .LastCheck }} ago</td>
+			<td>{{ round .Duration }}</td>
+			{{- if .Error }}
+			<td class="error">{{ .Error }}</td>
+			{{- else }}
+			<td class="ok">{{ .Offline }} offline</td>
+			{{- end }}
+			{{- end }}
+		</tr>
+		{{- end }}
+	</table>
+
+	<h2>Offline Agents</h2>
+	{{- if .Agents }}
+	<table>
+		<tr><th>Detector</th><th>Agent</th><th>Reason</th><th>Offline For</th><th>Status</th></tr>
+		{{- range .Agents }}
+		<tr>
+			<td>{{ .Detector }}</td>
+			<td>{{ .Name }}{{ range .Tags }} ({{ . }}){{ end }}</td>
+			<td>{{ .Details }}</td>
+			<td>{{ ago .Since }}</td>
+			<td>
+				{{- if .SilencedBy }}Silenced ({{ .SilencedBy }}){{ else if .Acknowledged }}Acknowledged{{ else if .Notified }}Notified{{ else }}Pending{{ end -}}
+			</td>
+		</tr>
+		{{- end }}
+	</table>
+	{{- else }}
+	<p class="ok">All agents are online</p>
+	{{- end }}
+
+	<h2>Recent Transitions</h2>
+	{{- if .Transitions }}
+	<table>
+		<tr><th>Time</th><th>Detector</th><th>Agent</th><th>Transition</th></tr>
+		{{- range .Transitions }}
+		<tr>
+			<td>{{ .Time.Format "2006-01-02 15:04:05" }}</td>
+			<td>{{ .Detector }}</td>
+			<td>{{ .Agent.Name }}</td>
+			<td class="{{ .Kind }}">{{ .Kind }}</td>
+		</tr>
+		{{- end }}
+	</table>
+	{{- else }}
+	<p class="muted">Nothing has changed yet</p>
+	{{- end }}
+</body>
+</html>
+`
+
+type dashboardData struct {
+	Now         time.Time
+	Detectors   []DetectorStatus
+	Agents      []agentView
+	Transitions []Transition
+}
+
+var dashboard = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"ago": func(t time.Time) string {
+		return time.Since(t).Round(time.Second).String()
+	},
+	"round": func(d time.Duration) string {
+		return d.Round(time.Millisecond).String()
+	},
+}).Parse(dashboardTemplate))
+
+func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if !allowMethods(w, r, "GET") {
+		return
+	}
+
+	data := dashboardData{
+		Now:         time.Now(),
+		Detectors:   s.watchdog.Status(),
+		Agents:      s.agents(),
+		Transitions: s.watchdog.Transitions(),
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboard.Execute(w, data); err != nil {
+		logrus.WithError(err).Warn("Failed to render dashboard")
+	}
+}
@@ -0,0 +1,47 @@
+package spot
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDashboard_ShowsWatchdogState(t *testing.T) {
+	d := &mockDetector{}
+	d.On("Name").Return("a")
+	d.On("FindOfflineAgents").Return([]Agent{{Name: "b", Reason: "<disconnected>"}}, nil).Once()
+	d.On("FindOfflineAgents").Return([]Agent{}, nil).Once()
+
+	d2 := &mockDetector{}
+	d2.On("Name").Return("c")
+	d2.On("FindOfflineAgents").Return([]Agent(nil), fmt.Errorf("Mock Error"))
+
+	watchdog := NewWatchdog([]OfflineAgentDetector{d, d2}, nil)
+	sut := NewServer(watchdog)
+
+	watchdog.RunChecks()
+
+	resp := request(sut, "GET", "/", "")
+	require.Equal(t, 200, resp.Code)
+	require.Equal(t, "text/html; charset=utf-8", resp.Header().Get("Content-Type"))
+
+	body := resp.Body.String()
+	require.Contains(t, body, "[MockDetector] a")
+	require.Contains(t, body, "1 offline")
+	require.Contains(t, body, "Mock Error")
+	require.Contains(t, body, "&lt;disconnected&gt;")
+	require.Contains(t, body, `<td class="offline">offline</td>`)
+
+	watchdog.RunChecks()
+
+	body = request(sut, "GET", "/", "").Body.String()
+	require.Contains(t, body, "All agents are online")
+	require.Contains(t, body, `<td class="recovered">recovered</td>`)
+}
+
+func TestDashboard_NotFoundForUnknownPaths(t *testing.T) {
+	_, sut := mockServer(agents())
+
+	require.Equal(t, 404, request(sut, "GET", "/foo", "").Code)
+}
@@ -0,0 +1,79 @@
+package spot
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DetectorOptions customizes how a Watchdog treats a single detector
+type DetectorOptions struct {
+	// Interval is how often to check the detector. The detector is checked
+	// on every cycle if it is zero.
+	Interval time.Duration
+	// GracePeriod is how long an agent must be offline before it is
+	// reported. Agents are reported as soon as they are found if it is zero.
+	GracePeriod time.Duration
+}
+
+// due returns true if the named detector should be checked this cycle
+func (w *Watchdog) due(name string, now time.Time) bool {
+	options, ok := w.Options[name]
+	if !ok || options.Interval <= 0 {
+		return true
+	}
+
+	w.stateLock.Lock()
+	defer w.stateLock.Unlock()
+
+	status, ok := w.status[name]
+	return !ok || status.LastCheck.IsZero() || now.Sub(status.LastCheck) >= options.Interval
+}
+
+// deferGracePeriod removes newly offline agents that have not been offline
+// for their grace period, or the grace period of their detector, from a set
+// of changes and returns them
+func (w *Watchdog) deferGracePeriod(changes *Changes) *Changes {
+	deferred := &Changes{
+		Offline:   map[string][]Agent{},
+		Reminders: map[string][]Agent{},
+		Recovered: map[string][]Agent{},
+	}
+
+	now := time.Now()
+	offline := w.cache.List()
+
+	for detector, agents := range changes.Offline {
+		since := map[string]time.Time{}
+		for _, agent := range offline[detector] {
+			since[agent.Name] = agent.Since
+		}
+
+		kept := []Agent{}
+		for _, agent := range agents {
+			grace := w.Options[detector].GracePeriod
+			if agent.GracePeriod > 0 {
+				grace = agent.GracePeriod
+			}
+
+			if grace > 0 && now.Sub(since[agent.Name]) < grace {
+				logrus.WithFields(logrus.Fields{
+					"detector": detector,
+					"agent":    agent.Name,
+				}).Debug("Agent has not been offline for the grace period yet")
+
+				deferred.Offline[detector] = append(deferred.Offline[detector], agent)
+			} else {
+				kept = append(kept, agent)
+			}
+		}
+
+		if len(kept) > 0 {
+			changes.Offline[detector] = kept
+		} else {
+			delete(changes.Offline, detector)
+		}
+	}
+
+	return deferred
+}
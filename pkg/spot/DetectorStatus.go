@@ -0,0 +1,169 @@
+package spot
+
+import (
+	"time"
+)
+
+// maxTransitions is how many transitions a Watchdog remembers
+const maxTransitions = 100
+
+// PartialError is returned by detectors along with the agents they found
+// when part of a check failed, such as an additional query. The agents are
+// still reported while the status of the detector shows the error.
+type PartialError struct {
+	Err error
+}
+
+func (e *PartialError) Error() string {
+	return e.Err.Error()
+}
+
+// partial returns true if err is a PartialError
+func partial(err error) bool {
+	_, ok := err.(*PartialError)
+	return ok
+}
+
+// DetectorStatus describes the outcome of the most recent check of a detector
+type DetectorStatus struct {
+	Name string
+	// LastCheck is when the detector was last checked. It is zero if the
+	// detector has not been checked yet.
+	LastCheck time.Time
+	// Duration is how long the last check took
+	Duration time.Duration
+	// Offline is how many agents were offline as of the last check
+	Offline int
+	// Error is the error returned by the last check, if any
+	Error string
+}
+
+const (
+	// TransitionOffline is the kind of transition for an agent going offline
+	TransitionOffline = "offline"
+	// TransitionRecovered is the kind of transition for an agent coming back
+	TransitionRecovered = "recovered"
+)
+
+// Transition records an agent going offline or coming back online
+type Transition struct {
+	Time     time.Time
+	Detector string
+	Agent    Agent
+	// Kind is either TransitionOffline or TransitionRecovered
+	Kind string
+}
+
+// Status returns the status of every detector in the order they are
+// configured
+func (w *Watchdog) Status() []DetectorStatus {
+	w.stateLock.Lock()
+	defer w.stateLock.Unlock()
+
+	result := make([]DetectorStatus, 0, len(w.Detectors))
+	for _, d := range w.Detectors {
+		if status, ok := w.status[d.Name()]; ok {
+			result = append(result, *status)
+		} else {
+			result = append(result, DetectorStatus{Name: d.Name()})
+		}
+	}
+
+	return result
+}
+
+// LastCycle returns when the detectors were last checked. It is zero if
+// they have not been checked yet.
+func (w *Watchdog) LastCycle() time.Time {
+	w.stateLock.Lock()
+	defer w.stateLock.Unlock()
+
+	return w.lastCycle
+}
+
+// Transitions returns recent transitions, newest first
+func (w *Watchdog) Transitions() []Transition {
+	w.stateLock.Lock()
+	defer w.stateLock.Unlock()
+
+	result := make([]Transition, 0, len(w.transitions))
+	for i := len(w.transitions) - 1; i >= 0; i-- {
+		result = append(result, w.transitions[i])
+	}
+
+	return result
+}
+
+func (w *Watchdog) recordCheck(name string, start time.Time, offline []Agent, err error) {
+	w.stateLock.Lock()
+	defer w.stateLock.Unlock()
+
+	if w.status == nil {
+		w.status = map[string]*DetectorStatus{}
+	}
+
+	status := &DetectorStatus{
+		Name:      name,
+		LastCheck: start,
+		Duration:  time.Since(start),
+		Offline:   len(offline),
+	}
+
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	if err != nil && !partial(err) {
+		if previous, ok := w.status[name]; ok {
+			status.Offline = previous.Offline
+		}
+	}
+
+	w.status[name] = status
+	observeCheck(name, status.Duration, len(offline), err)
+}
+
+func agentsByName(agents []OfflineAgent) map[string]Agent {
+	result := map[string]Agent{}
+	for _, agent := range agents {
+		result[agent.Name] = agent.Agent
+	}
+
+	return result
+}
+
+// recordTransitions compares the offline agents of each checked detector
+// before and after a check and marks the end of a cycle
+func (w *Watchdog) recordTransitions(checked map[string][]Agent, before, after map[string][]OfflineAgent) {
+	w.stateLock.Lock()
+	defer w.stateLock.Unlock()
+
+	now := time.Now()
+	count := len(w.transitions)
+	w.lastCycle = now
+
+	for detector := range checked {
+		previous := agentsByName(before[detector])
+		current := agentsByName(after[detector])
+
+		for _, agent := range after[detector] {
+			if _, ok := previous[agent.Name]; !ok {
+				w.transitions = append(w.transitions, Transition{Time: now, Detector: detector, Agent: agent.Agent, Kind: TransitionOffline})
+			}
+		}
+
+		for _, agent := range before[detector] {
+			if _, ok := current[agent.Name]; !ok {
+				w.transitions = append(w.transitions, Transition{Time: now, Detector: detector, Agent: agent.Agent, Kind: TransitionRecovered})
+			}
+		}
+	}
+
+	for _, transition := range w.transitions[count:] {
+		observeTransition(transition)
+	}
+
+	if len(w.transitions) > maxTransitions {
+		w.transitions = append([]Transition{}, w.transitions[len(w.transitions)-maxTransitions:]...)
+	}
+}
@@ -0,0 +1,236 @@
+package spot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const defaultDiscordTemplate = `
+{{ len . }} build system(s) reported offline agents
+`
+
+const (
+	discordMaxTitle       = 256
+	discordMaxDescription = 4096
+	discordMaxFields      = 25
+	discordMaxFieldName   = 256
+	discordMaxFieldValue  = 1024
+
+	// Discord limits the combined length of all text in the embeds of a
+	// message to 6000 characters. Leave room for the page suffix on titles.
+	discordMaxEmbedSize = 6000 - 16
+
+	discordColorCritical  = 0xD50200
+	discordColorWarning   = 0xFFA500
+	discordColorRecovered = 0x2EB886
+
+	discordOfflineTitle   = "Build agents offline"
+	discordReminderTitle  = "Build agents still offline"
+	discordRecoveredTitle = "Build agents back online"
+)
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields,omitempty"`
+}
+
+type discordPayload struct {
+	Username string         `json:"username,omitempty"`
+	Embeds   []discordEmbed `json:"embeds"`
+}
+
+// DiscordNotifier is a FollowUpNotifier for posting embeds to discord
+// webhooks. Each detector is listed as a field in the embed, and the embed
+// is split across multiple messages if it would exceed discord's limits.
+type DiscordNotifier struct {
+	Endpoint string
+
+	api             *http.Client
+	log             *logrus.Entry
+	messageTemplate *template.Template
+}
+
+// NewDiscordNotifier creates an instance of spot.DiscordNotifier for a
+// given webhook endpoint. The message template is used to render the
+// description of new alerts.
+func NewDiscordNotifier(endpoint, templatePath string) (*DiscordNotifier, error) {
+	if endpoint == "" {
+		return nil, fmt.Errorf("Cannot create a notifier for an empty endpoint")
+	}
+
+	t, err := loadMessageTemplate(templatePath, defaultDiscordTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasSuffix(endpoint, "/") {
+		endpoint = strings.TrimSuffix(endpoint, "/")
+	}
+
+	return &DiscordNotifier{
+		Endpoint:        endpoint,
+		api:             &http.Client{},
+		log:             logrus.WithFields(logrus.Fields{"type": "discord", "endpoint": endpoint}),
+		messageTemplate: t,
+	}, nil
+}
+
+// buildDiscordFields creates a field for each detector listing its agents.
+// Detectors with too many agents to fit in a single field are continued in
+// additional fields.
+func buildDiscordFields(agents map[string][]Agent) []discordField {
+	fields := []discordField{}
+
+	for _, system := range sortedSystems(agents) {
+		name := truncate(system, discordMaxFieldName)
+		lines := []string{}
+		size := 0
+
+		for _, agent := range agents[system] {
+			line := fmt.Sprintf("• %s", tagged(agent))
+			if details := agent.Details(); details != "" {
+				line = fmt.Sprintf("%s (_%s_)", line, details)
+			}
+
+			line = truncate(line, discordMaxFieldValue)
+			if len(lines) > 0 && size+len(line)+1 > discordMaxFieldValue {
+				fields = append(fields, discordField{Name: name, Value: strings.Join(lines, "\n")})
+				name = truncate(fmt.Sprintf("%s (cont.)", system), discordMaxFieldName)
+				lines = []string{}
+				size = 0
+			}
+
+			lines = append(lines, line)
+			size += len(line) + 1
+		}
+
+		if len(lines) == 0 {
+			lines = append(lines, "-")
+		}
+
+		fields = append(fields, discordField{Name: name, Value: strings.Join(lines, "\n")})
+	}
+
+	return fields
+}
+
+// buildDiscordEmbeds packs fields into as many embeds as needed to stay
+// within discord's limits. Each embed is meant to be sent as its own message.
+func buildDiscordEmbeds(title, description string, color int, fields []discordField) []discordEmbed {
+	title = truncate(title, discordMaxTitle-16)
+	description = truncate(description, discordMaxDescription)
+
+	embeds := []discordEmbed{}
+	current := discordEmbed{Title: title, Description: description, Color: color}
+	size := len(title) + len(description)
+
+	for _, field := range fields {
+		fieldSize := len(field.Name) + len(field.Value)
+		if len(current.Fields) > 0 && (len(current.Fields) == discordMaxFields || size+fieldSize > discordMaxEmbedSize) {
+			embeds = append(embeds, current)
+			current = discordEmbed{Title: title, Color: color}
+			size = len(title)
+		}
+
+		current.Fields = append(current.Fields, field)
+		size += fieldSize
+	}
+
+	embeds = append(embeds, current)
+
+	if len(embeds) > 1 {
+		for i := range embeds {
+			embeds[i].Title = fmt.Sprintf("%s (%d/%d)", title, i+1, len(embeds))
+		}
+	}
+
+	return embeds
+}
+
+func (d *DiscordNotifier) send(title, description string, color int, agents map[string][]Agent) error {
+	if d.api == nil {
+		return fmt.Errorf("Use spot.NewDiscordNotifier(...) to construct a DiscordNotifier")
+	}
+
+	if len(agents) == 0 {
+		d.log.Debug("No agents to report, not sending a notification")
+		return nil
+	}
+
+	d.log.WithFields(logrus.Fields{"title": title, "systemCount": len(agents)}).Debug("Sending Notification")
+
+	for _, embed := range buildDiscordEmbeds(title, description, color, buildDiscordFields(agents)) {
+		payload := &discordPayload{
+			Username: "spot",
+			Embeds:   []discordEmbed{embed},
+		}
+
+		buff := &bytes.Buffer{}
+		if err := json.NewEncoder(buff).Encode(payload); err != nil {
+			return err
+		}
+
+		resp, err := d.api.Post(d.Endpoint, "application/json", buff)
+		if err != nil {
+			return &RetryableError{Err: err}
+		}
+		resp.Body.Close()
+
+		if err := checkResponse(resp); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// severityColor returns the color of the highest severity among the
+// agents. Agents that were not downgraded are critical.
+func severityColor(agents map[string][]Agent) int {
+	for _, offline := range agents {
+		for _, agent := range offline {
+			if agent.Severity != SeverityWarning {
+				return discordColorCritical
+			}
+		}
+	}
+
+	return discordColorWarning
+}
+
+// Notify implements spot.Notifier.Notify by posting an embed to a discord
+// webhook, colored by the highest severity among the agents
+func (d *DiscordNotifier) Notify(agents map[string][]Agent) error {
+	description := ""
+	if d.messageTemplate != nil {
+		description = buildMessage(d.messageTemplate, agents)
+	}
+
+	return d.send(discordOfflineTitle, description, severityColor(agents), agents)
+}
+
+// Remind implements spot.FollowUpNotifier.Remind by posting an embed to a
+// discord webhook, colored by the highest severity among the agents
+func (d *DiscordNotifier) Remind(agents map[string][]Agent) error {
+	return d.send(discordReminderTitle, "", severityColor(agents), agents)
+}
+
+// Recover implements spot.FollowUpNotifier.Recover by posting an embed to a
+// discord webhook
+func (d *DiscordNotifier) Recover(agents map[string][]Agent) error {
+	return d.send(discordRecoveredTitle, "", discordColorRecovered, agents)
+}
@@ -0,0 +1,183 @@
+package spot
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type mockDiscordServer struct {
+	mux      *http.ServeMux
+	server   *httptest.Server
+	payloads []*discordPayload
+	teardown func()
+}
+
+func mockDiscord() (*mockDiscordServer, *DiscordNotifier) {
+	m := http.NewServeMux()
+	s := httptest.NewServer(m)
+	n, _ := NewDiscordNotifier(s.URL, "")
+
+	result := &mockDiscordServer{
+		mux:    m,
+		server: s,
+		teardown: func() {
+			s.Close()
+		},
+	}
+
+	m.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		payload := &discordPayload{}
+		if err := json.NewDecoder(r.Body).Decode(payload); err != nil {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		result.payloads = append(result.payloads, payload)
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	return result, n
+}
+
+func TestNewDiscordNotifier_ErrorForEmptyEndpoint(t *testing.T) {
+	sut, err := NewDiscordNotifier("", "")
+
+	require.Nil(t, sut)
+	require.EqualError(t, err, "Cannot create a notifier for an empty endpoint")
+}
+
+func TestNewDiscordNotifier_StripsTrailingSlash(t *testing.T) {
+	sut, err := NewDiscordNotifier("http://foo/", "")
+
+	require.NoError(t, err)
+	require.Equal(t, "http://foo", sut.Endpoint)
+}
+
+func TestDiscordNotifier_ErrorForNilClient(t *testing.T) {
+	sut := &DiscordNotifier{}
+
+	err := sut.Notify(map[string][]Agent{"a": agents("b")})
+
+	require.EqualError(t, err, "Use spot.NewDiscordNotifier(...) to construct a DiscordNotifier")
+}
+
+func TestDiscordNotifier_NonSuccessResponse(t *testing.T) {
+	discord, sut := mockDiscord()
+	defer discord.teardown()
+
+	discord.mux.HandleFunc("/broken", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	})
+
+	sut.Endpoint = fmt.Sprintf("%s/broken", discord.server.URL)
+	err := sut.Notify(map[string][]Agent{"a": agents("b")})
+
+	require.EqualError(t, err, "Failed to notify: 400 Bad Request")
+}
+
+func TestDiscordNotifier_Notify(t *testing.T) {
+	discord, sut := mockDiscord()
+	defer discord.teardown()
+
+	err := sut.Notify(map[string][]Agent{
+		"d": agents("e"),
+		"a": {{Name: "b", Reason: "disconnected"}, {Name: "c"}},
+	})
+
+	require.NoError(t, err)
+	require.Len(t, discord.payloads, 1)
+	require.Equal(t, "spot", discord.payloads[0].Username)
+	require.Equal(t, []discordEmbed{{
+		Title:       discordOfflineTitle,
+		Description: "2 build system(s) reported offline agents",
+		Color:       discordColorCritical,
+		Fields: []discordField{
+			{Name: "a", Value: "• b (_disconnected_)\n• c"},
+			{Name: "d", Value: "• e"},
+		},
+	}}, discord.payloads[0].Embeds)
+}
+
+func TestDiscordNotifier_UsesHighestSeverityColor(t *testing.T) {
+	discord, sut := mockDiscord()
+	defer discord.teardown()
+
+	warning := Agent{Name: "b", Severity: SeverityWarning}
+	require.NoError(t, sut.Notify(map[string][]Agent{"a": {warning}}))
+	require.NoError(t, sut.Notify(map[string][]Agent{"a": {warning}, "d": agents("e")}))
+	require.NoError(t, sut.Remind(map[string][]Agent{"a": {warning, {Name: "c", Severity: SeverityCritical}}}))
+	require.NoError(t, sut.Remind(map[string][]Agent{"a": {warning}}))
+	require.NoError(t, sut.Recover(map[string][]Agent{"a": agents("c")}))
+
+	require.Len(t, discord.payloads, 5)
+	require.Equal(t, discordColorWarning, discord.payloads[0].Embeds[0].Color)
+	require.Equal(t, discordColorCritical, discord.payloads[1].Embeds[0].Color)
+	require.Equal(t, discordReminderTitle, discord.payloads[2].Embeds[0].Title)
+	require.Equal(t, discordColorCritical, discord.payloads[2].Embeds[0].Color)
+	require.Equal(t, discordColorWarning, discord.payloads[3].Embeds[0].Color)
+	require.Equal(t, discordRecoveredTitle, discord.payloads[4].Embeds[0].Title)
+	require.Equal(t, discordColorRecovered, discord.payloads[4].Embeds[0].Color)
+}
+
+func TestDiscordNotifier_SplitsLongFields(t *testing.T) {
+	offline := []Agent{}
+	for i := 0; i < 100; i++ {
+		offline = append(offline, Agent{Name: fmt.Sprintf("agent-%03d", i), Reason: strings.Repeat("x", 20)})
+	}
+
+	fields := buildDiscordFields(map[string][]Agent{"a": offline})
+
+	require.True(t, len(fields) > 1)
+	require.Equal(t, "a", fields[0].Name)
+	for _, field := range fields {
+		require.True(t, len(field.Value) <= discordMaxFieldValue)
+	}
+
+	require.Equal(t, "a (cont.)", fields[1].Name)
+	require.True(t, strings.HasPrefix(fields[len(fields)-1].Value, "• agent-"))
+	require.Contains(t, fields[len(fields)-1].Value, "agent-099")
+}
+
+func TestDiscordNotifier_SplitsIntoMultipleMessages(t *testing.T) {
+	discord, sut := mockDiscord()
+	defer discord.teardown()
+
+	offline := map[string][]Agent{}
+	for i := 0; i < 30; i++ {
+		offline[fmt.Sprintf("detector-%02d", i)] = agents("b")
+	}
+
+	require.NoError(t, sut.Notify(offline))
+
+	require.Len(t, discord.payloads, 2)
+	require.Len(t, discord.payloads[0].Embeds[0].Fields, discordMaxFields)
+	require.Len(t, discord.payloads[1].Embeds[0].Fields, 5)
+	require.Equal(t, "Build agents offline (1/2)", discord.payloads[0].Embeds[0].Title)
+	require.Equal(t, "Build agents offline (2/2)", discord.payloads[1].Embeds[0].Title)
+	require.Empty(t, discord.payloads[1].Embeds[0].Description)
+}
+
+func TestDiscordNotifier_RespectsTotalEmbedSize(t *testing.T) {
+	offline := map[string][]Agent{}
+	for i := 0; i < 10; i++ {
+		offline[fmt.Sprintf("detector-%02d", i)] = agents(strings.Repeat("x", 1000))
+	}
+
+	embeds := buildDiscordEmbeds(discordOfflineTitle, "", discordColorCritical, buildDiscordFields(offline))
+
+	require.Len(t, embeds, 2)
+	for _, embed := range embeds {
+		size := len(embed.Title) + len(embed.Description)
+		for _, field := range embed.Fields {
+			size += len(field.Name) + len(field.Value)
+		}
+
+		require.True(t, size <= 6000)
+	}
+}
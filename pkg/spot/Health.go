@@ -0,0 +1,72 @@
+package spot
+
+import (
+	"net/http"
+	"time"
+)
+
+type healthResponse struct {
+	Status    string            `json:"status"`
+	LastCycle *time.Time        `json:"lastCycle,omitempty"`
+	Errors    map[string]string `json:"errors,omitempty"`
+}
+
+// healthy returns true if the watchdog has completed a cycle recently. Before
+// the first cycle completes, the server's start time is used instead.
+func (s *Server) healthy(now time.Time) bool {
+	if s.StaleAfter <= 0 {
+		return true
+	}
+
+	last := s.watchdog.LastCycle()
+	if last.IsZero() {
+		last = s.started
+	}
+
+	return now.Sub(last) <= s.StaleAfter
+}
+
+func writeHealth(w http.ResponseWriter, ok bool, response healthResponse) {
+	status := http.StatusOK
+	response.Status = "ok"
+
+	if !ok {
+		status = http.StatusServiceUnavailable
+		response.Status = "unavailable"
+	}
+
+	writeJSON(w, status, response)
+}
+
+// handleHealthz reports whether the watchdog loop is still making progress
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, "GET", "HEAD") {
+		return
+	}
+
+	writeHealth(w, s.healthy(time.Now()), healthResponse{
+		LastCycle: optionalTime(s.watchdog.LastCycle()),
+	})
+}
+
+// handleReadyz reports whether the watchdog has completed a cycle in which
+// every detector could be reached
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, "GET", "HEAD") {
+		return
+	}
+
+	last := s.watchdog.LastCycle()
+	response := healthResponse{
+		LastCycle: optionalTime(last),
+		Errors:    map[string]string{},
+	}
+
+	for _, status := range s.watchdog.Status() {
+		if status.Error != "" {
+			response.Errors[status.Name] = status.Error
+		}
+	}
+
+	writeHealth(w, !last.IsZero() && len(response.Errors) == 0 && s.healthy(time.Now()), response)
+}
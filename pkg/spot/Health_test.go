@@ -0,0 +1,56 @@
+package spot
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthz_HealthyUntilStale(t *testing.T) {
+	_, _, watchdog := setup(agents(), nil)
+	sut := NewServer(watchdog)
+	sut.StaleAfter = time.Hour
+
+	require.Equal(t, 200, request(sut, "GET", "/healthz", "").Code)
+
+	sut.started = time.Now().Add(-2 * time.Hour)
+	require.Equal(t, 503, request(sut, "GET", "/healthz", "").Code)
+
+	watchdog.RunChecks()
+	resp := request(sut, "GET", "/healthz", "")
+	require.Equal(t, 200, resp.Code)
+	require.Contains(t, resp.Body.String(), `"status":"ok"`)
+	require.Contains(t, resp.Body.String(), `"lastCycle"`)
+}
+
+func TestHealthz_StalenessDisabled(t *testing.T) {
+	_, _, watchdog := setup(agents(), nil)
+	sut := NewServer(watchdog)
+	sut.started = time.Now().Add(-24 * time.Hour)
+
+	require.Equal(t, 200, request(sut, "GET", "/healthz", "").Code)
+}
+
+func TestReadyz_NotReadyBeforeFirstCycle(t *testing.T) {
+	_, _, watchdog := setup(agents(), nil)
+	sut := NewServer(watchdog)
+
+	require.Equal(t, 503, request(sut, "GET", "/readyz", "").Code)
+
+	watchdog.RunChecks()
+	require.Equal(t, 200, request(sut, "GET", "/readyz", "").Code)
+}
+
+func TestReadyz_NotReadyWhenDetectorsFail(t *testing.T) {
+	_, _, watchdog := setup(nil, fmt.Errorf("Mock Error"))
+	sut := NewServer(watchdog)
+
+	watchdog.RunChecks()
+	resp := request(sut, "GET", "/readyz", "")
+
+	require.Equal(t, 503, resp.Code)
+	require.Contains(t, resp.Body.String(), `"status":"unavailable"`)
+	require.Contains(t, resp.Body.String(), `"[MockDetector] a":"Mock Error"`)
+}
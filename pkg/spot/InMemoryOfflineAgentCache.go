@@ -1,53 +1,224 @@
 package spot
 
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// cacheKey identifies a cached agent. An agent that goes from being
+// degraded or stuck to being offline, or back, has a different problem that is
+// notified and recovered separately, so the kind of problem is part of the
+// key.
+type cacheKey struct {
+	name string
+	kind string
+}
+
+func keyOf(agent Agent) cacheKey {
+	return cacheKey{name: agent.Name, kind: problem(agent)}
+}
+
+// problem returns the kind of problem an agent has, with the same
+// precedence as the alert names of the AlertmanagerNotifier
+func problem(agent Agent) string {
+	switch {
+	case agent.Starved:
+		return "starved"
+	case agent.Degraded:
+		return "degraded"
+	case agent.Stuck:
+		return "stuck"
+	default:
+		return "offline"
+	}
+}
+
+type cachedAgent struct {
+	agent        Agent
+	since        time.Time
+	notified     bool
+	pending      bool
+	recovered    bool
+	acknowledged bool
+	lastNotified time.Time
+}
+
+// InMemoryOfflineAgentCache is an OfflineAgentCache that keeps track of
+// offline agents in memory. State is lost when the process exits.
 type InMemoryOfflineAgentCache struct {
-	backingCache map[string]map[string]bool
+	lock         sync.Mutex
+	backingCache map[string]map[cacheKey]*cachedAgent
+	now          func() time.Time
 }
 
+// NewInMemoryOfflineAgentCache constructs an empty InMemoryOfflineAgentCache
 func NewInMemoryOfflineAgentCache() *InMemoryOfflineAgentCache {
 	return &InMemoryOfflineAgentCache{
-		backingCache: map[string]map[string]bool{},
+		backingCache: map[string]map[cacheKey]*cachedAgent{},
+		now:          time.Now,
 	}
 }
 
-func (c InMemoryOfflineAgentCache) Update(offline map[string][]string) map[string][]string {
-	result := map[string][]string{}
+// Update implements spot.OfflineAgentCache.Update
+func (c *InMemoryOfflineAgentCache) Update(offline map[string][]Agent, reminderInterval time.Duration) *Changes {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	result := &Changes{
+		Offline:   map[string][]Agent{},
+		Reminders: map[string][]Agent{},
+		Recovered: map[string][]Agent{},
+	}
+
+	now := c.now()
 
 	for system, agents := range offline {
 		// 1. Make entries for new systems
 		if _, exists := c.backingCache[system]; !exists {
-			c.backingCache[system] = map[string]bool{}
+			c.backingCache[system] = map[cacheKey]*cachedAgent{}
 		}
 
-		// 2. Make entries for new agents
+		// 2. Make entries for new agents and remind about old ones
+		seen := map[cacheKey]bool{}
 		for _, agent := range agents {
-			if _, exists := c.backingCache[system][agent]; !exists {
-				c.backingCache[system][agent] = true
-				result[system] = append(result[system], agent)
+			key := keyOf(agent)
+			seen[key] = true
+
+			cached, exists := c.backingCache[system][key]
+			if !exists {
+				cached = &cachedAgent{since: now}
+				c.backingCache[system][key] = cached
 			}
+
+			cached.agent = agent
+			cached.recovered = false
+			if cached.pending {
+				continue
+			}
+
+			if !cached.notified {
+				cached.pending = true
+				result.Offline[system] = append(result.Offline[system], agent)
+			} else if reminderInterval > 0 && !cached.acknowledged && now.Sub(cached.lastNotified) >= reminderInterval {
+				cached.pending = true
+				result.Reminders[system] = append(result.Reminders[system], agent)
+			}
+		}
+
+		// 3. Remove agents not in the offline list. Agents with a
+		// notification in flight are kept until it is committed or
+		// released, so that a notification delivered late is still
+		// followed by a recovery.
+		for key, cached := range c.backingCache[system] {
+			if seen[key] {
+				continue
+			}
+
+			if cached.pending {
+				cached.recovered = true
+				continue
+			}
+
+			delete(c.backingCache[system], key)
+			if cached.notified {
+				result.Recovered[system] = append(result.Recovered[system], cached.agent)
+			}
+		}
+
+		// 4. Remove systems with no agents
+		if len(c.backingCache[system]) == 0 {
+			delete(c.backingCache, system)
 		}
+	}
+
+	return result
+}
+
+// Commit implements spot.OfflineAgentCache.Commit
+func (c *InMemoryOfflineAgentCache) Commit(delivered *Changes) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := c.now()
 
-		// 3. Remove agents not in the offline list
-		for agent := range c.backingCache[system] {
-			found := false
-			for _, a := range offline[system] {
-				if agent == a {
-					found = true
+	for _, agents := range []map[string][]Agent{delivered.Offline, delivered.Reminders} {
+		for system, offline := range agents {
+			for _, agent := range offline {
+				if cached, exists := c.backingCache[system][keyOf(agent)]; exists {
+					cached.notified = true
+					cached.pending = false
+					cached.lastNotified = now
 				}
 			}
+		}
+	}
+}
+
+// Release implements spot.OfflineAgentCache.Release
+func (c *InMemoryOfflineAgentCache) Release(undelivered *Changes) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
 
-			if !found {
-				delete(c.backingCache[system], agent)
+	for _, agents := range []map[string][]Agent{undelivered.Offline, undelivered.Reminders} {
+		for system, offline := range agents {
+			for _, agent := range offline {
+				if cached, exists := c.backingCache[system][keyOf(agent)]; exists {
+					cached.pending = false
+				}
 			}
 		}
 	}
+}
 
-	// 4. Remove systems with no agents
-	for system := range c.backingCache {
-		if _, exists := offline[system]; !exists || len(c.backingCache[system]) == 0 {
-			delete(c.backingCache, system)
+// Acknowledge implements spot.OfflineAgentCache.Acknowledge
+func (c *InMemoryOfflineAgentCache) Acknowledge(system, agent string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for key, cached := range c.backingCache[system] {
+		if key.name == agent && !cached.recovered {
+			cached.acknowledged = true
+			return true
 		}
 	}
 
+	return false
+}
+
+// Forget implements spot.OfflineAgentCache.Forget
+func (c *InMemoryOfflineAgentCache) Forget(system string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.backingCache, system)
+}
+
+// List implements spot.OfflineAgentCache.List
+func (c *InMemoryOfflineAgentCache) List() map[string][]OfflineAgent {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	result := map[string][]OfflineAgent{}
+	for system, agents := range c.backingCache {
+		for _, cached := range agents {
+			if cached.recovered {
+				continue
+			}
+
+			result[system] = append(result[system], OfflineAgent{
+				Agent:        cached.agent,
+				Since:        cached.since,
+				Notified:     cached.notified,
+				LastNotified: cached.lastNotified,
+				Acknowledged: cached.acknowledged,
+			})
+		}
+
+		sort.Slice(result[system], func(i, j int) bool {
+			return result[system][i].Name < result[system][j].Name
+		})
+	}
+
 	return result
 }
@@ -2,73 +2,339 @@ package spot
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
 
+func agents(names ...string) []Agent {
+	result := []Agent{}
+	for _, name := range names {
+		result = append(result, Agent{Name: name})
+	}
+
+	return result
+}
+
 func TestUpdate_NoSystems(t *testing.T) {
 	sut := NewInMemoryOfflineAgentCache()
 
-	result := sut.Update(map[string][]string{})
+	result := sut.Update(map[string][]Agent{}, 0)
 
-	require.Empty(t, result)
+	require.True(t, result.Empty())
 }
 
 func TestUpdate_MarksNewSystems(t *testing.T) {
 	sut := NewInMemoryOfflineAgentCache()
 
-	result := sut.Update(map[string][]string{
-		"a": {"b", "c"},
-		"d": {"e", "f"},
-	})
+	result := sut.Update(map[string][]Agent{
+		"a": agents("b", "c"),
+		"d": agents("e", "f"),
+	}, 0)
 
-	require.Contains(t, result, "a")
-	require.Contains(t, result["a"], "b")
-	require.Contains(t, result["a"], "c")
+	require.Contains(t, result.Offline, "a")
+	require.Contains(t, result.Offline["a"], Agent{Name: "b"})
+	require.Contains(t, result.Offline["a"], Agent{Name: "c"})
 
-	require.Contains(t, result, "d")
-	require.Contains(t, result["d"], "e")
-	require.Contains(t, result["d"], "f")
+	require.Contains(t, result.Offline, "d")
+	require.Contains(t, result.Offline["d"], Agent{Name: "e"})
+	require.Contains(t, result.Offline["d"], Agent{Name: "f"})
 }
 
 func TestUpdate_SilentForDuplicate(t *testing.T) {
 	sut := NewInMemoryOfflineAgentCache()
 
-	sut.Update(map[string][]string{"a": {"b"}})
-	result := sut.Update(map[string][]string{"a": {"b"}})
+	sut.Update(map[string][]Agent{"a": agents("b")}, 0)
+	result := sut.Update(map[string][]Agent{"a": agents("b")}, 0)
 
-	require.Empty(t, result)
+	require.True(t, result.Empty())
 }
 
 func TestUpdate_AddsToExistingSystem(t *testing.T) {
 	sut := NewInMemoryOfflineAgentCache()
 
-	sut.Update(map[string][]string{"a": {"b", "c"}})
-	result := sut.Update(map[string][]string{"a": {"b", "c", "d"}})
+	sut.Update(map[string][]Agent{"a": agents("b", "c")}, 0)
+	result := sut.Update(map[string][]Agent{"a": agents("b", "c", "d")}, 0)
 
-	require.Contains(t, result, "a")
-	require.Contains(t, result["a"], "d")
+	require.Contains(t, result.Offline, "a")
+	require.Equal(t, agents("d"), result.Offline["a"])
 }
 
 func TestUpdate_RemovesNoLongerOfflineAgents(t *testing.T) {
 	sut := NewInMemoryOfflineAgentCache()
 
-	sut.Update(map[string][]string{"a": {"b", "c"}})
-	result := sut.Update(map[string][]string{"a": {"c", "d"}})
+	sut.Commit(sut.Update(map[string][]Agent{"a": agents("b", "c")}, 0))
+	result := sut.Update(map[string][]Agent{"a": agents("c", "d")}, 0)
 
-	require.Contains(t, result, "a")
-	require.NotContains(t, result["a"], "b")
-	require.Contains(t, result["a"], "d")
+	require.Contains(t, result.Offline, "a")
+	require.NotContains(t, result.Offline["a"], Agent{Name: "b"})
+	require.Contains(t, result.Offline["a"], Agent{Name: "d"})
+	require.Equal(t, agents("b"), result.Recovered["a"])
 }
 
 func TestUpdate_RemovesNoLongerOfflineSystems(t *testing.T) {
 	sut := NewInMemoryOfflineAgentCache()
 
-	sut.Update(map[string][]string{"a": {"b", "c"}, "e": {"f"}})
-	result := sut.Update(map[string][]string{"a": {"c", "d"}})
+	sut.Commit(sut.Update(map[string][]Agent{"a": agents("b", "c"), "e": agents("f")}, 0))
+	result := sut.Update(map[string][]Agent{"a": agents("c", "d"), "e": {}}, 0)
+
+	require.NotContains(t, result.Offline, "e")
+	require.Equal(t, agents("f"), result.Recovered["e"])
+	require.Contains(t, result.Offline, "a")
+	require.NotContains(t, result.Offline["a"], Agent{Name: "b"})
+	require.Contains(t, result.Offline["a"], Agent{Name: "d"})
+	require.NotContains(t, sut.backingCache, "e")
+}
+
+func TestUpdate_KeepsSystemsThatWereNotChecked(t *testing.T) {
+	sut := NewInMemoryOfflineAgentCache()
+
+	sut.Update(map[string][]Agent{"a": agents("b"), "e": agents("f")}, 0)
+	result := sut.Update(map[string][]Agent{"a": agents("b")}, 0)
+
+	require.True(t, result.Empty())
+	require.Contains(t, sut.backingCache, "e")
+}
+
+func TestUpdate_RemindsAfterInterval(t *testing.T) {
+	now := time.Now()
+	sut := NewInMemoryOfflineAgentCache()
+	sut.now = func() time.Time { return now }
+
+	sut.Commit(sut.Update(map[string][]Agent{"a": agents("b")}, time.Hour))
+
+	now = now.Add(30 * time.Minute)
+	result := sut.Update(map[string][]Agent{"a": agents("b")}, time.Hour)
+	require.True(t, result.Empty())
+
+	now = now.Add(30 * time.Minute)
+	result = sut.Update(map[string][]Agent{"a": {{Name: "b", Reason: "still broken"}}}, time.Hour)
+	require.Empty(t, result.Offline)
+	require.Equal(t, []Agent{{Name: "b", Reason: "still broken"}}, result.Reminders["a"])
+	sut.Commit(result)
+
+	now = now.Add(30 * time.Minute)
+	result = sut.Update(map[string][]Agent{"a": agents("b")}, time.Hour)
+	require.True(t, result.Empty())
+}
+
+func TestUpdate_NoRemindersWhenDisabled(t *testing.T) {
+	now := time.Now()
+	sut := NewInMemoryOfflineAgentCache()
+	sut.now = func() time.Time { return now }
+
+	sut.Update(map[string][]Agent{"a": agents("b")}, 0)
+
+	now = now.Add(24 * time.Hour)
+	result := sut.Update(map[string][]Agent{"a": agents("b")}, 0)
+
+	require.True(t, result.Empty())
+}
+
+func TestUpdate_RecoveredAgentsIncludeLastKnownReason(t *testing.T) {
+	sut := NewInMemoryOfflineAgentCache()
+
+	sut.Commit(sut.Update(map[string][]Agent{"a": {{Name: "b", Reason: "disconnected"}}}, 0))
+	result := sut.Update(map[string][]Agent{"a": {}}, 0)
+
+	require.Equal(t, []Agent{{Name: "b", Reason: "disconnected"}}, result.Recovered["a"])
+}
+
+func TestUpdate_PendingAgentsAreNotReturnedAgain(t *testing.T) {
+	now := time.Now()
+	sut := NewInMemoryOfflineAgentCache()
+	sut.now = func() time.Time { return now }
+
+	first := sut.Update(map[string][]Agent{"a": agents("b")}, time.Hour)
+	require.Equal(t, agents("b"), first.Offline["a"])
+
+	now = now.Add(2 * time.Hour)
+	result := sut.Update(map[string][]Agent{"a": agents("b")}, time.Hour)
+	require.True(t, result.Empty())
+
+	sut.Commit(first)
+	result = sut.Update(map[string][]Agent{"a": agents("b")}, time.Hour)
+	require.True(t, result.Empty())
+
+	now = now.Add(time.Hour)
+	result = sut.Update(map[string][]Agent{"a": agents("b")}, time.Hour)
+	require.Equal(t, agents("b"), result.Reminders["a"])
+}
+
+func TestUpdate_UncommittedAgentsAreNotRecovered(t *testing.T) {
+	sut := NewInMemoryOfflineAgentCache()
+
+	sut.Release(sut.Update(map[string][]Agent{"a": agents("b")}, 0))
+	result := sut.Update(map[string][]Agent{"a": {}}, 0)
+
+	require.True(t, result.Empty())
+	require.NotContains(t, sut.backingCache, "a")
+}
+
+func TestUpdate_RecoversPendingAgentsOnceCommitted(t *testing.T) {
+	sut := NewInMemoryOfflineAgentCache()
+
+	first := sut.Update(map[string][]Agent{"a": agents("b")}, 0)
+	result := sut.Update(map[string][]Agent{"a": {}}, 0)
+	require.True(t, result.Empty())
+	require.Empty(t, sut.List())
+	require.False(t, sut.Acknowledge("a", "b"))
+
+	sut.Commit(first)
+	result = sut.Update(map[string][]Agent{"a": {}}, 0)
+
+	require.Equal(t, agents("b"), result.Recovered["a"])
+	require.NotContains(t, sut.backingCache, "a")
+}
+
+func TestUpdate_ForgetsPendingAgentsOnceReleased(t *testing.T) {
+	sut := NewInMemoryOfflineAgentCache()
+
+	first := sut.Update(map[string][]Agent{"a": agents("b")}, 0)
+	sut.Update(map[string][]Agent{"a": {}}, 0)
+	sut.Release(first)
+	result := sut.Update(map[string][]Agent{"a": {}}, 0)
+
+	require.True(t, result.Empty())
+	require.NotContains(t, sut.backingCache, "a")
+}
+
+func TestUpdate_PendingAgentsThatGoOfflineAgainAreNotReturnedAgain(t *testing.T) {
+	sut := NewInMemoryOfflineAgentCache()
+
+	first := sut.Update(map[string][]Agent{"a": agents("b")}, 0)
+	sut.Update(map[string][]Agent{"a": {}}, 0)
+	result := sut.Update(map[string][]Agent{"a": agents("b")}, 0)
+	require.True(t, result.Empty())
+
+	sut.Commit(first)
+	result = sut.Update(map[string][]Agent{"a": agents("b")}, 0)
+
+	require.True(t, result.Empty())
+	require.Len(t, sut.List()["a"], 1)
+}
+
+func TestUpdate_RecoversDegradedAgentsThatGoOffline(t *testing.T) {
+	sut := NewInMemoryOfflineAgentCache()
+	degraded := Agent{Name: "b", Reason: "low disk space", Degraded: true}
+	offline := Agent{Name: "b", Reason: "disconnected"}
+
+	sut.Commit(sut.Update(map[string][]Agent{"a": {degraded}}, 0))
+	result := sut.Update(map[string][]Agent{"a": {offline}}, 0)
+
+	require.Equal(t, []Agent{offline}, result.Offline["a"])
+	require.Equal(t, []Agent{degraded}, result.Recovered["a"])
+
+	sut.Commit(result)
+	result = sut.Update(map[string][]Agent{"a": {}}, 0)
+
+	require.Equal(t, []Agent{offline}, result.Recovered["a"])
+}
+
+func TestUpdate_RecoversOfflineAgentsThatComeBackDegraded(t *testing.T) {
+	sut := NewInMemoryOfflineAgentCache()
+	offline := Agent{Name: "b", Reason: "disconnected"}
+	degraded := Agent{Name: "b", Reason: "low disk space", Degraded: true}
+
+	sut.Commit(sut.Update(map[string][]Agent{"a": {offline}}, 0))
+	result := sut.Update(map[string][]Agent{"a": {degraded}}, 0)
+
+	require.Equal(t, []Agent{degraded}, result.Offline["a"])
+	require.Equal(t, []Agent{offline}, result.Recovered["a"])
+
+	sut.Commit(result)
+	require.True(t, sut.Acknowledge("a", "b"))
+	require.True(t, sut.List()["a"][0].Acknowledged)
+	require.True(t, sut.List()["a"][0].Degraded)
+}
+
+func TestUpdate_RecoversStuckAgentsThatGoOfflineAndBack(t *testing.T) {
+	sut := NewInMemoryOfflineAgentCache()
+	stuck := Agent{Name: "b", Reason: "build running for 5h", Stuck: true}
+	offline := Agent{Name: "b", Reason: "disconnected"}
+
+	sut.Commit(sut.Update(map[string][]Agent{"a": {stuck}}, 0))
+	result := sut.Update(map[string][]Agent{"a": {offline}}, 0)
+
+	require.Equal(t, []Agent{offline}, result.Offline["a"])
+	require.Equal(t, []Agent{stuck}, result.Recovered["a"])
+
+	sut.Commit(result)
+	result = sut.Update(map[string][]Agent{"a": {stuck}}, 0)
+
+	require.Equal(t, []Agent{stuck}, result.Offline["a"])
+	require.Equal(t, []Agent{offline}, result.Recovered["a"])
+}
+
+func TestCommit_IgnoresAgentsNoLongerCached(t *testing.T) {
+	sut := NewInMemoryOfflineAgentCache()
+
+	first := sut.Update(map[string][]Agent{"a": agents("b")}, 0)
+	sut.Forget("a")
+	sut.Commit(first)
+
+	require.NotContains(t, sut.backingCache, "a")
+}
+
+func TestRelease_ReturnsAgentsAgain(t *testing.T) {
+	sut := NewInMemoryOfflineAgentCache()
+
+	sut.Release(sut.Update(map[string][]Agent{"a": agents("b")}, 0))
+	result := sut.Update(map[string][]Agent{"a": agents("b")}, 0)
+
+	require.Equal(t, agents("b"), result.Offline["a"])
+}
+
+func TestAcknowledge_StopsReminders(t *testing.T) {
+	now := time.Now()
+	sut := NewInMemoryOfflineAgentCache()
+	sut.now = func() time.Time { return now }
+
+	sut.Commit(sut.Update(map[string][]Agent{"a": agents("b")}, time.Hour))
+	require.True(t, sut.Acknowledge("a", "b"))
+	require.False(t, sut.Acknowledge("a", "c"))
+
+	now = now.Add(2 * time.Hour)
+	result := sut.Update(map[string][]Agent{"a": agents("b")}, time.Hour)
+	require.True(t, result.Empty())
+
+	result = sut.Update(map[string][]Agent{"a": {}}, time.Hour)
+	require.Equal(t, agents("b"), result.Recovered["a"])
+
+	sut.Commit(sut.Update(map[string][]Agent{"a": agents("b")}, time.Hour))
+	require.False(t, sut.List()["a"][0].Acknowledged)
+}
+
+func TestForget_RemovesSystem(t *testing.T) {
+	sut := NewInMemoryOfflineAgentCache()
+
+	sut.Commit(sut.Update(map[string][]Agent{"a": agents("b"), "c": agents("d")}, 0))
+	sut.Forget("a")
+
+	require.Equal(t, []string{"c"}, keys(sut.List()))
+
+	result := sut.Update(map[string][]Agent{"a": agents("b")}, 0)
+	require.Equal(t, agents("b"), result.Offline["a"])
+}
+
+func TestList_ReturnsOfflineAgents(t *testing.T) {
+	now := time.Now()
+	sut := NewInMemoryOfflineAgentCache()
+	sut.now = func() time.Time { return now }
+
+	sut.Commit(sut.Update(map[string][]Agent{"a": agents("c", "b")}, 0))
+
+	require.Equal(t, map[string][]OfflineAgent{"a": {
+		{Agent: Agent{Name: "b"}, Since: now, Notified: true, LastNotified: now},
+		{Agent: Agent{Name: "c"}, Since: now, Notified: true, LastNotified: now},
+	}}, sut.List())
+}
+
+func keys(offline map[string][]OfflineAgent) []string {
+	result := []string{}
+	for system := range offline {
+		result = append(result, system)
+	}
 
-	require.NotContains(t, result, "e")
-	require.Contains(t, result, "a")
-	require.NotContains(t, result["a"], "b")
-	require.Contains(t, result["a"], "d")
+	return result
 }
@@ -0,0 +1,130 @@
+package spot
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	offlineAgentsGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "spot",
+		Name:      "offline_agents",
+		Help:      "Number of offline agents as of the last successful check of each detector",
+	}, []string{"detector"})
+
+	agentUpGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "spot",
+		Name:      "agent_up",
+		Help:      "Whether an agent that has been offline is back online (1) or still offline (0)",
+	}, []string{"detector", "agent"})
+
+	checkDurationHistogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "spot",
+		Name:      "check_duration_seconds",
+		Help:      "How long it took to check a detector for offline agents",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"detector"})
+
+	detectorErrorsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "spot",
+		Name:      "detector_errors_total",
+		Help:      "Number of checks that failed for each detector",
+	}, []string{"detector"})
+
+	notificationsCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "spot",
+		Name:      "notifications_total",
+		Help:      "Number of notifications sent by each notifier, by kind and result",
+	}, []string{"notifier", "kind", "result"})
+)
+
+// agentSeries tracks the agent_up series of each detector by agent so that
+// series can be deleted once they are no longer needed. Each series is
+// true while its agent has recovered.
+var agentSeries = struct {
+	sync.Mutex
+	detectors map[string]map[string]bool
+}{detectors: map[string]map[string]bool{}}
+
+func init() {
+	prometheus.MustRegister(
+		offlineAgentsGauge,
+		agentUpGauge,
+		checkDurationHistogram,
+		detectorErrorsCounter,
+		notificationsCounter,
+	)
+}
+
+func observeCheck(detector string, duration time.Duration, offline int, err error) {
+	checkDurationHistogram.WithLabelValues(detector).Observe(duration.Seconds())
+
+	if err != nil {
+		detectorErrorsCounter.WithLabelValues(detector).Inc()
+	}
+
+	if err == nil || partial(err) {
+		offlineAgentsGauge.WithLabelValues(detector).Set(float64(offline))
+		expireRecovered(detector)
+	}
+}
+
+// expireRecovered deletes the agent_up series of agents that had already
+// recovered before the latest check of a detector, so that agents which
+// come and go, like cloud agents, do not leave series behind
+func expireRecovered(detector string) {
+	agentSeries.Lock()
+	defer agentSeries.Unlock()
+
+	for agent, recovered := range agentSeries.detectors[detector] {
+		if recovered {
+			agentUpGauge.DeleteLabelValues(detector, agent)
+			delete(agentSeries.detectors[detector], agent)
+		}
+	}
+}
+
+func observeTransition(transition Transition) {
+	agentSeries.Lock()
+	defer agentSeries.Unlock()
+
+	recovered := transition.Kind == TransitionRecovered
+	up := 0.0
+	if recovered {
+		up = 1.0
+	}
+
+	if agentSeries.detectors[transition.Detector] == nil {
+		agentSeries.detectors[transition.Detector] = map[string]bool{}
+	}
+
+	agentSeries.detectors[transition.Detector][transition.Agent.Name] = recovered
+	agentUpGauge.WithLabelValues(transition.Detector, transition.Agent.Name).Set(up)
+}
+
+// forgetDetectorMetrics deletes every series of a detector that is no
+// longer watched
+func forgetDetectorMetrics(detector string) {
+	agentSeries.Lock()
+	defer agentSeries.Unlock()
+
+	for agent := range agentSeries.detectors[detector] {
+		agentUpGauge.DeleteLabelValues(detector, agent)
+	}
+
+	delete(agentSeries.detectors, detector)
+	offlineAgentsGauge.DeleteLabelValues(detector)
+	checkDurationHistogram.DeleteLabelValues(detector)
+	detectorErrorsCounter.DeleteLabelValues(detector)
+}
+
+func observeNotification(notifier, kind string, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+
+	notificationsCounter.WithLabelValues(notifier, kind, result).Inc()
+}
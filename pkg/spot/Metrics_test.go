@@ -0,0 +1,116 @@
+package spot
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// hasSeries reports whether the default registry has a series of the
+// metric name with all of the labels
+func hasSeries(t *testing.T, name string, labels map[string]string) bool {
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+
+		for _, metric := range family.GetMetric() {
+			matched := 0
+			for _, label := range metric.GetLabel() {
+				if value, ok := labels[label.GetName()]; ok && value == label.GetValue() {
+					matched++
+				}
+			}
+
+			if matched == len(labels) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func TestMetrics_RecordsChecks(t *testing.T) {
+	d := &mockDetector{}
+	d.On("Name").Return("metrics")
+	d.On("FindOfflineAgents").Return(agents("b", "c"), nil).Once()
+	d.On("FindOfflineAgents").Return([]Agent(nil), fmt.Errorf("Mock Error")).Once()
+	d.On("FindOfflineAgents").Return(agents("c"), nil).Twice()
+
+	sut := NewWatchdog([]OfflineAgentDetector{d}, nil)
+	detector := "[MockDetector] metrics"
+	errors := testutil.ToFloat64(detectorErrorsCounter.WithLabelValues(detector))
+
+	sut.RunChecks()
+	require.Equal(t, 2.0, testutil.ToFloat64(offlineAgentsGauge.WithLabelValues(detector)))
+	require.Equal(t, 0.0, testutil.ToFloat64(agentUpGauge.WithLabelValues(detector, "b")))
+
+	sut.RunChecks()
+	require.Equal(t, 2.0, testutil.ToFloat64(offlineAgentsGauge.WithLabelValues(detector)))
+	require.Equal(t, errors+1, testutil.ToFloat64(detectorErrorsCounter.WithLabelValues(detector)))
+
+	sut.RunChecks()
+	require.Equal(t, 1.0, testutil.ToFloat64(offlineAgentsGauge.WithLabelValues(detector)))
+	require.Equal(t, 1.0, testutil.ToFloat64(agentUpGauge.WithLabelValues(detector, "b")))
+	require.Equal(t, 0.0, testutil.ToFloat64(agentUpGauge.WithLabelValues(detector, "c")))
+
+	sut.RunChecks()
+	require.False(t, hasSeries(t, "spot_agent_up", map[string]string{"detector": detector, "agent": "b"}))
+	require.True(t, hasSeries(t, "spot_agent_up", map[string]string{"detector": detector, "agent": "c"}))
+}
+
+func TestMetrics_ForgetsRemovedDetectors(t *testing.T) {
+	d := &mockDetector{}
+	d.On("Name").Return("metrics-removed")
+	d.On("FindOfflineAgents").Return(agents("b"), nil)
+
+	sut := NewWatchdog([]OfflineAgentDetector{d}, nil)
+	detector := "[MockDetector] metrics-removed"
+
+	sut.RunChecks()
+	require.True(t, hasSeries(t, "spot_agent_up", map[string]string{"detector": detector}))
+	require.True(t, hasSeries(t, "spot_offline_agents", map[string]string{"detector": detector}))
+
+	sut.Reconfigure([]OfflineAgentDetector{}, nil, nil, 0)
+	require.False(t, hasSeries(t, "spot_agent_up", map[string]string{"detector": detector}))
+	require.False(t, hasSeries(t, "spot_offline_agents", map[string]string{"detector": detector}))
+	require.False(t, hasSeries(t, "spot_check_duration_seconds", map[string]string{"detector": detector}))
+}
+
+func TestMetrics_RecordsNotifications(t *testing.T) {
+	ok := &mockNotifier{}
+	ok.On("Notify", map[string][]Agent{"a": agents("b")}).Return(nil)
+	broken := &mockNotifier{}
+	broken.On("Notify", map[string][]Agent{"a": agents("b")}).Return(fmt.Errorf("Mock Error"))
+
+	sut := NewMultiNotifier()
+	require.NoError(t, sut.Add("metrics-ok", ok))
+	require.NoError(t, sut.Add("metrics-broken", broken))
+	successes := testutil.ToFloat64(notificationsCounter.WithLabelValues("metrics-ok", deliveryNotify, "success"))
+	failures := testutil.ToFloat64(notificationsCounter.WithLabelValues("metrics-broken", deliveryNotify, "failure"))
+
+	sut.Notify(map[string][]Agent{"a": agents("b")})
+
+	require.Equal(t, successes+1, testutil.ToFloat64(notificationsCounter.WithLabelValues("metrics-ok", deliveryNotify, "success")))
+	require.Equal(t, failures+1, testutil.ToFloat64(notificationsCounter.WithLabelValues("metrics-broken", deliveryNotify, "failure")))
+}
+
+func TestServer_ServesMetrics(t *testing.T) {
+	forgetDetectorMetrics("served")
+	observeCheck("served", time.Second, 3, nil)
+	_, sut := mockServer(agents())
+
+	resp := request(sut, "GET", "/metrics", "")
+
+	require.Equal(t, 200, resp.Code)
+	require.Contains(t, resp.Body.String(), `spot_offline_agents{detector="served"} 3`)
+	require.Contains(t, resp.Body.String(), `spot_check_duration_seconds_count{detector="served"} 1`)
+}
@@ -0,0 +1,252 @@
+package spot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// NotifierStatus records the outcome of deliveries to a single notifier
+type NotifierStatus struct {
+	LastAttempt time.Time
+	LastSuccess time.Time
+	LastError   string
+	// Failures is the number of consecutive failed deliveries
+	Failures int
+}
+
+// NotificationError aggregates the errors returned by the notifiers of a
+// MultiNotifier, keyed by notifier name
+type NotificationError map[string]error
+
+func (e NotificationError) Error() string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	messages := make([]string, 0, len(names))
+	for _, name := range names {
+		messages = append(messages, fmt.Sprintf("%s: %s", name, e[name].Error()))
+	}
+
+	return fmt.Sprintf("%d notifier(s) failed: %s", len(e), strings.Join(messages, "; "))
+}
+
+type namedNotifier struct {
+	name     string
+	notifier Notifier
+}
+
+// MultiNotifier is a FollowUpNotifier that dispatches to a set of named
+// notifiers concurrently. A failure in one notifier does not prevent the
+// others from being notified. Follow-ups are only sent to notifiers that
+// implement FollowUpNotifier.
+type MultiNotifier struct {
+	notifiers []namedNotifier
+
+	lock   sync.Mutex
+	status map[string]*NotifierStatus
+	now    func() time.Time
+}
+
+// NewMultiNotifier constructs an empty MultiNotifier
+func NewMultiNotifier() *MultiNotifier {
+	return &MultiNotifier{
+		notifiers: []namedNotifier{},
+		status:    map[string]*NotifierStatus{},
+		now:       time.Now,
+	}
+}
+
+// Add registers a notifier under the specified name. Names must be unique.
+func (m *MultiNotifier) Add(name string, notifier Notifier) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if _, exists := m.status[name]; exists {
+		return fmt.Errorf("A notifier named '%s' already exists", name)
+	}
+
+	m.notifiers = append(m.notifiers, namedNotifier{name: name, notifier: notifier})
+	m.status[name] = &NotifierStatus{}
+	return nil
+}
+
+// Names returns the names of all registered notifiers in the order they
+// were added
+func (m *MultiNotifier) Names() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	result := make([]string, 0, len(m.notifiers))
+	for _, n := range m.notifiers {
+		result = append(result, n.name)
+	}
+
+	return result
+}
+
+// Status returns a snapshot of the delivery status of each notifier
+func (m *MultiNotifier) Status() map[string]NotifierStatus {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	result := map[string]NotifierStatus{}
+	for name, status := range m.status {
+		result[name] = *status
+	}
+
+	return result
+}
+
+func (m *MultiNotifier) record(name, kind string, err error) {
+	observeNotification(name, kind, err)
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	status := m.status[name]
+	status.LastAttempt = m.now()
+
+	if err != nil {
+		status.LastError = err.Error()
+		status.Failures++
+	} else {
+		status.LastSuccess = status.LastAttempt
+		status.LastError = ""
+		status.Failures = 0
+	}
+}
+
+// Has returns true if a notifier with the specified name has been added
+func (m *MultiNotifier) Has(name string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	_, exists := m.status[name]
+	return exists
+}
+
+// dispatch calls send for each notifier concurrently and waits for all of
+// them to finish. Notifiers for which send returns false are skipped.
+func (m *MultiNotifier) dispatch(kind string, send func(string, Notifier) (bool, error)) error {
+	m.lock.Lock()
+	notifiers := append([]namedNotifier{}, m.notifiers...)
+	m.lock.Unlock()
+
+	wg := sync.WaitGroup{}
+	errLock := sync.Mutex{}
+	errs := NotificationError{}
+
+	for _, n := range notifiers {
+		wg.Add(1)
+		go func(n namedNotifier) {
+			defer wg.Done()
+
+			l := logrus.WithFields(logrus.Fields{"notifier": n.name, "kind": kind})
+			sent, err := send(n.name, n.notifier)
+			if !sent {
+				return
+			}
+
+			m.record(n.name, kind, err)
+			if err != nil {
+				l.WithError(err).Error("Notifier failed")
+
+				errLock.Lock()
+				errs[n.name] = err
+				errLock.Unlock()
+			} else {
+				l.Debug("Notifier succeeded")
+			}
+		}(n)
+	}
+
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+const (
+	deliveryNotify  = "notify"
+	deliveryRemind  = "remind"
+	deliveryRecover = "recover"
+)
+
+// deliver sends agents to a notifier using the method matching kind.
+// Follow-ups are skipped for notifiers that are not FollowUpNotifiers.
+func deliver(kind string, n Notifier, agents map[string][]Agent) (bool, error) {
+	if kind == deliveryNotify {
+		return true, n.Notify(agents)
+	}
+
+	f, ok := n.(FollowUpNotifier)
+	if !ok {
+		return false, nil
+	}
+
+	if kind == deliveryRemind {
+		return true, f.Remind(agents)
+	}
+
+	return true, f.Recover(agents)
+}
+
+// deliverEach sends each notifier only the agents routed to it by name.
+// Notifiers with nothing routed to them are skipped.
+func (m *MultiNotifier) deliverEach(kind string, routed map[string]map[string][]Agent) error {
+	return m.dispatch(kind, func(name string, n Notifier) (bool, error) {
+		if len(routed[name]) == 0 {
+			return false, nil
+		}
+
+		return deliver(kind, n, routed[name])
+	})
+}
+
+// deliverTo implements partialNotifier by sending agents to only the
+// specified notifiers
+func (m *MultiNotifier) deliverTo(kind string, agents map[string][]Agent, names map[string]bool) error {
+	return m.dispatch(kind, func(name string, n Notifier) (bool, error) {
+		if !names[name] {
+			return false, nil
+		}
+
+		return deliver(kind, n, agents)
+	})
+}
+
+// Notify implements spot.Notifier.Notify by notifying every registered
+// notifier. If any notifiers fail, a NotificationError is returned.
+func (m *MultiNotifier) Notify(agents map[string][]Agent) error {
+	return m.dispatch(deliveryNotify, func(name string, n Notifier) (bool, error) {
+		return deliver(deliveryNotify, n, agents)
+	})
+}
+
+// Remind implements spot.FollowUpNotifier.Remind by reminding every
+// registered FollowUpNotifier
+func (m *MultiNotifier) Remind(agents map[string][]Agent) error {
+	return m.dispatch(deliveryRemind, func(name string, n Notifier) (bool, error) {
+		return deliver(deliveryRemind, n, agents)
+	})
+}
+
+// Recover implements spot.FollowUpNotifier.Recover by telling every
+// registered FollowUpNotifier about recovered agents
+func (m *MultiNotifier) Recover(agents map[string][]Agent) error {
+	return m.dispatch(deliveryRecover, func(name string, n Notifier) (bool, error) {
+		return deliver(deliveryRecover, n, agents)
+	})
+}
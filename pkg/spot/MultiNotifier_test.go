@@ -0,0 +1,137 @@
+package spot
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type blockingNotifier struct {
+	started chan bool
+	release chan bool
+}
+
+func (b *blockingNotifier) Notify(agents map[string][]Agent) error {
+	b.started <- true
+	<-b.release
+	return nil
+}
+
+func TestMultiNotifier_ErrorForDuplicateName(t *testing.T) {
+	sut := NewMultiNotifier()
+
+	require.NoError(t, sut.Add("a", &mockNotifier{}))
+	require.EqualError(t, sut.Add("a", &mockNotifier{}), "A notifier named 'a' already exists")
+	require.Equal(t, []string{"a"}, sut.Names())
+}
+
+func TestMultiNotifier_NotifiesAll(t *testing.T) {
+	offline := map[string][]Agent{"a": agents("b")}
+	n1 := &mockNotifier{}
+	n1.On("Notify", offline).Return(nil)
+	n2 := &mockFollowUpNotifier{}
+	n2.On("Notify", offline).Return(nil)
+
+	sut := NewMultiNotifier()
+	sut.Add("n1", n1)
+	sut.Add("n2", n2)
+
+	require.NoError(t, sut.Notify(offline))
+
+	n1.AssertExpectations(t)
+	n2.AssertExpectations(t)
+}
+
+func TestMultiNotifier_FailureDoesNotBlockOthers(t *testing.T) {
+	now := time.Date(2018, 9, 1, 12, 0, 0, 0, time.UTC)
+	offline := map[string][]Agent{"a": agents("b")}
+	n1 := &mockNotifier{}
+	n1.On("Notify", offline).Return(fmt.Errorf("Mock Error"))
+	n2 := &mockNotifier{}
+	n2.On("Notify", offline).Return(nil)
+	n3 := &mockNotifier{}
+	n3.On("Notify", offline).Return(fmt.Errorf("Another Error"))
+
+	sut := NewMultiNotifier()
+	sut.now = func() time.Time { return now }
+	sut.Add("n1", n1)
+	sut.Add("n2", n2)
+	sut.Add("n3", n3)
+
+	err := sut.Notify(offline)
+
+	require.EqualError(t, err, "2 notifier(s) failed: n1: Mock Error; n3: Another Error")
+	require.IsType(t, NotificationError{}, err)
+	n2.AssertExpectations(t)
+
+	status := sut.Status()
+	require.Equal(t, NotifierStatus{LastAttempt: now, LastError: "Mock Error", Failures: 1}, status["n1"])
+	require.Equal(t, NotifierStatus{LastAttempt: now, LastSuccess: now}, status["n2"])
+	require.Equal(t, 1, status["n3"].Failures)
+}
+
+func TestMultiNotifier_SuccessResetsFailures(t *testing.T) {
+	offline := map[string][]Agent{"a": agents("b")}
+	n := &mockNotifier{}
+	n.On("Notify", offline).Return(fmt.Errorf("Mock Error")).Twice()
+	n.On("Notify", offline).Return(nil).Once()
+
+	sut := NewMultiNotifier()
+	sut.Add("n", n)
+
+	require.Error(t, sut.Notify(offline))
+	require.Error(t, sut.Notify(offline))
+	require.Equal(t, 2, sut.Status()["n"].Failures)
+
+	require.NoError(t, sut.Notify(offline))
+	require.Equal(t, 0, sut.Status()["n"].Failures)
+	require.Empty(t, sut.Status()["n"].LastError)
+}
+
+func TestMultiNotifier_FollowUpsOnlySentToFollowUpNotifiers(t *testing.T) {
+	offline := map[string][]Agent{"a": agents("b")}
+	n1 := &mockNotifier{}
+	n2 := &mockFollowUpNotifier{}
+	n2.On("Remind", offline).Return(nil)
+	n2.On("Recover", offline).Return(nil)
+
+	sut := NewMultiNotifier()
+	sut.Add("n1", n1)
+	sut.Add("n2", n2)
+
+	require.NoError(t, sut.Remind(offline))
+	require.NoError(t, sut.Recover(offline))
+
+	n1.AssertNotCalled(t, "Notify", mock.Anything)
+	n2.AssertExpectations(t)
+	require.True(t, sut.Status()["n1"].LastAttempt.IsZero())
+}
+
+func TestMultiNotifier_DispatchesConcurrently(t *testing.T) {
+	b1 := &blockingNotifier{started: make(chan bool, 1), release: make(chan bool)}
+	b2 := &blockingNotifier{started: make(chan bool, 1), release: make(chan bool)}
+
+	sut := NewMultiNotifier()
+	sut.Add("b1", b1)
+	sut.Add("b2", b2)
+
+	done := make(chan error)
+	go func() {
+		done <- sut.Notify(map[string][]Agent{"a": agents("b")})
+	}()
+
+	for _, b := range []*blockingNotifier{b1, b2} {
+		select {
+		case <-b.started:
+		case <-time.After(time.Second):
+			require.FailNow(t, "Expected both notifiers to be called at the same time")
+		}
+	}
+
+	close(b1.release)
+	close(b2.release)
+	require.NoError(t, <-done)
+}
@@ -0,0 +1,347 @@
+package spot
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RetryableError is returned by notifiers when a notification failed in a
+// way that may succeed if it is sent again later, such as being rate
+// limited or the server returning a 5xx error.
+type RetryableError struct {
+	Err error
+	// RetryAfter is how long the server asked us to wait, if it said
+	RetryAfter time.Duration
+}
+
+func (e *RetryableError) Error() string {
+	return e.Err.Error()
+}
+
+// parseRetryAfter parses a Retry-After header, which may be either a number
+// of seconds or an HTTP date
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.ParseFloat(header, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second))
+	}
+
+	if date, err := http.ParseTime(header); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+
+	return 0
+}
+
+// checkResponse returns an error if a notification request was not
+// successful. Rate limiting and server errors are returned as a
+// RetryableError.
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+
+	err := fmt.Errorf("Failed to notify: %s", resp.Status)
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return &RetryableError{
+			Err:        err,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
+	}
+
+	return err
+}
+
+// retryable returns true if err, or any of the errors it aggregates, may
+// succeed if retried. The longest requested delay is also returned.
+func retryable(err error) (bool, time.Duration) {
+	switch e := err.(type) {
+	case *RetryableError:
+		return true, e.RetryAfter
+	case NotificationError:
+		result := false
+		var delay time.Duration
+		for _, inner := range e {
+			if ok, d := retryable(inner); ok {
+				result = true
+				if d > delay {
+					delay = d
+				}
+			}
+		}
+
+		return result, delay
+	}
+
+	return false, 0
+}
+
+// partialNotifier is implemented by notifiers that dispatch to other named
+// notifiers so that only the ones that failed are retried
+type partialNotifier interface {
+	deliverTo(kind string, agents map[string][]Agent, names map[string]bool) error
+}
+
+// redeliver sends agents to a notifier again after a failed attempt. If the
+// previous attempt failed for only some of the notifiers behind a
+// partialNotifier, only the ones that may succeed are retried.
+func redeliver(kind string, n Notifier, agents map[string][]Agent, previous error) error {
+	if failed, ok := previous.(NotificationError); ok {
+		if p, ok := n.(partialNotifier); ok {
+			names := map[string]bool{}
+			for name, err := range failed {
+				if ok, _ := retryable(err); ok {
+					names[name] = true
+				}
+			}
+
+			return p.deliverTo(kind, agents, names)
+		}
+	}
+
+	_, err := deliver(kind, n, agents)
+	return err
+}
+
+// RetryPolicy controls how often and how quickly notifications are retried
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry. It doubles after
+	// every failed attempt.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between attempts
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy is used when a RetryQueue is constructed without one
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: 5 * time.Second,
+	MaxBackoff:     5 * time.Minute,
+}
+
+// Backoff returns how long to wait after the specified number of failed
+// attempts. Exponential backoff is applied with jitter so that retries to
+// the same service do not line up, but never sooner than retryAfter.
+func (p RetryPolicy) Backoff(attempts int, retryAfter time.Duration) time.Duration {
+	delay := p.InitialBackoff
+	for i := 1; i < attempts && delay < p.MaxBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+
+	if delay > 0 {
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	}
+
+	if delay < retryAfter {
+		delay = retryAfter
+	}
+
+	return delay
+}
+
+type retryJob struct {
+	name     string
+	attempt  func(previous error) error
+	done     func(error)
+	attempts int
+	lastErr  error
+	next     time.Time
+}
+
+// RetryQueue retries failed notifications in the background until they
+// succeed or the retry policy is exhausted
+type RetryQueue struct {
+	Policy RetryPolicy
+
+	lock    sync.Mutex
+	jobs    []*retryJob
+	pending sync.WaitGroup
+	stopped bool
+	wake    chan bool
+	stop    chan bool
+	now     func() time.Time
+}
+
+// NewRetryQueue constructs a RetryQueue and starts processing retries in
+// the background. Call Stop to stop processing.
+func NewRetryQueue(policy RetryPolicy) *RetryQueue {
+	q := &RetryQueue{
+		Policy: policy,
+		jobs:   []*retryJob{},
+		wake:   make(chan bool, 1),
+		stop:   make(chan bool),
+		now:    time.Now,
+	}
+
+	go q.run()
+	return q
+}
+
+// Enqueue schedules a notification that failed with err to be retried.
+// attempt is called with the error from the previous attempt and should
+// return the result of trying again. done is called once with the final
+// result when the notification succeeds, the policy is exhausted or the
+// queue is stopped. Errors that are not retryable are passed straight to
+// done, as are all errors once the queue is stopped.
+func (q *RetryQueue) Enqueue(name string, err error, attempt func(previous error) error, done func(error)) {
+	ok, retryAfter := retryable(err)
+	if !ok || q.Policy.MaxAttempts <= 1 {
+		done(err)
+		return
+	}
+
+	job := &retryJob{
+		name:     name,
+		attempt:  attempt,
+		done:     done,
+		attempts: 1,
+		lastErr:  err,
+		next:     q.now().Add(q.Policy.Backoff(1, retryAfter)),
+	}
+
+	logrus.WithFields(logrus.Fields{"notification": name, "retryAt": job.next}).Warn("Notification failed, queueing for retry")
+
+	q.lock.Lock()
+	if q.stopped {
+		q.lock.Unlock()
+		done(err)
+		return
+	}
+
+	q.pending.Add(1)
+	q.jobs = append(q.jobs, job)
+	q.lock.Unlock()
+
+	select {
+	case q.wake <- true:
+	default:
+	}
+}
+
+// Len returns the number of notifications waiting to be retried
+func (q *RetryQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return len(q.jobs)
+}
+
+// Wait blocks until every queued notification has succeeded or exhausted
+// its retries
+func (q *RetryQueue) Wait() {
+	q.pending.Wait()
+}
+
+// Stop stops processing retries. Notifications that are still queued are
+// abandoned and done is called with the error from their last attempt, so
+// Wait returns once any retry already in progress has finished.
+func (q *RetryQueue) Stop() {
+	q.lock.Lock()
+	q.stopped = true
+	q.lock.Unlock()
+
+	close(q.stop)
+}
+
+// abandon gives up on every queued job
+func (q *RetryQueue) abandon() {
+	q.lock.Lock()
+	jobs := q.jobs
+	q.jobs = []*retryJob{}
+	q.lock.Unlock()
+
+	for _, job := range jobs {
+		logrus.WithError(job.lastErr).WithField("notification", job.name).Error("Abandoning notification, retries were stopped")
+		job.done(job.lastErr)
+		q.pending.Done()
+	}
+}
+
+// next returns the job that should be attempted soonest
+func (q *RetryQueue) next() *retryJob {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	var result *retryJob
+	for _, job := range q.jobs {
+		if result == nil || job.next.Before(result.next) {
+			result = job
+		}
+	}
+
+	return result
+}
+
+func (q *RetryQueue) remove(job *retryJob) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for i, j := range q.jobs {
+		if j == job {
+			q.jobs = append(q.jobs[:i], q.jobs[i+1:]...)
+			return
+		}
+	}
+}
+
+func (q *RetryQueue) run() {
+	for {
+		job := q.next()
+
+		var timer <-chan time.Time
+		if job != nil {
+			timer = time.After(job.next.Sub(q.now()))
+		}
+
+		select {
+		case <-q.stop:
+			q.abandon()
+			return
+		case <-q.wake:
+		case <-timer:
+			q.retry(job)
+		}
+	}
+}
+
+func (q *RetryQueue) retry(job *retryJob) {
+	l := logrus.WithFields(logrus.Fields{"notification": job.name, "attempt": job.attempts + 1})
+
+	job.lastErr = job.attempt(job.lastErr)
+	job.attempts++
+
+	ok, retryAfter := retryable(job.lastErr)
+	if job.lastErr == nil || !ok || job.attempts >= q.Policy.MaxAttempts {
+		if job.lastErr != nil {
+			l.WithError(job.lastErr).Error("Giving up on notification")
+		} else {
+			l.Info("Notification succeeded after retrying")
+		}
+
+		q.remove(job)
+		job.done(job.lastErr)
+		q.pending.Done()
+		return
+	}
+
+	q.lock.Lock()
+	job.next = q.now().Add(q.Policy.Backoff(job.attempts, retryAfter))
+	q.lock.Unlock()
+
+	l.WithError(job.lastErr).WithField("retryAt", job.next).Warn("Notification failed again, queueing for retry")
+}
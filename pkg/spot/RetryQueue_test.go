@@ -0,0 +1,254 @@
+package spot
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     10 * time.Millisecond,
+}
+
+func retryableError(message string) error {
+	return &RetryableError{Err: errors.New(message)}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	require.Equal(t, time.Duration(0), parseRetryAfter("", now))
+	require.Equal(t, 30*time.Second, parseRetryAfter("30", now))
+	require.Equal(t, 1500*time.Millisecond, parseRetryAfter("1.5", now))
+	require.Equal(t, time.Minute, parseRetryAfter(now.Add(time.Minute).Format(http.TimeFormat), now))
+	require.Equal(t, time.Duration(0), parseRetryAfter(now.Add(-time.Minute).Format(http.TimeFormat), now))
+	require.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+}
+
+func TestCheckResponse(t *testing.T) {
+	require.NoError(t, checkResponse(&http.Response{StatusCode: 204, Status: "204 No Content"}))
+
+	err := checkResponse(&http.Response{StatusCode: 400, Status: "400 Bad Request"})
+	require.EqualError(t, err, "Failed to notify: 400 Bad Request")
+	ok, _ := retryable(err)
+	require.False(t, ok)
+
+	err = checkResponse(&http.Response{StatusCode: 503, Status: "503 Service Unavailable", Header: http.Header{}})
+	require.EqualError(t, err, "Failed to notify: 503 Service Unavailable")
+	ok, _ = retryable(err)
+	require.True(t, ok)
+
+	err = checkResponse(&http.Response{StatusCode: 429, Status: "429 Too Many Requests", Header: http.Header{"Retry-After": {"7"}}})
+	ok, delay := retryable(err)
+	require.True(t, ok)
+	require.Equal(t, 7*time.Second, delay)
+}
+
+func TestRetryable_NotificationError(t *testing.T) {
+	ok, _ := retryable(NotificationError{"a": fmt.Errorf("Nope")})
+	require.False(t, ok)
+
+	ok, delay := retryable(NotificationError{
+		"a": fmt.Errorf("Nope"),
+		"b": &RetryableError{Err: fmt.Errorf("Later"), RetryAfter: time.Second},
+		"c": &RetryableError{Err: fmt.Errorf("Later"), RetryAfter: time.Minute},
+	})
+	require.True(t, ok)
+	require.Equal(t, time.Minute, delay)
+}
+
+func TestBackoff(t *testing.T) {
+	sut := RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Second, MaxBackoff: 10 * time.Second}
+
+	for i := 0; i < 100; i++ {
+		first := sut.Backoff(1, 0)
+		require.True(t, first >= 500*time.Millisecond && first <= time.Second, first.String())
+
+		third := sut.Backoff(3, 0)
+		require.True(t, third >= 2*time.Second && third <= 4*time.Second, third.String())
+
+		capped := sut.Backoff(10, 0)
+		require.True(t, capped >= 5*time.Second && capped <= 10*time.Second, capped.String())
+	}
+
+	require.Equal(t, time.Minute, sut.Backoff(1, time.Minute))
+}
+
+func TestRetryQueue_SucceedsAfterRetrying(t *testing.T) {
+	sut := NewRetryQueue(testRetryPolicy)
+	defer sut.Stop()
+
+	attempts := 0
+	var result error = fmt.Errorf("Not called")
+
+	sut.Enqueue("test", retryableError("First"), func(previous error) error {
+		attempts++
+		if attempts == 1 {
+			require.EqualError(t, previous, "First")
+			return retryableError("Second")
+		}
+
+		require.EqualError(t, previous, "Second")
+		return nil
+	}, func(err error) {
+		result = err
+	})
+
+	sut.Wait()
+
+	require.NoError(t, result)
+	require.Equal(t, 2, attempts)
+	require.Equal(t, 0, sut.Len())
+}
+
+func TestRetryQueue_GivesUpAfterMaxAttempts(t *testing.T) {
+	sut := NewRetryQueue(testRetryPolicy)
+	defer sut.Stop()
+
+	attempts := 0
+	var result error
+
+	sut.Enqueue("test", retryableError("Broken"), func(previous error) error {
+		attempts++
+		return retryableError("Still Broken")
+	}, func(err error) {
+		result = err
+	})
+
+	sut.Wait()
+
+	require.EqualError(t, result, "Still Broken")
+	require.Equal(t, 2, attempts)
+}
+
+func TestRetryQueue_StopsOnErrorThatIsNotRetryable(t *testing.T) {
+	sut := NewRetryQueue(testRetryPolicy)
+	defer sut.Stop()
+
+	attempts := 0
+	var result error
+
+	sut.Enqueue("test", retryableError("Broken"), func(previous error) error {
+		attempts++
+		return fmt.Errorf("Permanently Broken")
+	}, func(err error) {
+		result = err
+	})
+
+	sut.Wait()
+
+	require.EqualError(t, result, "Permanently Broken")
+	require.Equal(t, 1, attempts)
+}
+
+func TestRetryQueue_DoesNotQueueErrorThatIsNotRetryable(t *testing.T) {
+	sut := NewRetryQueue(testRetryPolicy)
+	defer sut.Stop()
+
+	var result error
+	sut.Enqueue("test", fmt.Errorf("Broken"), func(previous error) error {
+		t.Fatal("Should not be retried")
+		return nil
+	}, func(err error) {
+		result = err
+	})
+
+	require.EqualError(t, result, "Broken")
+	require.Equal(t, 0, sut.Len())
+}
+
+func TestRetryQueue_RetriesConcurrentJobs(t *testing.T) {
+	sut := NewRetryQueue(testRetryPolicy)
+	defer sut.Stop()
+
+	lock := sync.Mutex{}
+	done := map[string]error{}
+
+	for _, name := range []string{"a", "b", "c"} {
+		name := name
+		sut.Enqueue(name, retryableError("Broken"), func(previous error) error {
+			return nil
+		}, func(err error) {
+			lock.Lock()
+			done[name] = err
+			lock.Unlock()
+		})
+	}
+
+	sut.Wait()
+
+	require.Equal(t, map[string]error{"a": nil, "b": nil, "c": nil}, done)
+}
+
+func TestRetryQueue_StopAbandonsQueuedJobs(t *testing.T) {
+	sut := NewRetryQueue(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour, MaxBackoff: time.Hour})
+
+	var result error
+	sut.Enqueue("test", retryableError("Broken"), func(previous error) error {
+		t.Fatal("Should not be retried")
+		return nil
+	}, func(err error) {
+		result = err
+	})
+
+	sut.Stop()
+	sut.Wait()
+
+	require.EqualError(t, result, "Broken")
+	require.Equal(t, 0, sut.Len())
+
+	sut.Enqueue("test", retryableError("Broken Again"), func(previous error) error {
+		t.Fatal("Should not be retried")
+		return nil
+	}, func(err error) {
+		result = err
+	})
+
+	require.EqualError(t, result, "Broken Again")
+	require.Equal(t, 0, sut.Len())
+}
+
+func TestRedeliver_RetriesOnlyFailedNotifiers(t *testing.T) {
+	a := &mockFollowUpNotifier{}
+	b := &mockFollowUpNotifier{}
+	c := &mockFollowUpNotifier{}
+
+	sut := NewMultiNotifier()
+	require.NoError(t, sut.Add("a", a))
+	require.NoError(t, sut.Add("b", b))
+	require.NoError(t, sut.Add("c", c))
+
+	offline := map[string][]Agent{"x": agents("y")}
+	b.On("Remind", offline).Return(nil)
+
+	err := redeliver(deliveryRemind, sut, offline, NotificationError{
+		"b": retryableError("Later"),
+		"c": fmt.Errorf("Never"),
+	})
+
+	require.NoError(t, err)
+	b.AssertExpectations(t)
+	a.AssertNotCalled(t, "Remind", offline)
+	c.AssertNotCalled(t, "Remind", offline)
+}
+
+func TestRedeliver_RetriesOnlyFailedRoutes(t *testing.T) {
+	sut, mocks := mockRouter(t, []string{"agent=^win-;notify=windows"}, []string{"default"}, "windows", "default")
+
+	mocks["default"].On("Notify", map[string][]Agent{"x": agents("linux-1")}).Return(nil)
+
+	err := redeliver(deliveryNotify, sut, map[string][]Agent{"x": agents("win-1", "linux-1")}, NotificationError{
+		"default": retryableError("Later"),
+	})
+
+	require.NoError(t, err)
+	mocks["default"].AssertExpectations(t)
+	mocks["windows"].AssertNotCalled(t, "Notify", map[string][]Agent{"x": agents("win-1")})
+}
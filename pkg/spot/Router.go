@@ -0,0 +1,316 @@
+package spot
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Route sends agents that match all of its configured matchers to a set of
+// notifiers. Matchers that are not set match every agent.
+type Route struct {
+	Detector *regexp.Regexp
+	Agent    *regexp.Regexp
+	Class    *regexp.Regexp
+	Reason   *regexp.Regexp
+	// Labels must all be assigned to an agent for it to match
+	Labels []string
+	// Manual, if set, matches agents that were or were not deliberately
+	// taken offline
+	Manual *bool
+	// Degraded, if set, matches agents that are or are not online but
+	// unhealthy
+	Degraded *bool
+	// Stuck, if set, matches agents that are or are not online but stuck on
+	// long-running builds
+	Stuck *bool
+	// Starved, if set, matches labels whose builds are or are not starved
+	// of executors
+	Starved *bool
+
+	// Notifiers are the names of the notifiers to send matching agents to
+	Notifiers []string
+	// Continue controls whether later routes are evaluated after this one
+	// matches. By default, the first matching route wins.
+	Continue bool
+}
+
+// parseFlag parses the value of a boolean route key, which defaults to true
+// if no value is given
+func parseFlag(value string) (*bool, error) {
+	result := true
+	if value == "" {
+		return &result, nil
+	}
+
+	result, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// ParseRoute parses a route from a string of semicolon separated key=value
+// pairs. The following keys are supported:
+//
+// detector, agent, class, reason: regular expressions matched against the
+// detector name and the agent's name, class and offline reason
+//
+// label: a label that must be assigned to the agent. May be repeated.
+//
+// manual: whether the agent was deliberately taken offline, e.g. for
+// maintenance. Defaults to true if no value is given.
+//
+// degraded: whether the agent is online but unhealthy. Defaults to true if
+// no value is given.
+//
+// stuck: whether the agent is online but stuck on long-running builds.
+// Defaults to true if no value is given.
+//
+// starved: whether the entry is a label whose builds are waiting in the
+// queue for too long. Defaults to true if no value is given.
+//
+// notify: a comma separated list of notifier names
+//
+// continue: keep evaluating routes after this one matches
+//
+// For example: agent=^win-;label=docker;notify=slack-1,discord-1;continue
+func ParseRoute(spec string) (*Route, error) {
+	result := &Route{}
+
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		kv := strings.SplitN(part, "=", 2)
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		value := ""
+		if len(kv) == 2 {
+			value = strings.TrimSpace(kv[1])
+		}
+
+		var err error
+		switch key {
+		case "detector":
+			result.Detector, err = regexp.Compile(value)
+		case "agent":
+			result.Agent, err = regexp.Compile(value)
+		case "class":
+			result.Class, err = regexp.Compile(value)
+		case "reason":
+			result.Reason, err = regexp.Compile(value)
+		case "label":
+			result.Labels = append(result.Labels, value)
+		case "manual":
+			result.Manual, err = parseFlag(value)
+		case "degraded":
+			result.Degraded, err = parseFlag(value)
+		case "stuck":
+			result.Stuck, err = parseFlag(value)
+		case "starved":
+			result.Starved, err = parseFlag(value)
+		case "notify":
+			for _, name := range strings.Split(value, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					result.Notifiers = append(result.Notifiers, name)
+				}
+			}
+		case "continue":
+			result.Continue = true
+			if value != "" {
+				result.Continue, err = strconv.ParseBool(value)
+			}
+		default:
+			return nil, fmt.Errorf("Unknown route key '%s'", key)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid value for route key '%s': %s", key, err.Error())
+		}
+	}
+
+	if len(result.Notifiers) == 0 {
+		return nil, fmt.Errorf("Route does not notify anyone: %s", spec)
+	}
+
+	return result, nil
+}
+
+func hasLabel(agent Agent, label string) bool {
+	for _, l := range agent.Labels {
+		if l == label {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Matches returns true if an agent reported by the specified detector
+// matches every matcher of the route
+func (r *Route) Matches(detector string, agent Agent) bool {
+	if r.Detector != nil && !r.Detector.MatchString(detector) {
+		return false
+	}
+
+	if r.Agent != nil && !r.Agent.MatchString(agent.Name) {
+		return false
+	}
+
+	if r.Class != nil && !r.Class.MatchString(agent.Class) {
+		return false
+	}
+
+	if r.Reason != nil && !r.Reason.MatchString(agent.Reason) {
+		return false
+	}
+
+	if r.Manual != nil && *r.Manual != agent.Manual {
+		return false
+	}
+
+	if r.Degraded != nil && *r.Degraded != agent.Degraded {
+		return false
+	}
+
+	if r.Stuck != nil && *r.Stuck != agent.Stuck {
+		return false
+	}
+
+	if r.Starved != nil && *r.Starved != agent.Starved {
+		return false
+	}
+
+	for _, label := range r.Labels {
+		if !hasLabel(agent, label) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Router is a FollowUpNotifier that sends each agent to the notifiers of
+// the routes it matches. Routes are evaluated in order and the first
+// matching route wins unless it is marked to continue. Agents that do not
+// match any route are sent to the default notifiers.
+type Router struct {
+	Routes  []*Route
+	Default []string
+
+	notifiers *MultiNotifier
+}
+
+// NewRouter constructs a Router that routes agents to the named notifiers
+// of the provided MultiNotifier
+func NewRouter(notifiers *MultiNotifier, routes []*Route, defaults []string) (*Router, error) {
+	for i, route := range routes {
+		for _, name := range route.Notifiers {
+			if !notifiers.Has(name) {
+				return nil, fmt.Errorf("Route %d refers to an unknown notifier '%s'", i+1, name)
+			}
+		}
+	}
+
+	for _, name := range defaults {
+		if !notifiers.Has(name) {
+			return nil, fmt.Errorf("The default route refers to an unknown notifier '%s'", name)
+		}
+	}
+
+	return &Router{
+		Routes:    routes,
+		Default:   defaults,
+		notifiers: notifiers,
+	}, nil
+}
+
+// route splits agents up by the name of the notifier they should be sent to
+func (r *Router) route(agents map[string][]Agent) map[string]map[string][]Agent {
+	result := map[string]map[string][]Agent{}
+
+	add := func(names []string, detector string, agent Agent, seen map[string]bool) {
+		for _, name := range names {
+			if seen[name] {
+				continue
+			}
+
+			seen[name] = true
+			if _, ok := result[name]; !ok {
+				result[name] = map[string][]Agent{}
+			}
+
+			result[name][detector] = append(result[name][detector], agent)
+		}
+	}
+
+	for detector, offline := range agents {
+		for _, agent := range offline {
+			seen := map[string]bool{}
+			matched := false
+
+			for _, route := range r.Routes {
+				if !route.Matches(detector, agent) {
+					continue
+				}
+
+				matched = true
+				add(route.Notifiers, detector, agent, seen)
+
+				if !route.Continue {
+					break
+				}
+			}
+
+			if !matched {
+				if len(r.Default) == 0 {
+					logrus.WithFields(logrus.Fields{
+						"detector": detector,
+						"agent":    agent.Name,
+					}).Warn("Agent did not match any route and there is no default route")
+				}
+
+				add(r.Default, detector, agent, seen)
+			}
+		}
+	}
+
+	return result
+}
+
+// deliverTo implements partialNotifier by routing agents as usual but only
+// sending them to the specified notifiers
+func (r *Router) deliverTo(kind string, agents map[string][]Agent, names map[string]bool) error {
+	routed := r.route(agents)
+	for name := range routed {
+		if !names[name] {
+			delete(routed, name)
+		}
+	}
+
+	return r.notifiers.deliverEach(kind, routed)
+}
+
+// Notify implements spot.Notifier.Notify by notifying the notifiers that
+// each agent is routed to
+func (r *Router) Notify(agents map[string][]Agent) error {
+	return r.notifiers.deliverEach(deliveryNotify, r.route(agents))
+}
+
+// Remind implements spot.FollowUpNotifier.Remind by reminding the notifiers
+// that each agent is routed to
+func (r *Router) Remind(agents map[string][]Agent) error {
+	return r.notifiers.deliverEach(deliveryRemind, r.route(agents))
+}
+
+// Recover implements spot.FollowUpNotifier.Recover by telling the notifiers
+// that each agent is routed to about recovered agents
+func (r *Router) Recover(agents map[string][]Agent) error {
+	return r.notifiers.deliverEach(deliveryRecover, r.route(agents))
+}
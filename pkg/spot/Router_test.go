@@ -0,0 +1,185 @@
+package spot
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func mockRouter(t *testing.T, routes []string, defaults []string, names ...string) (*Router, map[string]*mockFollowUpNotifier) {
+	notifiers := NewMultiNotifier()
+	mocks := map[string]*mockFollowUpNotifier{}
+	for _, name := range names {
+		mocks[name] = &mockFollowUpNotifier{}
+		require.NoError(t, notifiers.Add(name, mocks[name]))
+	}
+
+	parsed := []*Route{}
+	for _, spec := range routes {
+		route, err := ParseRoute(spec)
+		require.NoError(t, err)
+		parsed = append(parsed, route)
+	}
+
+	sut, err := NewRouter(notifiers, parsed, defaults)
+	require.NoError(t, err)
+
+	return sut, mocks
+}
+
+func TestParseRoute(t *testing.T) {
+	sut, err := ParseRoute("detector=jenkins; agent=^win-;class=Slave$;reason=disconnected;label=docker;label=windows;notify=a, b;continue")
+
+	require.NoError(t, err)
+	require.Equal(t, "jenkins", sut.Detector.String())
+	require.Equal(t, "^win-", sut.Agent.String())
+	require.Equal(t, "Slave$", sut.Class.String())
+	require.Equal(t, "disconnected", sut.Reason.String())
+	require.Equal(t, []string{"docker", "windows"}, sut.Labels)
+	require.Equal(t, []string{"a", "b"}, sut.Notifiers)
+	require.True(t, sut.Continue)
+}
+
+func TestParseRoute_Errors(t *testing.T) {
+	_, err := ParseRoute("agent=foo")
+	require.EqualError(t, err, "Route does not notify anyone: agent=foo")
+
+	_, err = ParseRoute("foo=bar;notify=a")
+	require.EqualError(t, err, "Unknown route key 'foo'")
+
+	_, err = ParseRoute("agent=(;notify=a")
+	require.EqualError(t, err, "Invalid value for route key 'agent': error parsing regexp: missing closing ): `(`")
+
+	_, err = ParseRoute("continue=maybe;notify=a")
+	require.Error(t, err)
+}
+
+func TestRouteMatches(t *testing.T) {
+	route, err := ParseRoute("detector=jenkins;agent=^win-;label=docker;notify=a")
+	require.NoError(t, err)
+
+	require.True(t, route.Matches("[jenkins] foo", Agent{Name: "win-1", Labels: []string{"docker", "windows"}}))
+	require.False(t, route.Matches("[bamboo] foo", Agent{Name: "win-1", Labels: []string{"docker"}}))
+	require.False(t, route.Matches("[jenkins] foo", Agent{Name: "linux-1", Labels: []string{"docker"}}))
+	require.False(t, route.Matches("[jenkins] foo", Agent{Name: "win-1", Labels: []string{"windows"}}))
+}
+
+func TestRouteMatches_Manual(t *testing.T) {
+	route, err := ParseRoute("manual;notify=a")
+	require.NoError(t, err)
+
+	require.True(t, route.Matches("a", Agent{Name: "b", Manual: true}))
+	require.False(t, route.Matches("a", Agent{Name: "b"}))
+
+	route, err = ParseRoute("manual=false;notify=a")
+	require.NoError(t, err)
+
+	require.False(t, route.Matches("a", Agent{Name: "b", Manual: true}))
+	require.True(t, route.Matches("a", Agent{Name: "b"}))
+}
+
+func TestRouteMatches_Degraded(t *testing.T) {
+	route, err := ParseRoute("degraded;notify=a")
+	require.NoError(t, err)
+
+	require.True(t, route.Matches("a", Agent{Name: "b", Degraded: true}))
+	require.False(t, route.Matches("a", Agent{Name: "b"}))
+
+	route, err = ParseRoute("stuck;degraded=false;notify=a")
+	require.NoError(t, err)
+
+	require.True(t, route.Matches("a", Agent{Name: "b", Stuck: true}))
+	require.False(t, route.Matches("a", Agent{Name: "b", Stuck: true, Degraded: true}))
+
+	route, err = ParseRoute("starved;label=windows;notify=a")
+	require.NoError(t, err)
+
+	require.True(t, route.Matches("a", Agent{Name: "queue: windows", Labels: []string{"windows"}, Starved: true}))
+	require.False(t, route.Matches("a", Agent{Name: "win-1", Labels: []string{"windows"}}))
+
+	_, err = ParseRoute("degraded=maybe;notify=a")
+	require.EqualError(t, err, `Invalid value for route key 'degraded': strconv.ParseBool: parsing "maybe": invalid syntax`)
+}
+
+func TestNewRouter_ErrorForUnknownNotifier(t *testing.T) {
+	notifiers := NewMultiNotifier()
+	notifiers.Add("a", &mockNotifier{})
+	route, _ := ParseRoute("notify=a,b")
+
+	_, err := NewRouter(notifiers, []*Route{route}, nil)
+	require.EqualError(t, err, "Route 1 refers to an unknown notifier 'b'")
+
+	_, err = NewRouter(notifiers, nil, []string{"c"})
+	require.EqualError(t, err, "The default route refers to an unknown notifier 'c'")
+}
+
+func TestRouter_FirstMatchWins(t *testing.T) {
+	sut, mocks := mockRouter(t, []string{
+		"agent=^win-;notify=windows",
+		"agent=.*;notify=everything",
+	}, []string{"default"}, "windows", "everything", "default")
+
+	mocks["windows"].On("Notify", map[string][]Agent{"a": agents("win-1")}).Return(nil)
+	mocks["everything"].On("Notify", map[string][]Agent{"a": agents("linux-1")}).Return(nil)
+
+	require.NoError(t, sut.Notify(map[string][]Agent{"a": agents("win-1", "linux-1")}))
+
+	mocks["windows"].AssertExpectations(t)
+	mocks["everything"].AssertExpectations(t)
+	mocks["default"].AssertNotCalled(t, "Notify", mock.Anything)
+}
+
+func TestRouter_ContinueSendsToLaterRoutes(t *testing.T) {
+	sut, mocks := mockRouter(t, []string{
+		"agent=^win-;notify=windows;continue",
+		"agent=.*;notify=everything,windows",
+	}, nil, "windows", "everything")
+
+	mocks["windows"].On("Notify", map[string][]Agent{"a": agents("win-1", "linux-1")}).Return(nil)
+	mocks["everything"].On("Notify", map[string][]Agent{"a": agents("win-1", "linux-1")}).Return(nil)
+
+	require.NoError(t, sut.Notify(map[string][]Agent{"a": agents("win-1", "linux-1")}))
+
+	mocks["windows"].AssertExpectations(t)
+	mocks["everything"].AssertExpectations(t)
+}
+
+func TestRouter_UnmatchedAgentsGoToDefault(t *testing.T) {
+	sut, mocks := mockRouter(t, []string{
+		"detector=jenkins;notify=jenkins",
+	}, []string{"default"}, "jenkins", "default")
+
+	mocks["jenkins"].On("Notify", map[string][]Agent{"[jenkins] a": agents("b")}).Return(nil)
+	mocks["default"].On("Notify", map[string][]Agent{"[bamboo] c": agents("d")}).Return(nil)
+
+	require.NoError(t, sut.Notify(map[string][]Agent{"[jenkins] a": agents("b"), "[bamboo] c": agents("d")}))
+
+	mocks["jenkins"].AssertExpectations(t)
+	mocks["default"].AssertExpectations(t)
+}
+
+func TestRouter_UnmatchedAgentsDroppedWithoutDefault(t *testing.T) {
+	sut, mocks := mockRouter(t, []string{"detector=jenkins;notify=jenkins"}, nil, "jenkins")
+
+	require.NoError(t, sut.Notify(map[string][]Agent{"[bamboo] c": agents("d")}))
+
+	mocks["jenkins"].AssertNotCalled(t, "Notify", mock.Anything)
+}
+
+func TestRouter_RoutesFollowUps(t *testing.T) {
+	sut, mocks := mockRouter(t, []string{
+		"reason=maintenance;notify=quiet",
+	}, []string{"loud"}, "quiet", "loud")
+
+	reminder := map[string][]Agent{"a": {{Name: "b", Reason: "maintenance"}, {Name: "c"}}}
+	mocks["quiet"].On("Remind", map[string][]Agent{"a": {{Name: "b", Reason: "maintenance"}}}).Return(nil)
+	mocks["loud"].On("Remind", map[string][]Agent{"a": agents("c")}).Return(nil)
+	mocks["loud"].On("Recover", map[string][]Agent{"a": agents("c")}).Return(nil)
+
+	require.NoError(t, sut.Remind(reminder))
+	require.NoError(t, sut.Recover(map[string][]Agent{"a": agents("c")}))
+
+	mocks["quiet"].AssertExpectations(t)
+	mocks["loud"].AssertExpectations(t)
+}
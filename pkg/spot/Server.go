@@ -0,0 +1,315 @@
+package spot
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+)
+
+// Server exposes the state of a Watchdog over HTTP so that offline agents
+// can be inspected, acknowledged and silenced at runtime. A read-only
+// dashboard is served at the root, Prometheus metrics at /metrics and
+// health checks at /healthz and /readyz.
+type Server struct {
+	// StaleAfter is how long the watchdog may go without completing a cycle
+	// before it is reported as unhealthy. Staleness is not checked if it is
+	// zero.
+	StaleAfter time.Duration
+
+	// Token is the bearer token that requests which acknowledge agents or
+	// manage silences must present. The API is read-only if it is empty.
+	Token string
+
+	watchdog *Watchdog
+	mux      *http.ServeMux
+	started  time.Time
+}
+
+// NewServer constructs a Server for the specified watchdog
+func NewServer(watchdog *Watchdog) *Server {
+	s := &Server{
+		watchdog: watchdog,
+		mux:      http.NewServeMux(),
+		started:  time.Now(),
+	}
+
+	s.mux.HandleFunc("/", s.handleDashboard)
+	s.mux.Handle("/metrics", promhttp.Handler())
+	s.mux.HandleFunc("/healthz", s.handleHealthz)
+	s.mux.HandleFunc("/readyz", s.handleReadyz)
+	s.mux.HandleFunc("/api/agents", s.handleAgents)
+	s.mux.HandleFunc("/api/acknowledge", s.handleAcknowledge)
+	s.mux.HandleFunc("/api/silences", s.handleSilences)
+	s.mux.HandleFunc("/api/silences/", s.handleSilence)
+
+	return s
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+type agentView struct {
+	Detector     string     `json:"detector"`
+	Name         string     `json:"name"`
+	Reason       string     `json:"reason,omitempty"`
+	Class        string     `json:"class,omitempty"`
+	Labels       []string   `json:"labels,omitempty"`
+	Manual       bool       `json:"manual"`
+	Severity     string     `json:"severity,omitempty"`
+	Degraded     bool       `json:"degraded"`
+	Stuck        bool       `json:"stuck"`
+	Starved      bool       `json:"starved"`
+	Remediation  string     `json:"remediation,omitempty"`
+	Tags         []string   `json:"tags,omitempty"`
+	Since        time.Time  `json:"since"`
+	Notified     bool       `json:"notified"`
+	LastNotified *time.Time `json:"lastNotified,omitempty"`
+	Acknowledged bool       `json:"acknowledged"`
+	SilencedBy   string     `json:"silencedBy,omitempty"`
+}
+
+// Details returns the reason of the agent followed by its remediation
+func (v agentView) Details() string {
+	return Agent{Reason: v.Reason, Remediation: v.Remediation}.Details()
+}
+
+type silenceView struct {
+	ID      string     `json:"id"`
+	Spec    string     `json:"spec"`
+	Start   *time.Time `json:"start,omitempty"`
+	End     *time.Time `json:"end,omitempty"`
+	Comment string     `json:"comment,omitempty"`
+	Active  bool       `json:"active"`
+}
+
+type acknowledgeRequest struct {
+	Detector string `json:"detector"`
+	Agent    string `json:"agent"`
+}
+
+type silenceRequest struct {
+	Spec string `json:"spec"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+func newSilenceView(silence *Silence, now time.Time) silenceView {
+	return silenceView{
+		ID:      silence.ID,
+		Spec:    silence.Spec,
+		Start:   optionalTime(silence.Start),
+		End:     optionalTime(silence.End),
+		Comment: silence.Comment,
+		Active:  silence.Active(now),
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		logrus.WithError(err).Warn("Failed to write response")
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	writeJSON(w, status, errorResponse{Error: fmt.Sprintf(format, args...)})
+}
+
+// allowMethods writes an error and returns false if the request method is
+// not one of the specified methods
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, "Method %s is not allowed", r.Method)
+	return false
+}
+
+// authorize writes an error and returns false if the request does not
+// present the bearer token that is required to change state
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) bool {
+	if s.Token == "" {
+		writeError(w, http.StatusForbidden, "The API is read-only, configure an API token to change state")
+		return false
+	}
+
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, "A valid bearer token is required to change state")
+		return false
+	}
+
+	return true
+}
+
+// agents returns every offline agent sorted by detector and name
+func (s *Server) agents() []agentView {
+	result := []agentView{}
+
+	for detector, offline := range s.watchdog.Offline() {
+		for _, agent := range offline {
+			view := agentView{
+				Detector:     detector,
+				Name:         agent.Name,
+				Reason:       agent.Reason,
+				Class:        agent.Class,
+				Labels:       agent.Labels,
+				Manual:       agent.Manual,
+				Severity:     agent.Severity,
+				Degraded:     agent.Degraded,
+				Stuck:        agent.Stuck,
+				Starved:      agent.Starved,
+				Remediation:  agent.Remediation,
+				Tags:         agent.Tags(),
+				Since:        agent.Since,
+				Notified:     agent.Notified,
+				LastNotified: optionalTime(agent.LastNotified),
+				Acknowledged: agent.Acknowledged,
+			}
+
+			if s.watchdog.Silences != nil {
+				if silence := s.watchdog.Silences.Silenced(detector, agent.Agent); silence != nil {
+					view.SilencedBy = silence.ID
+				}
+			}
+
+			result = append(result, view)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Detector != result[j].Detector {
+			return result[i].Detector < result[j].Detector
+		}
+
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
+func (s *Server) handleAgents(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, "GET") {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.agents())
+}
+
+func (s *Server) handleAcknowledge(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, "POST") || !s.authorize(w, r) {
+		return
+	}
+
+	request := acknowledgeRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request: %s", err.Error())
+		return
+	}
+
+	if !s.watchdog.Acknowledge(request.Detector, request.Agent) {
+		writeError(w, http.StatusNotFound, "Agent '%s' of detector '%s' is not offline", request.Agent, request.Detector)
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{"detector": request.Detector, "agent": request.Agent}).Info("Agent acknowledged")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) silencer(w http.ResponseWriter) *Silencer {
+	if s.watchdog.Silences == nil {
+		writeError(w, http.StatusNotFound, "Silences are not enabled")
+	}
+
+	return s.watchdog.Silences
+}
+
+func (s *Server) handleSilences(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, "GET", "POST") {
+		return
+	}
+
+	silencer := s.silencer(w)
+	if silencer == nil {
+		return
+	}
+
+	now := time.Now()
+
+	if r.Method == "GET" {
+		result := []silenceView{}
+		for _, silence := range silencer.List() {
+			result = append(result, newSilenceView(silence, now))
+		}
+
+		writeJSON(w, http.StatusOK, result)
+		return
+	}
+
+	if !s.authorize(w, r) {
+		return
+	}
+
+	request := silenceRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request: %s", err.Error())
+		return
+	}
+
+	silence, err := ParseSilence(request.Spec)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "%s", err.Error())
+		return
+	}
+
+	silencer.Add(silence)
+	logrus.WithFields(logrus.Fields{"silence": silence.ID, "spec": silence.Spec}).Info("Silence created")
+
+	writeJSON(w, http.StatusCreated, newSilenceView(silence, now))
+}
+
+func (s *Server) handleSilence(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, "DELETE") || !s.authorize(w, r) {
+		return
+	}
+
+	silencer := s.silencer(w)
+	if silencer == nil {
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/silences/")
+	if !silencer.Remove(id) {
+		writeError(w, http.StatusNotFound, "Silence '%s' does not exist", id)
+		return
+	}
+
+	logrus.WithField("silence", id).Info("Silence expired")
+	w.WriteHeader(http.StatusNoContent)
+}
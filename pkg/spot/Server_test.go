@@ -0,0 +1,162 @@
+package spot
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func mockServer(offline []Agent) (*Watchdog, *Server) {
+	_, _, watchdog := setup(offline, nil)
+	watchdog.RunChecks()
+
+	server := NewServer(watchdog)
+	server.Token = "secret"
+	return watchdog, server
+}
+
+func request(sut http.Handler, method, url, body string) *httptest.ResponseRecorder {
+	return requestWithToken(sut, "secret", method, url, body)
+}
+
+func requestWithToken(sut http.Handler, token, method, url, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, url, bytes.NewBufferString(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	recorder := httptest.NewRecorder()
+	sut.ServeHTTP(recorder, req)
+
+	return recorder
+}
+
+func TestServer_ListsOfflineAgents(t *testing.T) {
+	_, sut := mockServer([]Agent{{Name: "c", Reason: "disconnected"}, {Name: "b"}})
+
+	resp := request(sut, "GET", "/api/agents", "")
+	require.Equal(t, 200, resp.Code)
+	require.Equal(t, "application/json", resp.Header().Get("Content-Type"))
+
+	result := []agentView{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	require.Len(t, result, 2)
+	require.Equal(t, "[MockDetector] a", result[0].Detector)
+	require.Equal(t, "b", result[0].Name)
+	require.Equal(t, "c", result[1].Name)
+	require.Equal(t, "disconnected", result[1].Reason)
+	require.True(t, result[1].Notified)
+	require.False(t, result[1].Since.IsZero())
+}
+
+func TestServer_AcknowledgesAgents(t *testing.T) {
+	watchdog, sut := mockServer(agents("b"))
+
+	resp := request(sut, "POST", "/api/acknowledge", `{"detector": "[MockDetector] a", "agent": "b"}`)
+	require.Equal(t, 204, resp.Code)
+	require.True(t, watchdog.Offline()["[MockDetector] a"][0].Acknowledged)
+
+	resp = request(sut, "POST", "/api/acknowledge", `{"detector": "[MockDetector] a", "agent": "c"}`)
+	require.Equal(t, 404, resp.Code)
+	require.JSONEq(t, `{"error": "Agent 'c' of detector '[MockDetector] a' is not offline"}`, resp.Body.String())
+
+	resp = request(sut, "POST", "/api/acknowledge", `not json`)
+	require.Equal(t, 400, resp.Code)
+}
+
+func TestServer_CreatesListsAndExpiresSilences(t *testing.T) {
+	_, sut := mockServer(agents("win-1"))
+
+	resp := request(sut, "POST", "/api/silences", `{"spec": "agent=win-*;for=1h;comment=Patching"}`)
+	require.Equal(t, 201, resp.Code)
+
+	created := silenceView{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	require.NotEmpty(t, created.ID)
+	require.Equal(t, "Patching", created.Comment)
+	require.True(t, created.Active)
+	require.NotNil(t, created.End)
+
+	resp = request(sut, "GET", "/api/silences", "")
+	listed := []silenceView{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&listed))
+	require.Len(t, listed, 1)
+	require.Equal(t, created.ID, listed[0].ID)
+
+	resp = request(sut, "GET", "/api/agents", "")
+	offline := []agentView{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&offline))
+	require.Equal(t, created.ID, offline[0].SilencedBy)
+
+	resp = request(sut, "DELETE", "/api/silences/"+created.ID, "")
+	require.Equal(t, 204, resp.Code)
+
+	resp = request(sut, "DELETE", "/api/silences/"+created.ID, "")
+	require.Equal(t, 404, resp.Code)
+}
+
+func TestServer_RejectsInvalidSilences(t *testing.T) {
+	_, sut := mockServer(agents())
+
+	resp := request(sut, "POST", "/api/silences", `{"spec": "foo=bar"}`)
+
+	require.Equal(t, 400, resp.Code)
+	require.JSONEq(t, `{"error": "Unknown silence key 'foo'"}`, resp.Body.String())
+}
+
+func TestServer_RequiresTokenToChangeState(t *testing.T) {
+	watchdog, sut := mockServer(agents("b"))
+
+	for _, token := range []string{"", "wrong"} {
+		resp := requestWithToken(sut, token, "POST", "/api/acknowledge", `{"detector": "[MockDetector] a", "agent": "b"}`)
+		require.Equal(t, 401, resp.Code)
+		require.Equal(t, "Bearer", resp.Header().Get("WWW-Authenticate"))
+
+		resp = requestWithToken(sut, token, "POST", "/api/silences", `{"spec": "agent=b;for=1h"}`)
+		require.Equal(t, 401, resp.Code)
+
+		resp = requestWithToken(sut, token, "DELETE", "/api/silences/1", "")
+		require.Equal(t, 401, resp.Code)
+	}
+
+	require.False(t, watchdog.Offline()["[MockDetector] a"][0].Acknowledged)
+	require.Empty(t, watchdog.Silences.List())
+
+	resp := requestWithToken(sut, "", "GET", "/api/silences", "")
+	require.Equal(t, 200, resp.Code)
+}
+
+func TestServer_ReadOnlyWithoutToken(t *testing.T) {
+	_, sut := mockServer(agents("b"))
+	sut.Token = ""
+
+	resp := request(sut, "POST", "/api/silences", `{"spec": "agent=b;for=1h"}`)
+	require.Equal(t, 403, resp.Code)
+	require.JSONEq(t, `{"error": "The API is read-only, configure an API token to change state"}`, resp.Body.String())
+
+	resp = request(sut, "GET", "/api/agents", "")
+	require.Equal(t, 200, resp.Code)
+}
+
+func TestServer_RejectsSilencesForEverything(t *testing.T) {
+	_, sut := mockServer(agents())
+
+	resp := request(sut, "POST", "/api/silences", `{"spec": ""}`)
+	require.Equal(t, 400, resp.Code)
+
+	resp = request(sut, "POST", "/api/silences", `{"spec": "agent=*"}`)
+	require.Equal(t, 400, resp.Code)
+}
+
+func TestServer_RejectsWrongMethod(t *testing.T) {
+	_, sut := mockServer(agents())
+
+	resp := request(sut, "DELETE", "/api/agents", "")
+
+	require.Equal(t, 405, resp.Code)
+	require.Equal(t, "GET", resp.Header().Get("Allow"))
+}
@@ -0,0 +1,377 @@
+package spot
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/sirupsen/logrus"
+)
+
+var silenceScheduleParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// Silence suppresses notifications about agents that match all of its
+// configured matchers while it is active. Matchers that are not set match
+// every agent, but ParseSilence requires at least one.
+type Silence struct {
+	// ID uniquely identifies the silence once it has been added to a Silencer
+	ID string
+	// Spec is the string the silence was parsed from, if any
+	Spec string
+	// Source identifies where the silence came from, e.g. a config file.
+	// Silences added at runtime have no source.
+	Source string
+
+	Detector *regexp.Regexp
+	// Agent is a glob pattern matched against the agent's name
+	Agent      string
+	AgentRegex *regexp.Regexp
+	// Labels must all be assigned to an agent for it to match
+	Labels []string
+
+	// Start and End bound when the silence is active. Zero values are
+	// unbounded.
+	Start time.Time
+	End   time.Time
+	// For, if set, is how long the silence lasts from when it is added to a
+	// Silencer, which sets End
+	For time.Duration
+
+	// Schedule, if set, makes the silence recur. Each time the schedule
+	// fires the silence is active for Duration.
+	Schedule cron.Schedule
+	Duration time.Duration
+
+	Comment string
+}
+
+// ParseSilence parses a silence from a string of semicolon separated
+// key=value pairs. The following keys are supported:
+//
+// detector, agentregex: regular expressions matched against the detector
+// name and the agent's name
+//
+// agent: a glob pattern matched against the agent's name, e.g. win-*
+//
+// label: a label that must be assigned to the agent. May be repeated.
+//
+// start, end: RFC3339 timestamps bounding when the silence is active
+//
+// for: how long the silence lasts from when it is added, e.g. 2h. Sets end
+// and cannot be combined with start.
+//
+// cron: a standard five field cron expression for recurring windows, which
+// may be prefixed with CRON_TZ=<zone>
+//
+// duration: how long each recurring window lasts
+//
+// comment: a note about why the silence exists
+//
+// A silence needs at least one of detector, agent, agentregex or label, and
+// must end, last for a while or recur, so that a silence cannot mute every
+// agent forever.
+//
+// For example: agent=win-*;cron=0 2 * * 2;duration=4h;comment=Patch Tuesday
+func ParseSilence(spec string) (*Silence, error) {
+	result := &Silence{Spec: spec}
+
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		kv := strings.SplitN(part, "=", 2)
+		key := strings.ToLower(strings.TrimSpace(kv[0]))
+		value := ""
+		if len(kv) == 2 {
+			value = strings.TrimSpace(kv[1])
+		}
+
+		var err error
+		switch key {
+		case "detector":
+			result.Detector, err = regexp.Compile(value)
+		case "agent":
+			result.Agent = value
+			_, err = path.Match(value, "")
+		case "agentregex":
+			result.AgentRegex, err = regexp.Compile(value)
+		case "label":
+			result.Labels = append(result.Labels, value)
+		case "start":
+			result.Start, err = time.Parse(time.RFC3339, value)
+		case "end":
+			result.End, err = time.Parse(time.RFC3339, value)
+		case "for":
+			result.For, err = time.ParseDuration(value)
+		case "cron":
+			result.Schedule, err = silenceScheduleParser.Parse(value)
+		case "duration":
+			result.Duration, err = time.ParseDuration(value)
+		case "comment":
+			result.Comment = value
+		default:
+			return nil, fmt.Errorf("Unknown silence key '%s'", key)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("Invalid value for silence key '%s': %s", key, err.Error())
+		}
+	}
+
+	if result.Detector == nil && result.Agent == "" && result.AgentRegex == nil && len(result.Labels) == 0 {
+		return nil, fmt.Errorf("Silence needs a detector, agent, agentregex or label: %s", spec)
+	}
+
+	if result.End.IsZero() && result.For <= 0 && result.Schedule == nil {
+		return nil, fmt.Errorf("Silence needs an end, for or cron and duration: %s", spec)
+	}
+
+	if result.Schedule != nil && result.Duration <= 0 {
+		return nil, fmt.Errorf("Recurring silence needs a duration: %s", spec)
+	}
+
+	if result.For != 0 && (!result.Start.IsZero() || !result.End.IsZero()) {
+		return nil, fmt.Errorf("Silence cannot combine for with start or end: %s", spec)
+	}
+
+	if !result.Start.IsZero() && !result.End.IsZero() && !result.End.After(result.Start) {
+		return nil, fmt.Errorf("Silence ends before it starts: %s", spec)
+	}
+
+	return result, nil
+}
+
+// Active returns true if the silence suppresses notifications at the
+// specified time
+func (s *Silence) Active(now time.Time) bool {
+	if !s.Start.IsZero() && now.Before(s.Start) {
+		return false
+	}
+
+	if s.Expired(now) {
+		return false
+	}
+
+	if s.Schedule != nil {
+		// The window is open if the schedule fired within the last Duration
+		return !s.Schedule.Next(now.Add(-s.Duration)).After(now)
+	}
+
+	return true
+}
+
+// Expired returns true if the silence will never be active again
+func (s *Silence) Expired(now time.Time) bool {
+	return !s.End.IsZero() && !now.Before(s.End)
+}
+
+// Matches returns true if an agent reported by the specified detector
+// matches every matcher of the silence
+func (s *Silence) Matches(detector string, agent Agent) bool {
+	if s.Detector != nil && !s.Detector.MatchString(detector) {
+		return false
+	}
+
+	if s.Agent != "" {
+		if matched, _ := path.Match(s.Agent, agent.Name); !matched {
+			return false
+		}
+	}
+
+	if s.AgentRegex != nil && !s.AgentRegex.MatchString(agent.Name) {
+		return false
+	}
+
+	for _, label := range s.Labels {
+		if !hasLabel(agent, label) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Silencer holds the silences that are used to suppress notifications.
+// Silenced agents are still tracked so that agents which are offline when
+// a silence ends are reported then.
+type Silencer struct {
+	lock     sync.Mutex
+	silences []*Silence
+	lastID   int
+	now      func() time.Time
+}
+
+// NewSilencer constructs a Silencer without any silences
+func NewSilencer() *Silencer {
+	return &Silencer{
+		silences: []*Silence{},
+		now:      time.Now,
+	}
+}
+
+// Add adds a silence, assigning it an ID if it does not have one, and
+// returns its ID
+func (s *Silencer) Add(silence *Silence) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.assignID(silence)
+	s.silences = append(s.silences, silence)
+	return silence.ID
+}
+
+// assignID gives a silence the next ID if it does not have one and ends it
+// For after now. The caller must hold the lock.
+func (s *Silencer) assignID(silence *Silence) {
+	if silence.ID == "" {
+		s.lastID++
+		silence.ID = strconv.Itoa(s.lastID)
+	}
+
+	if silence.For > 0 && silence.End.IsZero() {
+		silence.End = s.now().Add(silence.For)
+	}
+}
+
+// Replace replaces every silence from source with the specified silences.
+// Silences whose spec did not change are kept as they were so that their
+// IDs and end times are preserved.
+func (s *Silencer) Replace(source string, silences []*Silence) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	previous := map[string]*Silence{}
+	result := []*Silence{}
+
+	for _, silence := range s.silences {
+		if silence.Source == source {
+			previous[silence.Spec] = silence
+		} else {
+			result = append(result, silence)
+		}
+	}
+
+	for _, silence := range silences {
+		if kept, ok := previous[silence.Spec]; ok {
+			delete(previous, silence.Spec)
+			result = append(result, kept)
+			continue
+		}
+
+		silence.Source = source
+		s.assignID(silence)
+		result = append(result, silence)
+	}
+
+	s.silences = result
+}
+
+// Remove removes the silence with the specified ID, returning false if
+// there is no such silence
+func (s *Silencer) Remove(id string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for i, silence := range s.silences {
+		if silence.ID == id {
+			s.silences = append(s.silences[:i], s.silences[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// prune removes silences that have expired. The caller must hold the lock.
+func (s *Silencer) prune(now time.Time) {
+	result := s.silences[:0]
+	for _, silence := range s.silences {
+		if !silence.Expired(now) {
+			result = append(result, silence)
+		}
+	}
+
+	s.silences = result
+}
+
+// List returns the silences that have not expired
+func (s *Silencer) List() []*Silence {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.prune(s.now())
+	return append([]*Silence{}, s.silences...)
+}
+
+// Silenced returns the first active silence that matches an agent reported
+// by the specified detector, or nil if it is not silenced
+func (s *Silencer) Silenced(detector string, agent Agent) *Silence {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.silenced(s.now(), detector, agent)
+}
+
+func (s *Silencer) silenced(now time.Time, detector string, agent Agent) *Silence {
+	for _, silence := range s.silences {
+		if silence.Active(now) && silence.Matches(detector, agent) {
+			return silence
+		}
+	}
+
+	return nil
+}
+
+// filter removes silenced agents from the offline agents and reminders of
+// a set of changes and returns them. Recoveries are never silenced since
+// they are only sent for agents that were reported.
+func (s *Silencer) filter(changes *Changes) *Changes {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.now()
+	s.prune(now)
+
+	silenced := &Changes{
+		Offline:   map[string][]Agent{},
+		Reminders: map[string][]Agent{},
+		Recovered: map[string][]Agent{},
+	}
+
+	split := func(agents map[string][]Agent, into map[string][]Agent) {
+		for detector, offline := range agents {
+			kept := []Agent{}
+			for _, agent := range offline {
+				if silence := s.silenced(now, detector, agent); silence != nil {
+					logrus.WithFields(logrus.Fields{
+						"detector": detector,
+						"agent":    agent.Name,
+						"silence":  silence.ID,
+					}).Info("Agent is silenced")
+
+					into[detector] = append(into[detector], agent)
+				} else {
+					kept = append(kept, agent)
+				}
+			}
+
+			if len(kept) > 0 {
+				agents[detector] = kept
+			} else {
+				delete(agents, detector)
+			}
+		}
+	}
+
+	split(changes.Offline, silenced.Offline)
+	split(changes.Reminders, silenced.Reminders)
+
+	return silenced
+}
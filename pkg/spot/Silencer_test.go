@@ -0,0 +1,182 @@
+package spot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func mustParseSilence(t *testing.T, spec string) *Silence {
+	result, err := ParseSilence(spec)
+	require.NoError(t, err)
+
+	return result
+}
+
+func TestParseSilence(t *testing.T) {
+	sut := mustParseSilence(t, "detector=jenkins; agent=win-*;agentregex=\\d+$;label=windows;start=2020-01-01T00:00:00Z;end=2020-02-01T00:00:00Z;comment=Upgrades")
+
+	require.Equal(t, "jenkins", sut.Detector.String())
+	require.Equal(t, "win-*", sut.Agent)
+	require.Equal(t, "\\d+$", sut.AgentRegex.String())
+	require.Equal(t, []string{"windows"}, sut.Labels)
+	require.Equal(t, time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), sut.Start)
+	require.Equal(t, time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC), sut.End)
+	require.Equal(t, "Upgrades", sut.Comment)
+	require.Nil(t, sut.Schedule)
+}
+
+func TestParseSilence_Errors(t *testing.T) {
+	_, err := ParseSilence("foo=bar")
+	require.EqualError(t, err, "Unknown silence key 'foo'")
+
+	_, err = ParseSilence("agent=[")
+	require.EqualError(t, err, "Invalid value for silence key 'agent': syntax error in pattern")
+
+	_, err = ParseSilence("start=tomorrow")
+	require.Error(t, err)
+
+	_, err = ParseSilence("agent=*;cron=0 2 * * 2")
+	require.EqualError(t, err, "Recurring silence needs a duration: agent=*;cron=0 2 * * 2")
+
+	_, err = ParseSilence("cron=every tuesday;duration=1h")
+	require.Error(t, err)
+
+	_, err = ParseSilence("agent=*;start=2020-01-01T00:00:00Z;for=1h")
+	require.EqualError(t, err, "Silence cannot combine for with start or end: agent=*;start=2020-01-01T00:00:00Z;for=1h")
+
+	_, err = ParseSilence("agent=*;start=2020-02-01T00:00:00Z;end=2020-01-01T00:00:00Z")
+	require.EqualError(t, err, "Silence ends before it starts: agent=*;start=2020-02-01T00:00:00Z;end=2020-01-01T00:00:00Z")
+
+	_, err = ParseSilence("")
+	require.EqualError(t, err, "Silence needs a detector, agent, agentregex or label: ")
+
+	_, err = ParseSilence("comment=Everything;for=1h")
+	require.EqualError(t, err, "Silence needs a detector, agent, agentregex or label: comment=Everything;for=1h")
+
+	_, err = ParseSilence("agent=win-*")
+	require.EqualError(t, err, "Silence needs an end, for or cron and duration: agent=win-*")
+}
+
+func TestSilenceActive_TimeRange(t *testing.T) {
+	sut := mustParseSilence(t, "agent=*;start=2020-01-01T00:00:00Z;end=2020-01-02T00:00:00Z")
+
+	require.False(t, sut.Active(time.Date(2019, 12, 31, 23, 59, 0, 0, time.UTC)))
+	require.True(t, sut.Active(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)))
+	require.False(t, sut.Active(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)))
+	require.True(t, sut.Expired(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)))
+}
+
+func TestSilenceActive_Recurring(t *testing.T) {
+	// Tuesdays from 02:00 to 06:00 UTC
+	sut := mustParseSilence(t, "agent=*;cron=CRON_TZ=UTC 0 2 * * 2;duration=4h")
+
+	tuesday := time.Date(2020, 1, 7, 0, 0, 0, 0, time.UTC)
+
+	require.False(t, sut.Active(tuesday.Add(time.Hour)))
+	require.True(t, sut.Active(tuesday.Add(2*time.Hour)))
+	require.True(t, sut.Active(tuesday.Add(5*time.Hour)))
+	require.False(t, sut.Active(tuesday.Add(6*time.Hour)))
+	require.False(t, sut.Active(tuesday.Add(24*time.Hour+3*time.Hour)))
+	require.True(t, sut.Active(tuesday.Add(7*24*time.Hour+3*time.Hour)))
+	require.False(t, sut.Expired(tuesday.Add(365*24*time.Hour)))
+}
+
+func TestSilenceMatches(t *testing.T) {
+	sut := mustParseSilence(t, "detector=jenkins;agent=win-*;label=windows;for=1h")
+
+	require.True(t, sut.Matches("[jenkins] foo", Agent{Name: "win-1", Labels: []string{"windows"}}))
+	require.False(t, sut.Matches("[bamboo] foo", Agent{Name: "win-1", Labels: []string{"windows"}}))
+	require.False(t, sut.Matches("[jenkins] foo", Agent{Name: "linux-1", Labels: []string{"windows"}}))
+	require.False(t, sut.Matches("[jenkins] foo", Agent{Name: "win-1"}))
+
+	require.True(t, (&Silence{}).Matches("a", Agent{Name: "b"}))
+}
+
+func TestSilencer_AddRemoveList(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	sut := NewSilencer()
+	sut.now = func() time.Time { return now }
+
+	first := sut.Add(mustParseSilence(t, "agent=a;end=2999-01-01T00:00:00Z"))
+	second := sut.Add(mustParseSilence(t, "agent=b;end=2020-01-02T00:00:00Z"))
+
+	require.NotEqual(t, first, second)
+	require.Len(t, sut.List(), 2)
+
+	now = now.Add(48 * time.Hour)
+	require.Len(t, sut.List(), 1)
+
+	require.True(t, sut.Remove(first))
+	require.False(t, sut.Remove(first))
+	require.Empty(t, sut.List())
+}
+
+func TestSilencer_ForEndsRelativeToWhenAdded(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	sut := NewSilencer()
+	sut.now = func() time.Time { return now }
+
+	silence := mustParseSilence(t, "agent=a;for=2h")
+	require.Equal(t, 2*time.Hour, silence.For)
+	require.True(t, silence.End.IsZero())
+
+	sut.Add(silence)
+	require.Equal(t, now.Add(2*time.Hour), silence.End)
+
+	now = now.Add(time.Hour)
+	require.NotNil(t, sut.Silenced("d", Agent{Name: "a"}))
+
+	now = now.Add(time.Hour)
+	require.Nil(t, sut.Silenced("d", Agent{Name: "a"}))
+	require.Empty(t, sut.List())
+}
+
+func TestSilencer_Silenced(t *testing.T) {
+	sut := NewSilencer()
+	id := sut.Add(mustParseSilence(t, "agent=win-*;end=2999-01-01T00:00:00Z"))
+	sut.Add(mustParseSilence(t, "agent=linux-*;start=2999-01-01T00:00:00Z;end=3000-01-01T00:00:00Z"))
+
+	require.Equal(t, id, sut.Silenced("a", Agent{Name: "win-1"}).ID)
+	require.Nil(t, sut.Silenced("a", Agent{Name: "linux-1"}))
+}
+
+func TestSilencer_ReplaceKeepsUnchangedSilences(t *testing.T) {
+	sut := NewSilencer()
+	runtime := sut.Add(mustParseSilence(t, "agent=mac-*;end=2999-01-01T00:00:00Z"))
+	sut.Replace("config", []*Silence{mustParseSilence(t, "agent=win-*;for=1h"), mustParseSilence(t, "agent=linux-*;end=2999-01-01T00:00:00Z")})
+
+	kept := sut.List()[1]
+	require.Equal(t, "config", kept.Source)
+
+	sut.Replace("config", []*Silence{mustParseSilence(t, "agent=win-*;for=1h"), mustParseSilence(t, "agent=bsd-*;end=2999-01-01T00:00:00Z")})
+
+	result := sut.List()
+	require.Len(t, result, 3)
+	require.Equal(t, runtime, result[0].ID)
+	require.True(t, kept == result[1])
+	require.Equal(t, "agent=bsd-*;end=2999-01-01T00:00:00Z", result[2].Spec)
+	require.Equal(t, "4", result[2].ID)
+}
+
+func TestSilencer_FilterRemovesSilencedAgents(t *testing.T) {
+	sut := NewSilencer()
+	sut.Add(mustParseSilence(t, "agent=win-*;end=2999-01-01T00:00:00Z"))
+
+	changes := &Changes{
+		Offline:   map[string][]Agent{"a": agents("win-1", "linux-1"), "b": agents("win-2")},
+		Reminders: map[string][]Agent{"a": agents("win-3")},
+		Recovered: map[string][]Agent{"a": agents("win-4")},
+	}
+
+	silenced := sut.filter(changes)
+
+	require.Equal(t, map[string][]Agent{"a": agents("linux-1")}, changes.Offline)
+	require.Empty(t, changes.Reminders)
+	require.Equal(t, map[string][]Agent{"a": agents("win-4")}, changes.Recovered)
+
+	require.Equal(t, map[string][]Agent{"a": agents("win-1"), "b": agents("win-2")}, silenced.Offline)
+	require.Equal(t, map[string][]Agent{"a": agents("win-3")}, silenced.Reminders)
+	require.Empty(t, silenced.Recovered)
+}
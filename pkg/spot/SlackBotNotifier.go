@@ -0,0 +1,458 @@
+package spot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultSlackAPIEndpoint is the base URL of the Slack Web API
+	DefaultSlackAPIEndpoint = "https://slack.com/api"
+
+	slackMaxBlocks     = 50
+	slackMaxTextLength = 3000
+
+	slackOfflineHeader    = ":warning: *One or more build agents are offline!*"
+	slackReminderHeader   = ":hourglass: *These build agents are still offline*"
+	slackRecoveredHeader  = ":white_check_mark: *These build agents are back online*"
+	slackResolvedHeader   = ":white_check_mark: *All build agents from this alert are back online*"
+	slackMovedHeader      = ":arrow_right: *These build agents were reported again in a newer alert*"
+	slackSupersededHeader = ":arrow_right: *All build agents from this alert were reported again in a newer alert*"
+)
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackBlock struct {
+	Type     string      `json:"type"`
+	Text     *slackText  `json:"text,omitempty"`
+	Elements []slackText `json:"elements,omitempty"`
+}
+
+type slackMessage struct {
+	Channel  string       `json:"channel"`
+	Text     string       `json:"text"`
+	Blocks   []slackBlock `json:"blocks,omitempty"`
+	ThreadTS string       `json:"thread_ts,omitempty"`
+	TS       string       `json:"ts,omitempty"`
+	Username string       `json:"username,omitempty"`
+}
+
+type slackAPIResponse struct {
+	OK      bool   `json:"ok"`
+	Error   string `json:"error"`
+	Channel string `json:"channel"`
+	TS      string `json:"ts"`
+}
+
+// slackThread tracks an alert that was posted to slack so that follow-ups
+// can be posted as replies and the alert can be resolved once all of its
+// agents have recovered
+type slackThread struct {
+	channel     string
+	ts          string
+	blocks      []slackBlock
+	outstanding map[string]bool
+	resolved    bool
+}
+
+// SlackBotNotifier is a FollowUpNotifier that posts to slack using the
+// chat.postMessage Web API with a bot token. Reminders and recoveries are
+// posted as replies to the original alert, and the original alert is
+// updated once all of its agents are back online.
+type SlackBotNotifier struct {
+	Endpoint string
+	Token    string
+	Channel  string
+
+	api             *http.Client
+	log             *logrus.Entry
+	messageTemplate *template.Template
+
+	lock    sync.Mutex
+	threads map[string]*slackThread
+}
+
+// NewSlackBotNotifier creates an instance of spot.SlackBotNotifier that
+// posts to the specified channel using a bot token. The message template
+// is used to render the plain-text fallback of each message.
+func NewSlackBotNotifier(token, channel, templatePath string) (*SlackBotNotifier, error) {
+	if token == "" {
+		return nil, fmt.Errorf("Cannot create a notifier without a bot token")
+	}
+
+	if channel == "" {
+		return nil, fmt.Errorf("Cannot create a notifier without a channel")
+	}
+
+	t, err := loadMessageTemplate(templatePath, defaultMessageTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SlackBotNotifier{
+		Endpoint:        DefaultSlackAPIEndpoint,
+		Token:           token,
+		Channel:         channel,
+		api:             &http.Client{},
+		log:             logrus.WithFields(logrus.Fields{"type": "slack-bot", "channel": channel}),
+		messageTemplate: t,
+		threads:         map[string]*slackThread{},
+	}, nil
+}
+
+func agentKey(system string, agent Agent) string {
+	return fmt.Sprintf("%s/%s", system, agent.Name)
+}
+
+func sortedSystems(agents map[string][]Agent) []string {
+	systems := make([]string, 0, len(agents))
+	for system := range agents {
+		systems = append(systems, system)
+	}
+
+	sort.Strings(systems)
+	return systems
+}
+
+// tagged returns the name of the agent followed by its tags in brackets
+func tagged(agent Agent) string {
+	result := agent.Name
+	for _, tag := range agent.Tags() {
+		result = fmt.Sprintf("%s [%s]", result, tag)
+	}
+
+	return result
+}
+
+// truncate shortens s to at most length bytes without splitting a rune,
+// marking it with an ellipsis if anything was removed
+func truncate(s string, length int) string {
+	if len(s) <= length {
+		return s
+	}
+
+	end := length - 3
+	for end > 0 && !utf8.RuneStart(s[end]) {
+		end--
+	}
+
+	return s[:end] + "..."
+}
+
+func slackSection(text string) slackBlock {
+	return slackBlock{
+		Type: "section",
+		Text: &slackText{Type: "mrkdwn", Text: truncate(text, slackMaxTextLength)},
+	}
+}
+
+func slackContext(text string) slackBlock {
+	return slackBlock{
+		Type:     "context",
+		Elements: []slackText{{Type: "mrkdwn", Text: truncate(text, slackMaxTextLength)}},
+	}
+}
+
+// buildBlocks lays out a header followed by a section for each detector.
+// Detectors with agents that reported a reason get a context block listing
+// the reasons underneath their section.
+func buildBlocks(header string, agents map[string][]Agent) []slackBlock {
+	blocks := []slackBlock{slackSection(header)}
+
+	systems := sortedSystems(agents)
+	for i, system := range systems {
+		if len(blocks)+2 >= slackMaxBlocks {
+			blocks = append(blocks, slackContext(fmt.Sprintf("...and %d more detectors", len(systems)-i)))
+			break
+		}
+
+		lines := []string{fmt.Sprintf("*%s*", system)}
+		reasons := []string{}
+		for _, agent := range agents[system] {
+			lines = append(lines, fmt.Sprintf("• %s", tagged(agent)))
+			if details := agent.Details(); details != "" {
+				reasons = append(reasons, fmt.Sprintf("*%s*: %s", agent.Name, details))
+			}
+		}
+
+		blocks = append(blocks, slackSection(strings.Join(lines, "\n")))
+		if len(reasons) > 0 {
+			blocks = append(blocks, slackContext(strings.Join(reasons, "\n")))
+		}
+	}
+
+	return blocks
+}
+
+func (s *SlackBotNotifier) call(method string, message *slackMessage) (*slackAPIResponse, error) {
+	buff := &bytes.Buffer{}
+	if err := json.NewEncoder(buff).Encode(message); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/%s", strings.TrimSuffix(s.Endpoint, "/"), method), buff)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", s.Token))
+
+	resp, err := s.api.Do(req)
+	if err != nil {
+		return nil, &RetryableError{Err: err}
+	}
+
+	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return nil, err
+	}
+
+	result := &slackAPIResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return nil, err
+	}
+
+	if !result.OK {
+		err := fmt.Errorf("Failed to notify: %s", result.Error)
+		if result.Error == "ratelimited" {
+			return nil, &RetryableError{
+				Err:        err,
+				RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+			}
+		}
+
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (s *SlackBotNotifier) post(header, text string, agents map[string][]Agent, threadTS string) (*slackAPIResponse, []slackBlock, error) {
+	blocks := buildBlocks(header, agents)
+
+	resp, err := s.call("chat.postMessage", &slackMessage{
+		Channel:  s.Channel,
+		Text:     text,
+		Blocks:   blocks,
+		ThreadTS: threadTS,
+		Username: "spot",
+	})
+
+	return resp, blocks, err
+}
+
+// Notify implements spot.Notifier.Notify by posting a new alert to the
+// channel and remembering it so that follow-ups can be threaded
+func (s *SlackBotNotifier) Notify(agents map[string][]Agent) error {
+	if s.api == nil {
+		return fmt.Errorf("Use spot.NewSlackBotNotifier(...) to construct a SlackBotNotifier")
+	}
+
+	if len(agents) == 0 {
+		s.log.Debug("No agents are offline, not sending a notification")
+		return nil
+	}
+
+	s.log.WithField("offlineCount", len(agents)).Debug("Sending Notification")
+	resp, blocks, err := s.post(slackOfflineHeader, buildMessage(s.messageTemplate, agents), agents, "")
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	thread := &slackThread{
+		channel:     resp.Channel,
+		ts:          resp.TS,
+		blocks:      blocks,
+		outstanding: map[string]bool{},
+	}
+
+	moved, order := s.groupByThread(agents)
+	for system, offline := range agents {
+		for _, agent := range offline {
+			key := agentKey(system, agent)
+			if previous, ok := s.threads[key]; ok {
+				delete(previous.outstanding, key)
+			}
+
+			thread.outstanding[key] = true
+			s.threads[key] = thread
+		}
+	}
+
+	// The new alert is delivered even if the previous ones cannot be
+	// followed up on, so failures are only logged
+	for _, previous := range order {
+		if previous == nil {
+			continue
+		}
+
+		l := s.log.WithField("thread", previous.ts)
+		if _, _, err := s.post(slackMovedHeader, "These build agents were reported again in a newer alert", moved[previous], previous.ts); err != nil {
+			l.WithError(err).Warn("Failed to reply to the previous alert")
+		}
+
+		if len(previous.outstanding) == 0 && !previous.resolved {
+			if err := s.resolve(previous, slackSupersededHeader, "All build agents from this alert were reported again in a newer alert"); err != nil {
+				l.WithError(err).Warn("Failed to resolve the previous alert")
+			}
+		}
+	}
+
+	return nil
+}
+
+// groupByThread splits agents by the alert they were originally reported
+// in. Agents that were never reported are grouped under a nil thread.
+func (s *SlackBotNotifier) groupByThread(agents map[string][]Agent) (map[*slackThread]map[string][]Agent, []*slackThread) {
+	groups := map[*slackThread]map[string][]Agent{}
+	order := []*slackThread{}
+
+	for _, system := range sortedSystems(agents) {
+		for _, agent := range agents[system] {
+			thread := s.threads[agentKey(system, agent)]
+			if _, ok := groups[thread]; !ok {
+				groups[thread] = map[string][]Agent{}
+				order = append(order, thread)
+			}
+
+			groups[thread][system] = append(groups[thread][system], agent)
+		}
+	}
+
+	return groups, order
+}
+
+// Remind implements spot.FollowUpNotifier.Remind by replying to the alert
+// that each agent was originally reported in
+func (s *SlackBotNotifier) Remind(agents map[string][]Agent) error {
+	if s.api == nil {
+		return fmt.Errorf("Use spot.NewSlackBotNotifier(...) to construct a SlackBotNotifier")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	groups, order := s.groupByThread(agents)
+	for _, thread := range order {
+		threadTS := ""
+		if thread != nil {
+			threadTS = thread.ts
+		}
+
+		s.log.WithField("thread", threadTS).Debug("Sending Reminder")
+		if _, _, err := s.post(slackReminderHeader, "These build agents are still offline", groups[thread], threadTS); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Recover implements spot.FollowUpNotifier.Recover by replying to the alert
+// that each agent was originally reported in. Once every agent in an alert
+// has recovered, the alert itself is updated to say so.
+//
+// Agents are only forgotten once every reply has been posted. If Recover
+// is retried after a failure, agents that were already reported as
+// recovered in their thread are skipped rather than posted unthreaded.
+func (s *SlackBotNotifier) Recover(agents map[string][]Agent) error {
+	if s.api == nil {
+		return fmt.Errorf("Use spot.NewSlackBotNotifier(...) to construct a SlackBotNotifier")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	recovered := []string{}
+	groups, order := s.groupByThread(agents)
+	for _, thread := range order {
+		pending := groups[thread]
+		threadTS := ""
+		if thread != nil {
+			threadTS = thread.ts
+			pending = thread.pending(groups[thread])
+		}
+
+		if len(pending) > 0 {
+			s.log.WithField("thread", threadTS).Debug("Sending Recovery Notification")
+			if _, _, err := s.post(slackRecoveredHeader, "These build agents are back online", pending, threadTS); err != nil {
+				return err
+			}
+		}
+
+		if thread == nil {
+			continue
+		}
+
+		for system, agents := range groups[thread] {
+			for _, agent := range agents {
+				key := agentKey(system, agent)
+				delete(thread.outstanding, key)
+				recovered = append(recovered, key)
+			}
+		}
+
+		if len(thread.outstanding) == 0 && !thread.resolved {
+			if err := s.resolve(thread, slackResolvedHeader, "All build agents from this alert are back online"); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, key := range recovered {
+		delete(s.threads, key)
+	}
+
+	return nil
+}
+
+// pending returns the agents that are still outstanding in the thread
+func (t *slackThread) pending(agents map[string][]Agent) map[string][]Agent {
+	result := map[string][]Agent{}
+	for system, offline := range agents {
+		for _, agent := range offline {
+			if t.outstanding[agentKey(system, agent)] {
+				result[system] = append(result[system], agent)
+			}
+		}
+	}
+
+	return result
+}
+
+// resolve updates the original alert to replace its header, e.g. to show
+// that all agents are back online
+func (s *SlackBotNotifier) resolve(thread *slackThread, header, text string) error {
+	blocks := append([]slackBlock{slackSection(header)}, thread.blocks[1:]...)
+
+	s.log.WithField("thread", thread.ts).Debug("Resolving alert")
+	_, err := s.call("chat.update", &slackMessage{
+		Channel: thread.channel,
+		Text:    text,
+		Blocks:  blocks,
+		TS:      thread.ts,
+	})
+
+	if err == nil {
+		thread.resolved = true
+	}
+
+	return err
+}
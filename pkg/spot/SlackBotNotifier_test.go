@@ -0,0 +1,215 @@
+package spot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type mockSlackAPIServer struct {
+	server   *httptest.Server
+	messages map[string][]*slackMessage
+	// failures is how many calls of each method fail before they succeed
+	failures map[string]int
+	teardown func()
+}
+
+func mockSlackAPI() (*mockSlackAPIServer, *SlackBotNotifier) {
+	m := http.NewServeMux()
+	s := httptest.NewServer(m)
+	n, _ := NewSlackBotNotifier("xoxb-token", "#builds", "")
+	n.Endpoint = s.URL
+
+	result := &mockSlackAPIServer{
+		server:   s,
+		messages: map[string][]*slackMessage{},
+		failures: map[string]int{},
+		teardown: func() {
+			s.Close()
+		},
+	}
+
+	for _, method := range []string{"chat.postMessage", "chat.update"} {
+		method := method
+		m.HandleFunc(fmt.Sprintf("/%s", method), func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer xoxb-token" {
+				io.WriteString(w, `{"ok":false,"error":"not_authed"}`)
+				return
+			}
+
+			if result.failures[method] > 0 {
+				result.failures[method]--
+				io.WriteString(w, `{"ok":false,"error":"internal_error"}`)
+				return
+			}
+
+			msg := &slackMessage{}
+			if err := json.NewDecoder(r.Body).Decode(msg); err != nil {
+				http.Error(w, err.Error(), 400)
+				return
+			}
+
+			result.messages[method] = append(result.messages[method], msg)
+			ts := msg.TS
+			if ts == "" {
+				ts = fmt.Sprintf("1000.%d", len(result.messages[method]))
+			}
+
+			io.WriteString(w, fmt.Sprintf(`{"ok":true,"channel":"C123","ts":"%s"}`, ts))
+		})
+	}
+
+	return result, n
+}
+
+func TestNewSlackBotNotifier_ErrorForEmptyToken(t *testing.T) {
+	sut, err := NewSlackBotNotifier("", "#builds", "")
+
+	require.Nil(t, sut)
+	require.EqualError(t, err, "Cannot create a notifier without a bot token")
+}
+
+func TestNewSlackBotNotifier_ErrorForEmptyChannel(t *testing.T) {
+	sut, err := NewSlackBotNotifier("xoxb-token", "", "")
+
+	require.Nil(t, sut)
+	require.EqualError(t, err, "Cannot create a notifier without a channel")
+}
+
+func TestSlackBotNotifier_ErrorForNilClient(t *testing.T) {
+	sut := &SlackBotNotifier{}
+
+	require.EqualError(t, sut.Notify(map[string][]Agent{"a": agents("b")}), "Use spot.NewSlackBotNotifier(...) to construct a SlackBotNotifier")
+	require.EqualError(t, sut.Remind(map[string][]Agent{"a": agents("b")}), "Use spot.NewSlackBotNotifier(...) to construct a SlackBotNotifier")
+	require.EqualError(t, sut.Recover(map[string][]Agent{"a": agents("b")}), "Use spot.NewSlackBotNotifier(...) to construct a SlackBotNotifier")
+}
+
+func TestSlackBotNotifier_APIError(t *testing.T) {
+	slack, sut := mockSlackAPI()
+	defer slack.teardown()
+
+	sut.Token = "wrong"
+	err := sut.Notify(map[string][]Agent{"a": agents("b")})
+
+	require.EqualError(t, err, "Failed to notify: not_authed")
+}
+
+func TestSlackBotNotifier_NotifyUsesBlocks(t *testing.T) {
+	slack, sut := mockSlackAPI()
+	defer slack.teardown()
+
+	err := sut.Notify(map[string][]Agent{
+		"d": agents("e"),
+		"a": {{Name: "b", Reason: "disconnected"}, {Name: "c"}},
+	})
+
+	require.NoError(t, err)
+	require.Len(t, slack.messages["chat.postMessage"], 1)
+
+	msg := slack.messages["chat.postMessage"][0]
+	require.Equal(t, "#builds", msg.Channel)
+	require.Empty(t, msg.ThreadTS)
+	require.Equal(t, ":warning: One or more build agents are offline! :warning:\n* a\n    * b (disconnected)\n    * c\n* d\n    * e", msg.Text)
+	require.Equal(t, []slackBlock{
+		slackSection(slackOfflineHeader),
+		slackSection("*a*\n• b\n• c"),
+		slackContext("*b*: disconnected"),
+		slackSection("*d*\n• e"),
+	}, msg.Blocks)
+}
+
+func TestSlackBotNotifier_LimitsBlocks(t *testing.T) {
+	offline := map[string][]Agent{}
+	for i := 0; i < 60; i++ {
+		offline[fmt.Sprintf("detector-%02d", i)] = agents("b")
+	}
+
+	blocks := buildBlocks(slackOfflineHeader, offline)
+
+	require.Len(t, blocks, 49)
+	require.Equal(t, slackContext("...and 13 more detectors"), blocks[48])
+}
+
+func TestSlackBotNotifier_RemindRepliesInThread(t *testing.T) {
+	slack, sut := mockSlackAPI()
+	defer slack.teardown()
+
+	require.NoError(t, sut.Notify(map[string][]Agent{"a": agents("b", "c")}))
+	require.NoError(t, sut.Remind(map[string][]Agent{"a": agents("b"), "d": agents("e")}))
+
+	posts := slack.messages["chat.postMessage"]
+	require.Len(t, posts, 3)
+	require.Equal(t, "1000.1", posts[1].ThreadTS)
+	require.Equal(t, []slackBlock{slackSection(slackReminderHeader), slackSection("*a*\n• b")}, posts[1].Blocks)
+	require.Empty(t, posts[2].ThreadTS, "Agents that were never reported should not be threaded")
+	require.Equal(t, []slackBlock{slackSection(slackReminderHeader), slackSection("*d*\n• e")}, posts[2].Blocks)
+}
+
+func TestSlackBotNotifier_RecoverRepliesInThreadAndResolves(t *testing.T) {
+	slack, sut := mockSlackAPI()
+	defer slack.teardown()
+
+	require.NoError(t, sut.Notify(map[string][]Agent{"a": agents("b", "c")}))
+
+	require.NoError(t, sut.Recover(map[string][]Agent{"a": agents("b")}))
+	require.Len(t, slack.messages["chat.postMessage"], 2)
+	require.Equal(t, "1000.1", slack.messages["chat.postMessage"][1].ThreadTS)
+	require.Empty(t, slack.messages["chat.update"], "Alert should not be resolved until all agents recover")
+
+	require.NoError(t, sut.Recover(map[string][]Agent{"a": agents("c")}))
+	require.Len(t, slack.messages["chat.postMessage"], 3)
+	require.Equal(t, "1000.1", slack.messages["chat.postMessage"][2].ThreadTS)
+
+	require.Len(t, slack.messages["chat.update"], 1)
+	update := slack.messages["chat.update"][0]
+	require.Equal(t, "C123", update.Channel)
+	require.Equal(t, "1000.1", update.TS)
+	require.Equal(t, []slackBlock{slackSection(slackResolvedHeader), slackSection("*a*\n• b\n• c")}, update.Blocks)
+	require.Empty(t, sut.threads)
+}
+
+func TestSlackBotNotifier_RecoverRetryStaysThreaded(t *testing.T) {
+	slack, sut := mockSlackAPI()
+	defer slack.teardown()
+
+	require.NoError(t, sut.Notify(map[string][]Agent{"a": agents("b")}))
+	require.NoError(t, sut.Notify(map[string][]Agent{"d": agents("e")}))
+
+	recovered := map[string][]Agent{"a": agents("b"), "d": agents("e")}
+	slack.failures["chat.update"] = 1
+	require.Error(t, sut.Recover(recovered))
+	require.NoError(t, sut.Recover(recovered))
+
+	posts := slack.messages["chat.postMessage"]
+	require.Len(t, posts, 4, "Agents already reported as recovered should not be posted again")
+	require.Equal(t, "1000.1", posts[2].ThreadTS)
+	require.Equal(t, "1000.2", posts[3].ThreadTS)
+	require.Len(t, slack.messages["chat.update"], 2)
+	require.Empty(t, sut.threads)
+}
+
+func TestSlackBotNotifier_NotifyAgainFollowsUpOnPreviousAlert(t *testing.T) {
+	slack, sut := mockSlackAPI()
+	defer slack.teardown()
+
+	require.NoError(t, sut.Notify(map[string][]Agent{"a": agents("b", "c")}))
+	require.NoError(t, sut.Notify(map[string][]Agent{"a": agents("b")}))
+	require.Empty(t, slack.messages["chat.update"], "Alert should not be resolved while c is outstanding")
+
+	require.NoError(t, sut.Notify(map[string][]Agent{"a": agents("c")}))
+
+	posts := slack.messages["chat.postMessage"]
+	require.Len(t, posts, 5)
+	require.Equal(t, "1000.1", posts[2].ThreadTS)
+	require.Equal(t, []slackBlock{slackSection(slackMovedHeader), slackSection("*a*\n• b")}, posts[2].Blocks)
+	require.Equal(t, "1000.1", posts[4].ThreadTS)
+
+	require.Len(t, slack.messages["chat.update"], 1)
+	require.Equal(t, "1000.1", slack.messages["chat.update"][0].TS)
+	require.Equal(t, slackSection(slackSupersededHeader), slack.messages["chat.update"][0].Blocks[0])
+}
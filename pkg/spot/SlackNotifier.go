@@ -19,7 +19,7 @@ const defaultMessageTemplate = `
 {{- range $system,$agents := . }}
 * {{ $system }}
     {{- range $agent := $agents }}
-    * {{ $agent }}
+    * {{ $agent }}{{ range $agent.Tags }} [{{ . }}]{{ end }}{{ with $agent.Details }} ({{ . }}){{ end }}
     {{- end }}
 {{- end }}
 `
@@ -39,26 +39,28 @@ type SlackNotifier struct {
 	messageTemplate *template.Template
 }
 
-// NewSlackNotifier creates an instance of spot.SlackNotifier for
-// a given webhook endpoint
-func NewSlackNotifier(endpoint, templatePath string) (*SlackNotifier, error) {
-	if endpoint == "" {
-		return nil, fmt.Errorf("Cannot create a notifier for an empty endpoint")
-	}
-
+// loadMessageTemplate parses the template at templatePath, falling back to
+// defaultTemplate if no path is provided
+func loadMessageTemplate(templatePath, defaultTemplate string) (*template.Template, error) {
 	if _, err := os.Stat(templatePath); templatePath != "" && os.IsNotExist(err) {
 		return nil, fmt.Errorf("Could not locate the message template at '%s'", templatePath)
 	}
 
-	var t *template.Template
-	var err error
-
 	if templatePath != "" {
-		t, err = template.ParseFiles(templatePath)
-	} else {
-		t, err = template.New("message").Parse(strings.TrimSpace(defaultMessageTemplate))
+		return template.ParseFiles(templatePath)
 	}
 
+	return template.New("message").Parse(strings.TrimSpace(defaultTemplate))
+}
+
+// NewSlackNotifier creates an instance of spot.SlackNotifier for
+// a given webhook endpoint
+func NewSlackNotifier(endpoint, templatePath string) (*SlackNotifier, error) {
+	if endpoint == "" {
+		return nil, fmt.Errorf("Cannot create a notifier for an empty endpoint")
+	}
+
+	t, err := loadMessageTemplate(templatePath, defaultMessageTemplate)
 	if err != nil {
 		return nil, err
 	}
@@ -75,10 +77,10 @@ func NewSlackNotifier(endpoint, templatePath string) (*SlackNotifier, error) {
 	}, nil
 }
 
-func (s *SlackNotifier) buildMessage(agents map[string][]string) string {
+func buildMessage(t *template.Template, agents map[string][]Agent) string {
 	buff := &bytes.Buffer{}
 
-	if err := s.messageTemplate.Execute(buff, agents); err != nil {
+	if err := t.Execute(buff, agents); err != nil {
 		panic(err)
 	} else {
 		return buff.String()
@@ -87,7 +89,7 @@ func (s *SlackNotifier) buildMessage(agents map[string][]string) string {
 
 // Notify implements spot.Notifier.Notify by posting a message
 // to a slack-compatible webhook
-func (s *SlackNotifier) Notify(agents map[string][]string) error {
+func (s *SlackNotifier) Notify(agents map[string][]Agent) error {
 	if s.api == nil {
 		return fmt.Errorf("Use spot.NewSlackNotifier(...) to construct a SlackNotifier")
 	}
@@ -99,7 +101,7 @@ func (s *SlackNotifier) Notify(agents map[string][]string) error {
 
 	s.log.WithField("offlineCount", len(agents)).Debug("Sending Notification")
 	payload := &slackPayload{
-		Text:     s.buildMessage(agents),
+		Text:     buildMessage(s.messageTemplate, agents),
 		Username: "spot",
 		IconURL:  "",
 	}
@@ -111,13 +113,9 @@ func (s *SlackNotifier) Notify(agents map[string][]string) error {
 
 	resp, err := s.api.Post(s.Endpoint, "application/json", buff)
 	if err != nil {
-		return err
+		return &RetryableError{Err: err}
 	}
 	resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("Failed to notify: %s", resp.Status)
-	}
-
-	return nil
+	return checkResponse(resp)
 }
@@ -37,12 +37,36 @@ func TestNew_UsesDefaultTemplate(t *testing.T) {
 	sut, _ := NewSlackNotifier("http://endpoint", "")
 	buff := &bytes.Buffer{}
 
-	err := sut.messageTemplate.Execute(buff, map[string][]string{"a": {"b", "c"}})
+	err := sut.messageTemplate.Execute(buff, map[string][]Agent{"a": {{Name: "b"}, {Name: "c"}}})
 
 	require.NoError(t, err)
 	require.Equal(t, ":warning: One or more build agents are offline! :warning:\n* a\n    * b\n    * c", buff.String())
 }
 
+func TestNew_DefaultTemplateShowsReasons(t *testing.T) {
+	sut, _ := NewSlackNotifier("http://endpoint", "")
+	buff := &bytes.Buffer{}
+
+	err := sut.messageTemplate.Execute(buff, map[string][]Agent{"a": {{Name: "b", Reason: "Taken offline by alice: patching"}, {Name: "c"}}})
+
+	require.NoError(t, err)
+	require.Equal(t, ":warning: One or more build agents are offline! :warning:\n* a\n    * b (Taken offline by alice: patching)\n    * c", buff.String())
+}
+
+func TestNew_DefaultTemplateShowsCategoriesAndRemediation(t *testing.T) {
+	sut, _ := NewSlackNotifier("http://endpoint", "")
+	buff := &bytes.Buffer{}
+
+	err := sut.messageTemplate.Execute(buff, map[string][]Agent{"a": {
+		{Name: "b", Reason: "Connection was broken", Remediation: "Reconnect attempt 1 of 3 requested"},
+		{Name: "c", Reason: "Low disk space", Degraded: true},
+		{Name: "d", Reason: "Marked temporarily offline", Manual: true, Severity: SeverityWarning},
+	}})
+
+	require.NoError(t, err)
+	require.Equal(t, ":warning: One or more build agents are offline! :warning:\n* a\n    * b (Connection was broken - Reconnect attempt 1 of 3 requested)\n    * c [degraded] (Low disk space)\n    * d [manual] [warning] (Marked temporarily offline)", buff.String())
+}
+
 func TestNew_CanUseCustomTemplate(t *testing.T) {
 	tpl, err := ioutil.TempFile("", "template")
 	require.NoError(t, err)
@@ -57,7 +81,7 @@ func TestNew_CanUseCustomTemplate(t *testing.T) {
 	sut, err := NewSlackNotifier("http://endpoint", tpl.Name())
 	require.NoError(t, err)
 
-	err = sut.messageTemplate.Execute(buff, map[string][]string{"a": {"b", "c"}})
+	err = sut.messageTemplate.Execute(buff, map[string][]Agent{"a": {{Name: "b"}, {Name: "c"}}})
 
 	require.NoError(t, err)
 	require.Equal(t, "foo", buff.String())
@@ -108,7 +132,7 @@ func TestNew_StripsTrailingSlash(t *testing.T) {
 func TestNotify_ErrorForNilClient(t *testing.T) {
 	sut := &SlackNotifier{}
 
-	err := sut.Notify(map[string][]string{"a": {"b,c"}, "d": {"e", "f"}})
+	err := sut.Notify(map[string][]Agent{"a": {{Name: "b,c"}}, "d": {{Name: "e"}, {Name: "f"}}})
 
 	require.EqualError(t, err, "Use spot.NewSlackNotifier(...) to construct a SlackNotifier")
 }
@@ -122,7 +146,7 @@ func TestNotify_NoAgents(t *testing.T) {
 		w.WriteHeader(http.StatusOK)
 	})
 
-	err := sut.Notify(map[string][]string{})
+	err := sut.Notify(map[string][]Agent{})
 
 	require.NoError(t, err)
 	require.False(t, called, "Expected no API calls to be made")
@@ -138,9 +162,9 @@ func TestNotify_HttpErrorFailure(t *testing.T) {
 	})
 
 	sut.Endpoint = "thisisnotaprotocol://foo"
-	err := sut.Notify(map[string][]string{"a": {"b,c"}, "d": {"e", "f"}})
+	err := sut.Notify(map[string][]Agent{"a": {{Name: "b,c"}}, "d": {{Name: "e"}, {Name: "f"}}})
 
-	require.EqualError(t, err, "Post thisisnotaprotocol://foo: unsupported protocol scheme \"thisisnotaprotocol\"")
+	require.EqualError(t, err, `Post "thisisnotaprotocol://foo": unsupported protocol scheme "thisisnotaprotocol"`)
 	require.False(t, called, "Expected no API calls to be made")
 }
 
@@ -153,7 +177,7 @@ func TestNotify_NonSuccessResponse(t *testing.T) {
 		w.WriteHeader(http.StatusBadRequest)
 	})
 
-	err := sut.Notify(map[string][]string{"a": {"b,c"}, "d": {"e", "f"}})
+	err := sut.Notify(map[string][]Agent{"a": {{Name: "b,c"}}, "d": {{Name: "e"}, {Name: "f"}}})
 
 	require.EqualError(t, err, "Failed to notify: 400 Bad Request")
 	require.True(t, called, "Expected an API call to be made")
@@ -176,7 +200,7 @@ func TestNotify(t *testing.T) {
 		w.WriteHeader(http.StatusOK)
 	})
 
-	err := sut.Notify(map[string][]string{"a": {"b,c"}, "d": {"e", "f"}})
+	err := sut.Notify(map[string][]Agent{"a": {{Name: "b,c"}}, "d": {{Name: "e"}, {Name: "f"}}})
 
 	require.NoError(t, err)
 	require.NotNil(t, payload)
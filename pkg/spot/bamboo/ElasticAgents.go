@@ -0,0 +1,122 @@
+package bamboo
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hylandsoftware/spot/pkg/spot"
+)
+
+const (
+	elasticInstanceAPICall = "rest/api/latest/elasticInstances"
+
+	// DefaultMaxStartTime is how long an elastic instance may take to start
+	// and register its agent if MaxStartTime is not set
+	DefaultMaxStartTime = 15 * time.Minute
+)
+
+// startingStates are the states of elastic instances that are still being
+// started
+var startingStates = []string{"PENDING", "STARTING"}
+
+// failedStates are the states of elastic instances that failed to start
+var failedStates = []string{"FAILED", "FAILED_TO_START"}
+
+type elasticInstance struct {
+	InstanceID        string `json:"instanceId"`
+	ConfigurationName string `json:"configurationName"`
+	State             string `json:"state"`
+	// StartTime is when the instance was requested in milliseconds since the
+	// epoch
+	StartTime int64 `json:"startTime"`
+	// AgentID is the id of the agent running on the instance, or zero if it
+	// has not registered yet
+	AgentID int64 `json:"agentId"`
+}
+
+// description names the instance along with its configuration, if known
+func (e *elasticInstance) description() string {
+	if e.ConfigurationName == "" {
+		return "Elastic instance"
+	}
+
+	return fmt.Sprintf("Elastic instance of %s", e.ConfigurationName)
+}
+
+// ElasticAgents controls how agents that bamboo starts on elastic
+// instances, e.g. on EC2, are reported. Bamboo starts and terminates these
+// instances on demand, so their agents are not reported when they are
+// offline. The instances are reported instead if they failed to start or
+// their agent did not register in time.
+type ElasticAgents struct {
+	// MaxStartTime is how long an instance may take to start and register
+	// its agent. DefaultMaxStartTime is used if it is zero.
+	MaxStartTime time.Duration
+}
+
+func (e *ElasticAgents) maxStartTime() time.Duration {
+	if e.MaxStartTime <= 0 {
+		return DefaultMaxStartTime
+	}
+
+	return e.MaxStartTime
+}
+
+// problem describes what is wrong with an instance at the time now, if
+// anything
+func (e *ElasticAgents) problem(instance *elasticInstance, now time.Time) string {
+	state := strings.ToUpper(instance.State)
+	if contains(failedStates, state) {
+		return fmt.Sprintf("%s failed to start", instance.description())
+	}
+
+	if instance.StartTime <= 0 {
+		return ""
+	}
+
+	running := now.Sub(time.Unix(0, instance.StartTime*int64(time.Millisecond))).Round(time.Second)
+	if running <= e.maxStartTime() {
+		return ""
+	}
+
+	if contains(startingStates, state) {
+		return fmt.Sprintf("%s has been starting for %s, above %s", instance.description(), running, e.maxStartTime())
+	}
+
+	if state == "RUNNING" && instance.AgentID == 0 {
+		return fmt.Sprintf("%s has been running for %s but its agent never registered", instance.description(), running)
+	}
+
+	return ""
+}
+
+// instances returns the elastic instances that failed to start or whose
+// agent did not register in time as agents named after the instance
+func (e *ElasticAgents) instances(instances []elasticInstance, now time.Time) []spot.Agent {
+	result := []spot.Agent{}
+	for _, instance := range instances {
+		problem := e.problem(&instance, now)
+		if problem == "" {
+			continue
+		}
+
+		result = append(result, spot.Agent{
+			Name:   fmt.Sprintf("elastic: %s", instance.InstanceID),
+			Reason: problem,
+			Class:  AgentTypeElastic,
+		})
+	}
+
+	return result
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,59 @@
+package bamboo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hylandsoftware/spot/pkg/spot"
+	"github.com/stretchr/testify/require"
+)
+
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func TestElasticAgentsProblem(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	sut := &ElasticAgents{MaxStartTime: 10 * time.Minute}
+
+	tests := []struct {
+		instance elasticInstance
+		expected string
+	}{
+		{elasticInstance{State: "FAILED_TO_START", ConfigurationName: "windows"}, "Elastic instance of windows failed to start"},
+		{elasticInstance{State: "failed"}, "Elastic instance failed to start"},
+		{elasticInstance{State: "STARTING", StartTime: millis(now.Add(-5 * time.Minute))}, ""},
+		{elasticInstance{State: "PENDING", StartTime: millis(now.Add(-20 * time.Minute))}, "Elastic instance has been starting for 20m0s, above 10m0s"},
+		{elasticInstance{State: "RUNNING", StartTime: millis(now.Add(-5 * time.Minute))}, ""},
+		{elasticInstance{State: "RUNNING", StartTime: millis(now.Add(-time.Hour))}, "Elastic instance has been running for 1h0m0s but its agent never registered"},
+		{elasticInstance{State: "RUNNING", StartTime: millis(now.Add(-time.Hour)), AgentID: 7}, ""},
+		{elasticInstance{State: "SHUTTING_DOWN", StartTime: millis(now.Add(-time.Hour))}, ""},
+		{elasticInstance{State: "STARTING"}, ""},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expected, sut.problem(&test.instance, now), test.instance)
+	}
+}
+
+func TestElasticAgentsProblem_DefaultMaxStartTime(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	sut := &ElasticAgents{}
+
+	require.Empty(t, sut.problem(&elasticInstance{State: "STARTING", StartTime: millis(now.Add(-DefaultMaxStartTime))}, now))
+	require.NotEmpty(t, sut.problem(&elasticInstance{State: "STARTING", StartTime: millis(now.Add(-DefaultMaxStartTime - time.Minute))}, now))
+}
+
+func TestElasticAgentsInstances(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	sut := &ElasticAgents{}
+
+	result := sut.instances([]elasticInstance{
+		{InstanceID: "i-1", State: "RUNNING", StartTime: millis(now.Add(-time.Hour)), AgentID: 1},
+		{InstanceID: "i-2", State: "FAILED_TO_START", ConfigurationName: "linux"},
+	}, now)
+
+	require.Equal(t, []spot.Agent{
+		{Name: "elastic: i-2", Reason: "Elastic instance of linux failed to start", Class: AgentTypeElastic},
+	}, result)
+}
@@ -5,14 +5,46 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/hylandsoftware/spot/pkg/spot"
+	"github.com/hylandsoftware/spot/pkg/spot/redact"
 	"github.com/sirupsen/logrus"
 )
 
 const (
 	bambooAgentAPICall = "rest/api/latest/agent"
+
+	// requestTimeout is how long a request may take before it fails so that
+	// an unresponsive bamboo cannot stall the watchdog
+	requestTimeout = 30 * time.Second
+)
+
+const (
+	// AgentTypeLocal is the type of agents that run on the bamboo server
+	AgentTypeLocal = "LOCAL"
+	// AgentTypeRemote is the type of agents that run on their own machine
+	AgentTypeRemote = "REMOTE"
+	// AgentTypeElastic is the type of agents that bamboo starts on demand
+	AgentTypeElastic = "ELASTIC"
+)
+
+const (
+	// DisabledReport reports disabled agents that are offline as taken
+	// offline manually. This is the default.
+	DisabledReport = "report"
+	// DisabledDowngrade reports disabled agents that are offline as taken
+	// offline manually with spot.SeverityWarning
+	DisabledDowngrade = "downgrade"
+	// DisabledIgnore does not report disabled agents
+	DisabledIgnore = "ignore"
 )
 
+// AgentTypes returns the types of agents bamboo reports
+func AgentTypes() []string {
+	return []string{AgentTypeLocal, AgentTypeRemote, AgentTypeElastic}
+}
+
 type bambooAgent struct {
 	ID      int64
 	Name    string
@@ -22,6 +54,21 @@ type bambooAgent struct {
 	Busy    bool
 }
 
+// reason describes why the agent is offline, including its type, e.g.
+// "Remote agent is disabled"
+func (a *bambooAgent) reason() string {
+	kind := "Agent"
+	if a.Type != "" {
+		kind = strings.ToUpper(a.Type[:1]) + strings.ToLower(a.Type[1:]) + " agent"
+	}
+
+	if !a.Enabled {
+		return kind + " is disabled"
+	}
+
+	return kind + " is offline"
+}
+
 // OfflineAgentDetector is a spot.OfflineAgentDetector for watching
 // Bamboo agents. If a Username and password are provided, API requests
 // will use HTTP Basic authentication with the provided credentials.
@@ -30,8 +77,23 @@ type OfflineAgentDetector struct {
 	Username    string
 	Password    string
 
+	// Types limits which agent types are considered, e.g. AgentTypeRemote.
+	// Every type is considered if it is empty.
+	Types []string
+
+	// Disabled controls how agents that an admin disabled are reported. It
+	// is one of DisabledReport, DisabledDowngrade or DisabledIgnore. Agents
+	// are reported if it is empty.
+	Disabled string
+
+	// Elastic, if set, does not report elastic agents that are offline but
+	// reports elastic instances that failed to start or whose agent did not
+	// register in time
+	Elastic *ElasticAgents
+
 	api *http.Client
 	log *logrus.Entry
+	now func() time.Time
 }
 
 // NewDetectorFromArg parses a configuration string into a
@@ -56,7 +118,7 @@ func NewDetectorFromArg(arg string) (*OfflineAgentDetector, error) {
 	case 3:
 		return NewDetector(parts[0], parts[1], parts[2]), nil
 	default:
-		return nil, fmt.Errorf("The format of the config string was not recognized: %s", arg)
+		return nil, fmt.Errorf("The format of the config string for %s was not recognized, expected <url> or <url>,<username>,<password>", redact.String(parts[0]))
 	}
 }
 
@@ -71,7 +133,8 @@ func NewDetector(endpoint, un, pw string) *OfflineAgentDetector {
 		Username:    un,
 		Password:    pw,
 
-		api: &http.Client{},
+		api: &http.Client{Timeout: requestTimeout},
+		now: time.Now,
 	}
 
 	result.log = logrus.WithField("detector", result.Name())
@@ -79,11 +142,30 @@ func NewDetector(endpoint, un, pw string) *OfflineAgentDetector {
 }
 
 func (b *OfflineAgentDetector) queryAPI() ([]bambooAgent, error) {
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/%s", b.APIEndpoint, bambooAgentAPICall), nil)
-	if err != nil {
+	response := []bambooAgent{}
+	if err := b.get(bambooAgentAPICall, &response); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+func (b *OfflineAgentDetector) queryElasticInstances() ([]elasticInstance, error) {
+	response := []elasticInstance{}
+	if err := b.get(elasticInstanceAPICall, &response); err != nil {
 		return nil, err
 	}
 
+	return response, nil
+}
+
+// get calls the bamboo API and decodes the JSON response into v
+func (b *OfflineAgentDetector) get(call string, v interface{}) error {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/%s", b.APIEndpoint, call), nil)
+	if err != nil {
+		return err
+	}
+
 	if b.Username != "" && b.Password != "" {
 		b.log.WithField("username", b.Username).WithField("uri", req.URL.String()).Debug("Using basic auth")
 		req.SetBasicAuth(b.Username, b.Password)
@@ -91,20 +173,15 @@ func (b *OfflineAgentDetector) queryAPI() ([]bambooAgent, error) {
 
 	resp, err := b.api.Do(req)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	defer resp.Body.Close()
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("Request failed: %s", resp.Status)
+		return fmt.Errorf("Request failed: %s", resp.Status)
 	}
 
-	response := []bambooAgent{}
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return nil, err
-	}
-
-	return response, nil
+	return json.NewDecoder(resp.Body).Decode(v)
 }
 
 // Name implements spot.OfflineAgentDetector.Name by returning
@@ -113,15 +190,33 @@ func (b *OfflineAgentDetector) Name() string {
 	return fmt.Sprintf("[bamboo] %s", b.APIEndpoint)
 }
 
+// considers returns true if agents of a type are considered
+func (b *OfflineAgentDetector) considers(agentType string) bool {
+	if len(b.Types) == 0 {
+		return true
+	}
+
+	for _, t := range b.Types {
+		if strings.EqualFold(t, agentType) {
+			return true
+		}
+	}
+
+	return false
+}
+
 // FindOfflineAgents implements spot.OfflineAgentDetector.FindOfflineAgents
 // by querying the bamboo agent API endpoint and returning any agents
-// that have their Active property set to true.
-func (b *OfflineAgentDetector) FindOfflineAgents() ([]string, error) {
+// that have their Active property set to false. Disabled agents are
+// reported as taken offline manually unless Disabled says otherwise. If
+// Elastic is set, elastic instances that failed to start or whose agent
+// did not register are returned instead of offline elastic agents.
+func (b *OfflineAgentDetector) FindOfflineAgents() ([]spot.Agent, error) {
 	if b.api == nil {
 		return nil, fmt.Errorf("Use spot.NewBambooDetector(...) to construct a BambooOfflineAgentDetector")
 	}
 
-	offline := []string{}
+	offline := []spot.Agent{}
 	nodes, err := b.queryAPI()
 	if err != nil {
 		return nil, err
@@ -132,13 +227,53 @@ func (b *OfflineAgentDetector) FindOfflineAgents() ([]string, error) {
 	}
 
 	for _, node := range nodes {
-		if !node.Active {
-			b.log.WithField("agent", node.Name).Warn("Found an offline agent")
-			offline = append(offline, node.Name)
+		if !b.considers(node.Type) {
+			b.log.WithFields(logrus.Fields{
+				"agent": node.Name,
+				"type":  node.Type,
+			}).Debug("Skipping agent (type not considered)")
+		} else if !node.Enabled && b.Disabled == DisabledIgnore {
+			b.log.WithField("agent", node.Name).Debug("Skipping agent (disabled)")
+		} else if !node.Active && b.Elastic != nil && strings.EqualFold(node.Type, AgentTypeElastic) {
+			b.log.WithField("agent", node.Name).Debug("Skipping agent (elastic agent)")
+		} else if !node.Active {
+			agent := spot.Agent{
+				Name:   node.Name,
+				Reason: node.reason(),
+				Class:  node.Type,
+				Manual: !node.Enabled,
+			}
+
+			if !node.Enabled && b.Disabled == DisabledDowngrade {
+				agent.Severity = spot.SeverityWarning
+			}
+
+			b.log.WithFields(logrus.Fields{
+				"agent":  node.Name,
+				"reason": agent.Reason,
+			}).Warn("Found an offline agent")
+			offline = append(offline, agent)
 		} else {
 			b.log.WithField("agent", node.Name).Debug("Node is online")
 		}
 	}
 
+	if b.Elastic != nil && b.considers(AgentTypeElastic) {
+		// The agents found so far are still reported if the elastic
+		// instances cannot be queried
+		instances, err := b.queryElasticInstances()
+		if err != nil {
+			return offline, &spot.PartialError{Err: fmt.Errorf("Failed to query elastic instances: %s", err)}
+		}
+
+		for _, agent := range b.Elastic.instances(instances, b.now()) {
+			b.log.WithFields(logrus.Fields{
+				"agent":  agent.Name,
+				"reason": agent.Reason,
+			}).Warn("Found a broken elastic instance")
+			offline = append(offline, agent)
+		}
+	}
+
 	return offline, nil
 }
@@ -6,7 +6,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/hylandsoftware/spot/pkg/spot"
 	"github.com/stretchr/testify/require"
 )
 
@@ -29,6 +31,30 @@ func mockBamboo(un, pw string) (*mockBambooServer, *OfflineAgentDetector) {
 	}, NewDetector(s.URL, un, pw)
 }
 
+func names(agents []spot.Agent) []string {
+	result := []string{}
+	for _, agent := range agents {
+		result = append(result, agent.Name)
+	}
+
+	return result
+}
+
+func TestFindOfflineAgents_TimesOut(t *testing.T) {
+	bamboo, sut := mockBamboo("fizz", "buzz")
+	defer bamboo.teardown()
+
+	bamboo.mux.HandleFunc("/rest/api/latest/agent", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	})
+
+	require.Equal(t, requestTimeout, sut.api.Timeout)
+
+	sut.api.Timeout = 10 * time.Millisecond
+	_, err := sut.FindOfflineAgents()
+	require.Error(t, err)
+}
+
 func TestNewBambooDetectorFromArg_ErrorForEmpty(t *testing.T) {
 	_, err := NewDetectorFromArg("")
 
@@ -38,7 +64,8 @@ func TestNewBambooDetectorFromArg_ErrorForEmpty(t *testing.T) {
 func TestNewBambooDetectorFromArg_ErrorForMalformatted(t *testing.T) {
 	_, err := NewDetectorFromArg("http://foo,bar,baz,fizz,buzz")
 
-	require.EqualError(t, err, fmt.Sprintf("The format of the config string was not recognized: %s", "http://foo,bar,baz,fizz,buzz"))
+	require.EqualError(t, err, fmt.Sprintf("The format of the config string for %s was not recognized, expected <url> or <url>,<username>,<password>", "http://foo"))
+	require.NotContains(t, err.Error(), "baz")
 }
 
 func TestNewBambooDetectorFromArg_NoCredentials(t *testing.T) {
@@ -78,7 +105,7 @@ func TestFindOfflineAgents_Query_BadEndpoint(t *testing.T) {
 
 	_, err := sut.FindOfflineAgents()
 
-	require.EqualError(t, err, "parse ://foo/rest/api/latest/agent: missing protocol scheme")
+	require.EqualError(t, err, `parse "://foo/rest/api/latest/agent": missing protocol scheme`)
 }
 
 func TestFindOfflineAgents_Query_NonSuccess(t *testing.T) {
@@ -170,7 +197,122 @@ func TestFindOfflineAgents_MarksOfflineAgents(t *testing.T) {
 	result, err := sut.FindOfflineAgents()
 
 	require.NoError(t, err)
-	require.Contains(t, result, "agent2")
-	require.Contains(t, result, "agent3")
-	require.NotContains(t, result, "agent1")
+	require.Contains(t, names(result), "agent2")
+	require.Contains(t, names(result), "agent3")
+	require.NotContains(t, names(result), "agent1")
+}
+
+const mixedAgents = `
+	[
+		{"id": 1, "name": "local", "type": "LOCAL", "active": false, "enabled": true},
+		{"id": 2, "name": "remote", "type": "REMOTE", "active": false, "enabled": true},
+		{"id": 3, "name": "disabled", "type": "REMOTE", "active": false, "enabled": false},
+		{"id": 4, "name": "elastic", "type": "ELASTIC", "active": false, "enabled": true},
+		{"id": 5, "name": "online", "type": "REMOTE", "active": true, "enabled": false}
+	]
+`
+
+func mockMixedAgents(bamboo *mockBambooServer) {
+	bamboo.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, mixedAgents)
+	})
+}
+
+func TestFindOfflineAgents_IncludesTypeAndReason(t *testing.T) {
+	bamboo, sut := mockBamboo("fizz", "buzz")
+	defer bamboo.teardown()
+	mockMixedAgents(bamboo)
+
+	result, err := sut.FindOfflineAgents()
+	require.NoError(t, err)
+	require.Equal(t, []spot.Agent{
+		{Name: "local", Reason: "Local agent is offline", Class: AgentTypeLocal},
+		{Name: "remote", Reason: "Remote agent is offline", Class: AgentTypeRemote},
+		{Name: "disabled", Reason: "Remote agent is disabled", Class: AgentTypeRemote, Manual: true},
+		{Name: "elastic", Reason: "Elastic agent is offline", Class: AgentTypeElastic},
+	}, result)
+}
+
+func TestFindOfflineAgents_DowngradesDisabledAgents(t *testing.T) {
+	bamboo, sut := mockBamboo("fizz", "buzz")
+	defer bamboo.teardown()
+	mockMixedAgents(bamboo)
+
+	sut.Disabled = DisabledDowngrade
+	result, err := sut.FindOfflineAgents()
+	require.NoError(t, err)
+	require.Len(t, result, 4)
+	require.Equal(t, spot.SeverityWarning, result[2].Severity)
+	require.Empty(t, result[1].Severity)
+}
+
+func TestFindOfflineAgents_IgnoresDisabledAgents(t *testing.T) {
+	bamboo, sut := mockBamboo("fizz", "buzz")
+	defer bamboo.teardown()
+	mockMixedAgents(bamboo)
+
+	sut.Disabled = DisabledIgnore
+	result, err := sut.FindOfflineAgents()
+	require.NoError(t, err)
+	require.Equal(t, []string{"local", "remote", "elastic"}, names(result))
+}
+
+func TestFindOfflineAgents_FiltersByType(t *testing.T) {
+	bamboo, sut := mockBamboo("fizz", "buzz")
+	defer bamboo.teardown()
+	mockMixedAgents(bamboo)
+
+	sut.Types = []string{"remote", AgentTypeElastic}
+	result, err := sut.FindOfflineAgents()
+	require.NoError(t, err)
+	require.Equal(t, []string{"remote", "disabled", "elastic"}, names(result))
+}
+
+func TestFindOfflineAgents_ElasticInstances(t *testing.T) {
+	bamboo, sut := mockBamboo("fizz", "buzz")
+	defer bamboo.teardown()
+	mockMixedAgents(bamboo)
+
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	sut.now = func() time.Time { return now }
+	sut.Elastic = &ElasticAgents{MaxStartTime: 10 * time.Minute}
+
+	bamboo.mux.HandleFunc("/rest/api/latest/elasticInstances", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `
+			[
+				{"instanceId": "i-1", "state": "RUNNING", "startTime": %d, "agentId": 4},
+				{"instanceId": "i-2", "state": "RUNNING", "startTime": %d},
+				{"instanceId": "i-3", "state": "STARTING", "startTime": %d},
+				{"instanceId": "i-4", "state": "FAILED_TO_START", "configurationName": "windows"}
+			]
+		`, millis(now.Add(-time.Hour)), millis(now.Add(-time.Hour)), millis(now.Add(-time.Minute)))
+	})
+
+	result, err := sut.FindOfflineAgents()
+	require.NoError(t, err)
+	require.Equal(t, []string{"local", "remote", "disabled", "elastic: i-2", "elastic: i-4"}, names(result))
+	require.Equal(t, "Elastic instance of windows failed to start", result[4].Reason)
+
+	sut.Types = []string{AgentTypeRemote}
+	result, err = sut.FindOfflineAgents()
+	require.NoError(t, err)
+	require.Equal(t, []string{"remote", "disabled"}, names(result))
+}
+
+func TestFindOfflineAgents_PartialErrorForFailedElasticQuery(t *testing.T) {
+	bamboo, sut := mockBamboo("fizz", "buzz")
+	defer bamboo.teardown()
+
+	bamboo.mux.HandleFunc("/rest/api/latest/agent", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, mixedAgents)
+	})
+
+	sut.Elastic = &ElasticAgents{}
+	result, err := sut.FindOfflineAgents()
+	require.IsType(t, &spot.PartialError{}, err)
+	require.EqualError(t, err, "Failed to query elastic instances: Request failed: 404 Not Found")
+	require.Equal(t, []string{"local", "remote", "disabled"}, names(result))
 }
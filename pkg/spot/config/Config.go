@@ -0,0 +1,972 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/hylandsoftware/spot/pkg/spot"
+	"github.com/hylandsoftware/spot/pkg/spot/bamboo"
+	"github.com/hylandsoftware/spot/pkg/spot/jenkins"
+	"github.com/hylandsoftware/spot/pkg/spot/redact"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// DetectorJenkins is the type of detector that watches Jenkins agents
+	DetectorJenkins = "jenkins"
+	// DetectorBamboo is the type of detector that watches Bamboo agents
+	DetectorBamboo = "bamboo"
+
+	// NotifierSlack posts to a Slack-compatible incoming webhook
+	NotifierSlack = "slack"
+	// NotifierSlackBot posts to a Slack channel using a bot token
+	NotifierSlackBot = "slack-bot"
+	// NotifierDiscord posts to a Discord webhook
+	NotifierDiscord = "discord"
+	// NotifierAlertmanager sends alerts to a Prometheus Alertmanager
+	NotifierAlertmanager = "alertmanager"
+
+	// silenceSource is the source of silences loaded from a config
+	silenceSource = "config"
+
+	// secretSource is the source of the secrets of the applied config and
+	// pendingSecretSource that of a config while it is being applied
+	secretSource        = "config"
+	pendingSecretSource = "config-pending"
+
+	// bytesPerGB converts the health thresholds to bytes
+	bytesPerGB = 1024 * 1024 * 1024
+)
+
+// Config describes the detectors, notifiers and settings spot runs with
+type Config struct {
+	// Period is how long to wait between checks
+	Period string `yaml:"period" toml:"period"`
+	// WarmUp runs checks without notifications once before starting
+	WarmUp bool `yaml:"warmUp" toml:"warmUp"`
+	// Reminder is how long to wait before reminding about agents that are
+	// still offline
+	Reminder string `yaml:"reminder" toml:"reminder"`
+	// Retries is how many times to attempt failed notifications
+	Retries int `yaml:"retries" toml:"retries"`
+	// RetryBackoff is how long to wait before the first retry
+	RetryBackoff string `yaml:"retryBackoff" toml:"retryBackoff"`
+	Verbosity    string `yaml:"verbosity" toml:"verbosity"`
+	// Listen is the address to serve the HTTP API on
+	Listen string `yaml:"listen" toml:"listen"`
+	// APIToken is the bearer token required to acknowledge agents and
+	// manage silences through the HTTP API, which is read-only without it.
+	// It may refer to an environment variable or a file like credentials.
+	APIToken string `yaml:"apiToken" toml:"apiToken"`
+	// Template is the path to the default notification template
+	Template string `yaml:"template" toml:"template"`
+
+	Detectors []Detector `yaml:"detectors" toml:"detectors"`
+	Notifiers []Notifier `yaml:"notifiers" toml:"notifiers"`
+
+	// Routes and Silences use the same syntax as the --route and
+	// --silence flags
+	Routes []string `yaml:"routes" toml:"routes"`
+	// DefaultRoute names the notifiers for agents that match no route. All
+	// notifiers are used if it is empty.
+	DefaultRoute []string `yaml:"defaultRoute" toml:"defaultRoute"`
+	Silences     []string `yaml:"silences" toml:"silences"`
+}
+
+// Detector describes a build system to watch
+type Detector struct {
+	// Type is either jenkins or bamboo
+	Type string `yaml:"type" toml:"type"`
+	URL  string `yaml:"url" toml:"url"`
+	// Username and Password may refer to an environment variable
+	// (env:NAME) or a file (file:/path). If neither is set they are looked
+	// up by host in the netrc file.
+	Username string `yaml:"username" toml:"username"`
+	Password string `yaml:"password" toml:"password"`
+	// Token is a jenkins API token to use instead of a password. Requests
+	// authenticated with a token do not need a CSRF crumb.
+	Token string `yaml:"token" toml:"token"`
+
+	// Period is how often to check this detector if it should be checked
+	// less often than every cycle
+	Period string `yaml:"period" toml:"period"`
+	// GracePeriod is how long an agent must be offline before it is reported
+	GracePeriod string `yaml:"gracePeriod" toml:"gracePeriod"`
+
+	// ClassWhitelist limits which jenkins agent classes are considered
+	ClassWhitelist []string `yaml:"classWhitelist" toml:"classWhitelist"`
+	// Labels must all be assigned to a jenkins agent for it to be considered
+	Labels []string `yaml:"labels" toml:"labels"`
+	// Include and Exclude are regular expressions matched against jenkins
+	// agent names. Agents must match Include, if set, and must not match
+	// Exclude.
+	Include string `yaml:"include" toml:"include"`
+	Exclude string `yaml:"exclude" toml:"exclude"`
+	// TemporarilyOffline is report, downgrade or ignore and controls how
+	// jenkins agents that were marked temporarily offline are reported
+	TemporarilyOffline string `yaml:"temporarilyOffline" toml:"temporarilyOffline"`
+	// Health reports jenkins agents that are online but unhealthy as
+	// degraded
+	Health *Health `yaml:"health" toml:"health"`
+	// Cloud controls how jenkins agents provisioned by a cloud are reported
+	Cloud *Cloud `yaml:"cloud" toml:"cloud"`
+	// Executors reports jenkins agents that are online but stuck on
+	// long-running builds
+	Executors *Executors `yaml:"executors" toml:"executors"`
+	// Queue reports labels whose builds wait in the jenkins build queue for
+	// too long
+	Queue *Queue `yaml:"queue" toml:"queue"`
+	// Reconnect reconnects jenkins agents that went offline on their own
+	Reconnect *Reconnect `yaml:"reconnect" toml:"reconnect"`
+
+	// Types limits which bamboo agent types (LOCAL, REMOTE or ELASTIC) are
+	// considered
+	Types []string `yaml:"types" toml:"types"`
+	// Disabled is report, downgrade or ignore and controls how bamboo
+	// agents that were disabled are reported
+	Disabled string `yaml:"disabled" toml:"disabled"`
+	// Elastic reports bamboo elastic instances that failed to start instead
+	// of elastic agents that are offline
+	Elastic *Elastic `yaml:"elastic" toml:"elastic"`
+}
+
+// Elastic describes when bamboo elastic instances are reported
+type Elastic struct {
+	// MaxStartTime is how long an instance may take to start and register
+	// its agent
+	MaxStartTime string `yaml:"maxStartTime" toml:"maxStartTime"`
+}
+
+// Reconnect describes when offline jenkins agents are reconnected
+type Reconnect struct {
+	// After is how long an agent must be offline before it is reconnected
+	After string `yaml:"after" toml:"after"`
+	// MaxAttempts is how often an agent is reconnected before giving up
+	MaxAttempts int `yaml:"maxAttempts" toml:"maxAttempts"`
+	// Backoff is how long to wait before the second attempt. It doubles
+	// after every attempt. Defaults to 5 minutes.
+	Backoff string `yaml:"backoff" toml:"backoff"`
+}
+
+// Queue holds the threshold at which builds waiting in the jenkins build
+// queue are reported as starved
+type Queue struct {
+	// MaxWait is how long a build may wait for an executor
+	MaxWait string `yaml:"maxWait" toml:"maxWait"`
+}
+
+// Executors holds the thresholds at which an online jenkins agent is
+// reported as stuck. Thresholds that are not set are not checked.
+type Executors struct {
+	// MaxBuildDuration is the longest a single build may run
+	MaxBuildDuration string `yaml:"maxBuildDuration" toml:"maxBuildDuration"`
+	// MaxBusyDuration is the longest every executor may be busy at once
+	MaxBusyDuration string `yaml:"maxBusyDuration" toml:"maxBusyDuration"`
+}
+
+// Cloud describes how jenkins agents provisioned by a cloud, e.g. kubernetes
+// pods or EC2 instances, are reported
+type Cloud struct {
+	// Classes are the classes of cloud agents. The classes of the common
+	// cloud plugins are used if it is empty.
+	Classes []string `yaml:"classes" toml:"classes"`
+	// GracePeriod is how long a cloud agent must be offline before it is
+	// reported. Cloud agents are not reported if it is not set.
+	GracePeriod string `yaml:"gracePeriod" toml:"gracePeriod"`
+}
+
+// Health holds the thresholds at which an online jenkins agent is reported
+// as degraded. Thresholds that are not set are not checked.
+type Health struct {
+	// MinDiskSpaceGB and MinTempSpaceGB are the least free space in GB
+	MinDiskSpaceGB     float64 `yaml:"minDiskSpaceGB" toml:"minDiskSpaceGB"`
+	MinTempSpaceGB     float64 `yaml:"minTempSpaceGB" toml:"minTempSpaceGB"`
+	MaxClockDifference string  `yaml:"maxClockDifference" toml:"maxClockDifference"`
+	MaxResponseTime    string  `yaml:"maxResponseTime" toml:"maxResponseTime"`
+}
+
+// Notifier describes somewhere to send notifications
+type Notifier struct {
+	// Type is one of slack, slack-bot, discord or alertmanager
+	Type string `yaml:"type" toml:"type"`
+	// Name is used to refer to the notifier from routes. It defaults to
+	// the type followed by its position among notifiers of that type, e.g.
+	// slack-1.
+	Name string `yaml:"name" toml:"name"`
+	// URL is the webhook or API URL. It is not used by slack-bot.
+	URL string `yaml:"url" toml:"url"`
+	// Token and Channel are used by slack-bot. URL and Token may refer to
+	// an environment variable (env:NAME) or a file (file:/path).
+	Token   string `yaml:"token" toml:"token"`
+	Channel string `yaml:"channel" toml:"channel"`
+	// Template overrides the default notification template
+	Template string `yaml:"template" toml:"template"`
+}
+
+// ValidationError lists every problem found with a Config
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return fmt.Sprintf("Invalid configuration:\n  %s", strings.Join(e, "\n  "))
+}
+
+// Load reads a Config from a YAML (.yaml, .yml) or TOML (.toml) file.
+// Unknown keys are rejected. The result is not validated.
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read config: %s", err.Error())
+	}
+
+	result := &Config{}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		if err := yaml.UnmarshalStrict(data, result); err != nil {
+			return nil, fmt.Errorf("Failed to parse %s: %s", path, err.Error())
+		}
+	case ".toml":
+		meta, err := toml.DecodeReader(bytes.NewReader(data), result)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse %s: %s", path, err.Error())
+		}
+
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			keys := []string{}
+			for _, key := range undecoded {
+				keys = append(keys, key.String())
+			}
+
+			return nil, fmt.Errorf("Failed to parse %s: unknown keys: %s", path, strings.Join(keys, ", "))
+		}
+	default:
+		return nil, fmt.Errorf("Unsupported config file extension '%s', use .yaml, .yml or .toml", ext)
+	}
+
+	return result, nil
+}
+
+// NotifierNames returns the name of every notifier, in order, applying the
+// default names to notifiers that are not named
+func (c *Config) NotifierNames() []string {
+	counts := map[string]int{}
+	result := []string{}
+
+	for _, n := range c.Notifiers {
+		counts[n.Type]++
+		if n.Name != "" {
+			result = append(result, n.Name)
+		} else {
+			result = append(result, fmt.Sprintf("%s-%d", n.Type, counts[n.Type]))
+		}
+	}
+
+	return result
+}
+
+type validator struct {
+	problems ValidationError
+}
+
+func (v *validator) fail(field, format string, args ...interface{}) {
+	v.problems = append(v.problems, fmt.Sprintf("%s: %s", field, fmt.Sprintf(format, args...)))
+}
+
+func (v *validator) duration(field, value string, required bool) {
+	if value == "" {
+		if required {
+			v.fail(field, "is required")
+		}
+
+		return
+	}
+
+	if d, err := time.ParseDuration(value); err != nil {
+		v.fail(field, "invalid duration '%s'", value)
+	} else if d < 0 {
+		v.fail(field, "must not be negative")
+	}
+}
+
+// regexp reports a problem if value is not a valid regular expression
+func (v *validator) regexp(field, value string) {
+	if _, err := regexp.Compile(value); err != nil {
+		v.fail(field, "invalid regular expression: %s", err.Error())
+	}
+}
+
+// secret resolves a secret, reporting a problem and returning an empty
+// string if it cannot be resolved
+func (v *validator) secret(field, value string) string {
+	result, err := resolveSecret(value)
+	if err != nil {
+		v.fail(field, "%s", err.Error())
+	}
+
+	return result
+}
+
+func (v *validator) url(field, value string) {
+	if value == "" {
+		v.fail(field, "is required")
+		return
+	}
+
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.fail(field, "must be an http:// or https:// URL")
+	}
+}
+
+// Validate checks the config for problems, returning a ValidationError
+// describing all of them. requirePeriod should be false when checks are
+// only run once.
+func (c *Config) Validate(requirePeriod bool) error {
+	v := &validator{}
+
+	v.duration("period", c.Period, requirePeriod)
+	v.duration("reminder", c.Reminder, false)
+	v.duration("retryBackoff", c.RetryBackoff, false)
+
+	if c.Retries < 0 {
+		v.fail("retries", "must not be negative")
+	}
+
+	v.secret("apiToken", c.APIToken)
+
+	if c.Verbosity != "" {
+		if _, err := logrus.ParseLevel(strings.ToLower(c.Verbosity)); err != nil {
+			v.fail("verbosity", "unknown level '%s'", c.Verbosity)
+		}
+	}
+
+	if len(c.Detectors) == 0 {
+		v.fail("detectors", "provide at least one detector")
+	}
+
+	seen := map[string]int{}
+	for i, d := range c.Detectors {
+		field := fmt.Sprintf("detectors[%d]", i)
+
+		if d.Type != DetectorJenkins && d.Type != DetectorBamboo {
+			v.fail(field+".type", "must be one of %s, %s", DetectorJenkins, DetectorBamboo)
+		}
+
+		v.url(field+".url", d.URL)
+
+		if d.Token != "" {
+			if d.Type != DetectorJenkins {
+				v.fail(field+".token", "is only supported by %s detectors", DetectorJenkins)
+			} else if d.Password != "" {
+				v.fail(field, "password and token must not be provided together")
+			} else if d.Username == "" {
+				v.fail(field, "username and token must be provided together")
+			}
+		} else if (d.Username == "") != (d.Password == "") {
+			v.fail(field, "username and password must be provided together")
+		} else if d.Username == "" {
+			if _, _, err := lookupNetrc(netrcPath(), d.URL); err != nil {
+				v.fail(field, "%s", err.Error())
+			}
+		}
+
+		v.secret(field+".username", d.Username)
+		v.secret(field+".password", d.Password)
+		v.secret(field+".token", d.Token)
+
+		v.duration(field+".period", d.Period, false)
+		v.duration(field+".gracePeriod", d.GracePeriod, false)
+
+		jenkinsOnly := map[string]bool{
+			"classWhitelist": len(d.ClassWhitelist) > 0,
+			"labels":         len(d.Labels) > 0,
+			"include":        d.Include != "",
+			"exclude":        d.Exclude != "",
+			"cloud":          d.Cloud != nil,
+			"executors":      d.Executors != nil,
+			"queue":          d.Queue != nil,
+			"reconnect":      d.Reconnect != nil,
+		}
+
+		for _, key := range []string{"classWhitelist", "labels", "include", "exclude", "cloud", "executors", "queue", "reconnect"} {
+			if jenkinsOnly[key] && d.Type != DetectorJenkins {
+				v.fail(field+"."+key, "is only supported by %s detectors", DetectorJenkins)
+			}
+		}
+
+		if len(d.Types) > 0 && d.Type != DetectorBamboo {
+			v.fail(field+".types", "is only supported by %s detectors", DetectorBamboo)
+		}
+
+		for _, t := range d.Types {
+			if !containsFold(bamboo.AgentTypes(), t) {
+				v.fail(field+".types", "'%s' must be one of %s", t, strings.Join(bamboo.AgentTypes(), ", "))
+			}
+		}
+
+		if d.Elastic != nil {
+			if d.Type != DetectorBamboo {
+				v.fail(field+".elastic", "is only supported by %s detectors", DetectorBamboo)
+			}
+
+			v.duration(field+".elastic.maxStartTime", d.Elastic.MaxStartTime, false)
+		}
+
+		switch d.Disabled {
+		case "", bamboo.DisabledReport, bamboo.DisabledDowngrade, bamboo.DisabledIgnore:
+			if d.Disabled != "" && d.Type != DetectorBamboo {
+				v.fail(field+".disabled", "is only supported by %s detectors", DetectorBamboo)
+			}
+		default:
+			v.fail(field+".disabled", "must be one of %s, %s, %s", bamboo.DisabledReport, bamboo.DisabledDowngrade, bamboo.DisabledIgnore)
+		}
+
+		v.regexp(field+".include", d.Include)
+		v.regexp(field+".exclude", d.Exclude)
+
+		if d.Cloud != nil {
+			v.duration(field+".cloud.gracePeriod", d.Cloud.GracePeriod, false)
+		}
+
+		if d.Executors != nil {
+			v.duration(field+".executors.maxBuildDuration", d.Executors.MaxBuildDuration, false)
+			v.duration(field+".executors.maxBusyDuration", d.Executors.MaxBusyDuration, false)
+		}
+
+		if d.Queue != nil {
+			v.duration(field+".queue.maxWait", d.Queue.MaxWait, true)
+		}
+
+		if d.Reconnect != nil {
+			v.duration(field+".reconnect.after", d.Reconnect.After, false)
+			v.duration(field+".reconnect.backoff", d.Reconnect.Backoff, false)
+			if d.Reconnect.MaxAttempts < 0 {
+				v.fail(field+".reconnect.maxAttempts", "must not be negative")
+			}
+		}
+
+		if d.Health != nil {
+			if d.Type != DetectorJenkins {
+				v.fail(field+".health", "is only supported by %s detectors", DetectorJenkins)
+			}
+
+			if d.Health.MinDiskSpaceGB < 0 {
+				v.fail(field+".health.minDiskSpaceGB", "must not be negative")
+			}
+
+			if d.Health.MinTempSpaceGB < 0 {
+				v.fail(field+".health.minTempSpaceGB", "must not be negative")
+			}
+
+			v.duration(field+".health.maxClockDifference", d.Health.MaxClockDifference, false)
+			v.duration(field+".health.maxResponseTime", d.Health.MaxResponseTime, false)
+		}
+
+		switch d.TemporarilyOffline {
+		case "", jenkins.TemporarilyOfflineReport, jenkins.TemporarilyOfflineDowngrade, jenkins.TemporarilyOfflineIgnore:
+			if d.TemporarilyOffline != "" && d.Type != DetectorJenkins {
+				v.fail(field+".temporarilyOffline", "is only supported by %s detectors", DetectorJenkins)
+			}
+		default:
+			v.fail(field+".temporarilyOffline", "must be one of %s, %s, %s", jenkins.TemporarilyOfflineReport, jenkins.TemporarilyOfflineDowngrade, jenkins.TemporarilyOfflineIgnore)
+		}
+
+		key := fmt.Sprintf("%s %s", d.Type, strings.TrimSuffix(d.URL, "/"))
+		if previous, ok := seen[key]; ok {
+			v.fail(field, "duplicates detectors[%d]", previous)
+		} else {
+			seen[key] = i
+		}
+	}
+
+	names := c.NotifierNames()
+	known := map[string]int{}
+	for i, n := range c.Notifiers {
+		field := fmt.Sprintf("notifiers[%d]", i)
+
+		switch n.Type {
+		case NotifierSlack, NotifierDiscord, NotifierAlertmanager:
+			if endpoint := v.secret(field+".url", n.URL); endpoint != "" || n.URL == "" {
+				v.url(field+".url", endpoint)
+			}
+		case NotifierSlackBot:
+			v.secret(field+".token", n.Token)
+
+			if n.Token == "" {
+				v.fail(field+".token", "is required")
+			}
+
+			if n.Channel == "" {
+				v.fail(field+".channel", "is required")
+			}
+		default:
+			v.fail(field+".type", "must be one of %s, %s, %s, %s", NotifierSlack, NotifierSlackBot, NotifierDiscord, NotifierAlertmanager)
+		}
+
+		if previous, ok := known[names[i]]; ok {
+			v.fail(field+".name", "'%s' is already used by notifiers[%d]", names[i], previous)
+		} else {
+			known[names[i]] = i
+		}
+	}
+
+	for i, spec := range c.Routes {
+		field := fmt.Sprintf("routes[%d]", i)
+
+		route, err := spot.ParseRoute(spec)
+		if err != nil {
+			v.fail(field, "%s", err.Error())
+			continue
+		}
+
+		for _, name := range route.Notifiers {
+			if _, ok := known[name]; !ok {
+				v.fail(field, "unknown notifier '%s'", name)
+			}
+		}
+	}
+
+	for _, name := range c.DefaultRoute {
+		if _, ok := known[name]; !ok {
+			v.fail("defaultRoute", "unknown notifier '%s'", name)
+		}
+	}
+
+	for i, spec := range c.Silences {
+		if _, err := spot.ParseSilence(spec); err != nil {
+			v.fail(fmt.Sprintf("silences[%d]", i), "%s", err.Error())
+		}
+	}
+
+	if len(v.problems) > 0 {
+		return v.problems
+	}
+
+	return nil
+}
+
+// parseDuration parses a duration that has already been validated, treating
+// an empty string as zero
+func parseDuration(value string) time.Duration {
+	d, _ := time.ParseDuration(value)
+	return d
+}
+
+// credentials resolves the username and password of the detector, looking
+// them up in the netrc file if they are not set
+func (d *Detector) credentials() (string, string, error) {
+	if d.Username == "" && d.Password == "" && d.Token == "" {
+		return lookupNetrc(netrcPath(), d.URL)
+	}
+
+	username, err := resolveSecret(d.Username)
+	if err != nil {
+		return "", "", err
+	}
+
+	password, err := resolveSecret(d.Password)
+	if err != nil {
+		return "", "", err
+	}
+
+	return username, password, nil
+}
+
+// Build constructs the detector, resolving its credentials
+func (d *Detector) Build() (spot.OfflineAgentDetector, error) {
+	username, password, err := d.credentials()
+	if err != nil {
+		return nil, err
+	}
+
+	if d.Type == DetectorBamboo {
+		result := bamboo.NewDetector(d.URL, username, password)
+		result.Types = d.Types
+		result.Disabled = d.Disabled
+		if d.Elastic != nil {
+			result.Elastic = &bamboo.ElasticAgents{MaxStartTime: parseDuration(d.Elastic.MaxStartTime)}
+		}
+
+		return result, nil
+	}
+
+	result := jenkins.NewDetector(d.URL, username, password)
+	if d.Token != "" {
+		token, err := resolveSecret(d.Token)
+		if err != nil {
+			return nil, err
+		}
+
+		result = jenkins.NewTokenDetector(d.URL, username, token)
+	}
+
+	include, err := compile(d.Include)
+	if err != nil {
+		return nil, err
+	}
+
+	exclude, err := compile(d.Exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Filter = jenkins.Filter{
+		Classes: d.ClassWhitelist,
+		Labels:  d.Labels,
+		Include: include,
+		Exclude: exclude,
+	}
+
+	result.TemporarilyOffline = d.TemporarilyOffline
+	if d.Cloud != nil {
+		result.Cloud = jenkins.CloudAgents{
+			Classes:     d.Cloud.Classes,
+			GracePeriod: parseDuration(d.Cloud.GracePeriod),
+		}
+	}
+
+	if d.Executors != nil {
+		result.Executors = &jenkins.ExecutorThresholds{
+			MaxBuildDuration: parseDuration(d.Executors.MaxBuildDuration),
+			MaxBusyDuration:  parseDuration(d.Executors.MaxBusyDuration),
+		}
+	}
+
+	if d.Queue != nil {
+		result.Queue = &jenkins.QueueThresholds{MaxWait: parseDuration(d.Queue.MaxWait)}
+	}
+
+	if d.Reconnect != nil {
+		result.Reconnect = &jenkins.Remediation{
+			After:       parseDuration(d.Reconnect.After),
+			MaxAttempts: d.Reconnect.MaxAttempts,
+			Backoff:     parseDuration(d.Reconnect.Backoff),
+		}
+	}
+
+	if d.Health != nil {
+		result.Health = &jenkins.HealthThresholds{
+			MinDiskSpace:       int64(d.Health.MinDiskSpaceGB * bytesPerGB),
+			MinTempSpace:       int64(d.Health.MinTempSpaceGB * bytesPerGB),
+			MaxClockDifference: parseDuration(d.Health.MaxClockDifference),
+			MaxResponseTime:    parseDuration(d.Health.MaxResponseTime),
+		}
+	}
+
+	return result, nil
+}
+
+// compile compiles a regular expression, returning nil if it is empty
+func compile(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+
+	return regexp.Compile(expr)
+}
+
+// containsFold returns true if values contains value, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Options returns the per-detector watchdog options for the detector
+func (d *Detector) Options() spot.DetectorOptions {
+	return spot.DetectorOptions{
+		Interval:    parseDuration(d.Period),
+		GracePeriod: parseDuration(d.GracePeriod),
+	}
+}
+
+// Build constructs the notifier. defaultTemplate is used if the notifier
+// does not have its own template.
+func (n *Notifier) Build(defaultTemplate string) (spot.Notifier, error) {
+	template := n.Template
+	if template == "" {
+		template = defaultTemplate
+	}
+
+	endpoint, err := resolveSecret(n.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := resolveSecret(n.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.Type {
+	case NotifierSlack:
+		return spot.NewSlackNotifier(endpoint, template)
+	case NotifierSlackBot:
+		return spot.NewSlackBotNotifier(token, n.Channel, template)
+	case NotifierDiscord:
+		return spot.NewDiscordNotifier(endpoint, template)
+	case NotifierAlertmanager:
+		return spot.NewAlertmanagerNotifier(endpoint)
+	}
+
+	return nil, fmt.Errorf("Unknown notifier type '%s'", n.Type)
+}
+
+// BuildNotifiers constructs every notifier and registers it under its name
+func (c *Config) BuildNotifiers() (*spot.MultiNotifier, error) {
+	result := spot.NewMultiNotifier()
+	names := c.NotifierNames()
+
+	for i, n := range c.Notifiers {
+		notifier, err := n.Build(c.Template)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid %s configuration: %s", names[i], err.Error())
+		}
+
+		logrus.WithField("notifier", names[i]).Debug("Adding notifier")
+		if err := result.Add(names[i], notifier); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// BuildHandler constructs the notification handler. If routes are
+// configured, notifications are routed between the notifiers. It returns
+// nil if there are no notifiers.
+func (c *Config) BuildHandler() (spot.Notifier, error) {
+	notifiers, err := c.BuildNotifiers()
+	if err != nil || len(notifiers.Names()) == 0 {
+		return nil, err
+	}
+
+	if len(c.Routes) == 0 {
+		return notifiers, nil
+	}
+
+	routes := []*spot.Route{}
+	for _, spec := range c.Routes {
+		route, err := spot.ParseRoute(spec)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse route: %s", err.Error())
+		}
+
+		routes = append(routes, route)
+	}
+
+	defaults := c.DefaultRoute
+	if len(defaults) == 0 {
+		defaults = notifiers.Names()
+	}
+
+	return spot.NewRouter(notifiers, routes, defaults)
+}
+
+// BuildSilences parses the configured silences
+func (c *Config) BuildSilences() ([]*spot.Silence, error) {
+	result := []*spot.Silence{}
+
+	for _, spec := range c.Silences {
+		silence, err := spot.ParseSilence(spec)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse silence: %s", err.Error())
+		}
+
+		result = append(result, silence)
+	}
+
+	return result, nil
+}
+
+// RetryPolicy returns the notification retry policy. Retrying is disabled
+// if it returns nil.
+func (c *Config) RetryPolicy() *spot.RetryPolicy {
+	policy := spot.DefaultRetryPolicy
+	if c.Retries > 0 {
+		policy.MaxAttempts = c.Retries
+	}
+
+	if c.RetryBackoff != "" {
+		policy.InitialBackoff = parseDuration(c.RetryBackoff)
+		if policy.MaxBackoff < policy.InitialBackoff {
+			policy.MaxBackoff = policy.InitialBackoff
+		}
+	}
+
+	if policy.MaxAttempts <= 1 {
+		return nil
+	}
+
+	return &policy
+}
+
+// SecretFiles returns the files that secrets are read from, including the
+// netrc file if any detector looks its credentials up there
+func (c *Config) SecretFiles() []string {
+	result := []string{}
+	add := func(values ...string) {
+		for _, value := range values {
+			if path := secretFile(value); path != "" {
+				result = append(result, path)
+			}
+		}
+	}
+
+	netrc := false
+	for _, d := range c.Detectors {
+		add(d.Username, d.Password, d.Token)
+		netrc = netrc || (d.Username == "" && d.Password == "" && d.Token == "")
+	}
+
+	for _, n := range c.Notifiers {
+		add(n.URL, n.Token)
+	}
+
+	if path := netrcPath(); netrc && path != "" {
+		result = append(result, path)
+	}
+
+	return result
+}
+
+// secrets resolves the secrets of the config. Secrets that cannot be
+// resolved are skipped since building the config reports them.
+func (c *Config) secrets() []string {
+	result := []string{}
+	add := func(values ...string) {
+		for _, value := range values {
+			if resolved, err := resolveSecret(value); err == nil {
+				result = append(result, resolved)
+			}
+		}
+	}
+
+	for _, d := range c.Detectors {
+		if _, password, err := d.credentials(); err == nil {
+			result = append(result, password)
+		}
+
+		add(d.Token)
+	}
+
+	for _, n := range c.Notifiers {
+		add(n.Token)
+
+		// Webhook URLs grant access on their own so they are secret as well
+		if n.Type == NotifierSlack || n.Type == NotifierDiscord {
+			add(n.URL)
+		}
+	}
+
+	return result
+}
+
+// ResolveAPIToken resolves the API token, which is empty if the HTTP API is
+// read-only
+func (c *Config) ResolveAPIToken() (string, error) {
+	token, err := resolveSecret(c.APIToken)
+	if err != nil {
+		return "", err
+	}
+
+	redact.Secret(token)
+	return token, nil
+}
+
+// RequiresRestart returns the settings that differ from a previous config
+// but are only applied on start
+func (c *Config) RequiresRestart(previous *Config) []string {
+	result := []string{}
+
+	changed := func(key string, different bool) {
+		if different {
+			result = append(result, key)
+		}
+	}
+
+	changed("period", c.Period != previous.Period)
+	changed("warmUp", c.WarmUp != previous.WarmUp)
+	changed("retries", c.Retries != previous.Retries)
+	changed("retryBackoff", c.RetryBackoff != previous.RetryBackoff)
+	changed("listen", c.Listen != previous.Listen)
+	changed("apiToken", c.APIToken != previous.APIToken)
+
+	return result
+}
+
+// discard is the notification handler used when no notifiers are
+// configured so that offline agents are only logged
+type discard struct{}
+
+func (discard) Notify(agents map[string][]spot.Agent) error { return nil }
+
+// Configure builds the detectors, notifiers and silences of a validated
+// config and applies them to a watchdog. It may be called again to reload
+// a running watchdog, in which case silences from the config replace those
+// from the previous config while silences added at runtime are kept.
+// Nothing is changed if an error is returned. The secrets of the config
+// replace those of the previous config in the redacted log output.
+//
+// Jenkins detectors that reconnect agents keep track of their attempts in
+// remediator, which should be the same on every reload so that reloading
+// does not reset the attempts. Each detector tracks its own attempts if it
+// is nil.
+func (c *Config) Configure(w *spot.Watchdog, remediator *jenkins.Remediator) error {
+	// Mask the new secrets while building in case an error contains them,
+	// without forgetting the secrets of the config that is still applied
+	secrets := c.secrets()
+	redact.Replace(pendingSecretSource, secrets...)
+	defer redact.Replace(pendingSecretSource)
+
+	detectors := []spot.OfflineAgentDetector{}
+	options := map[string]spot.DetectorOptions{}
+
+	for i, d := range c.Detectors {
+		detector, err := d.Build()
+		if err != nil {
+			return fmt.Errorf("Invalid detectors[%d] configuration: %s", i, err.Error())
+		}
+
+		if j, ok := detector.(*jenkins.OfflineAgentDetector); ok && j.Reconnect != nil && remediator != nil {
+			j.Reconnect.Remediator = remediator
+		}
+
+		logrus.WithField("detector", detector.Name()).Debug("Adding detector")
+
+		detectors = append(detectors, detector)
+		options[detector.Name()] = d.Options()
+	}
+
+	handler, err := c.BuildHandler()
+	if err != nil {
+		return err
+	}
+
+	silences, err := c.BuildSilences()
+	if err != nil {
+		return err
+	}
+
+	if handler == nil {
+		handler = discard{}
+	}
+
+	redact.Replace(secretSource, secrets...)
+	w.Silences.Replace(silenceSource, silences)
+	w.Reconfigure(detectors, handler, options, parseDuration(c.Reminder))
+
+	return nil
+}
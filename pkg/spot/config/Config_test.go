@@ -0,0 +1,391 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hylandsoftware/spot/pkg/spot"
+	"github.com/hylandsoftware/spot/pkg/spot/bamboo"
+	"github.com/hylandsoftware/spot/pkg/spot/jenkins"
+	"github.com/stretchr/testify/require"
+)
+
+const yamlConfig = `
+period: 5m
+reminder: 1h
+detectors:
+  - type: jenkins
+    url: https://jenkins/
+    username: spot
+    password: secret
+    period: 15m
+    gracePeriod: 10m
+    classWhitelist: [hudson.slaves.SlaveComputer]
+    labels: [windows]
+    exclude: -test$
+    temporarilyOffline: downgrade
+    health:
+      minDiskSpaceGB: 10
+      maxClockDifference: 30s
+    cloud:
+      gracePeriod: 2h
+    executors:
+      maxBuildDuration: 20h
+    queue:
+      maxWait: 30m
+    reconnect:
+      after: 15m
+      backoff: 10m
+  - type: bamboo
+    url: https://bamboo
+    types: [REMOTE]
+    disabled: ignore
+    elastic:
+      maxStartTime: 20m
+notifiers:
+  - type: slack
+    url: https://hooks.slack.com/services/a
+  - type: discord
+    name: ops
+    url: https://discord.com/api/webhooks/b
+routes:
+  - agent=^win-;notify=ops
+silences:
+  - agent=win-*;for=1h
+`
+
+const tomlConfig = `
+period = "5m"
+reminder = "1h"
+routes = ["agent=^win-;notify=ops"]
+silences = ["agent=win-*;for=1h"]
+
+[[detectors]]
+type = "jenkins"
+url = "https://jenkins/"
+username = "spot"
+password = "secret"
+period = "15m"
+gracePeriod = "10m"
+classWhitelist = ["hudson.slaves.SlaveComputer"]
+labels = ["windows"]
+exclude = "-test$"
+temporarilyOffline = "downgrade"
+
+[detectors.cloud]
+gracePeriod = "2h"
+
+[detectors.executors]
+maxBuildDuration = "20h"
+
+[detectors.queue]
+maxWait = "30m"
+
+[detectors.reconnect]
+after = "15m"
+backoff = "10m"
+
+[detectors.health]
+minDiskSpaceGB = 10.0
+maxClockDifference = "30s"
+
+[[detectors]]
+type = "bamboo"
+url = "https://bamboo"
+types = ["REMOTE"]
+disabled = "ignore"
+
+[detectors.elastic]
+maxStartTime = "20m"
+
+[[notifiers]]
+type = "slack"
+url = "https://hooks.slack.com/services/a"
+
+[[notifiers]]
+type = "discord"
+name = "ops"
+url = "https://discord.com/api/webhooks/b"
+`
+
+func write(t *testing.T, name, content string) string {
+	dir, err := ioutil.TempDir("", "spot")
+	require.NoError(t, err)
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func expected() *Config {
+	return &Config{
+		Period:   "5m",
+		Reminder: "1h",
+		Detectors: []Detector{
+			{
+				Type:               DetectorJenkins,
+				URL:                "https://jenkins/",
+				Username:           "spot",
+				Password:           "secret",
+				Period:             "15m",
+				GracePeriod:        "10m",
+				ClassWhitelist:     []string{"hudson.slaves.SlaveComputer"},
+				Labels:             []string{"windows"},
+				Exclude:            "-test$",
+				TemporarilyOffline: jenkins.TemporarilyOfflineDowngrade,
+				Health:             &Health{MinDiskSpaceGB: 10, MaxClockDifference: "30s"},
+				Cloud:              &Cloud{GracePeriod: "2h"},
+				Executors:          &Executors{MaxBuildDuration: "20h"},
+				Queue:              &Queue{MaxWait: "30m"},
+				Reconnect:          &Reconnect{After: "15m", Backoff: "10m"},
+			},
+			{Type: DetectorBamboo, URL: "https://bamboo", Types: []string{"REMOTE"}, Disabled: bamboo.DisabledIgnore, Elastic: &Elastic{MaxStartTime: "20m"}},
+		},
+		Notifiers: []Notifier{
+			{Type: NotifierSlack, URL: "https://hooks.slack.com/services/a"},
+			{Type: NotifierDiscord, Name: "ops", URL: "https://discord.com/api/webhooks/b"},
+		},
+		Routes:   []string{"agent=^win-;notify=ops"},
+		Silences: []string{"agent=win-*;for=1h"},
+	}
+}
+
+func TestLoad_YAML(t *testing.T) {
+	actual, err := Load(write(t, "spot.yaml", yamlConfig))
+	require.NoError(t, err)
+	require.Equal(t, expected(), actual)
+	require.NoError(t, actual.Validate(true))
+}
+
+func TestLoad_TOML(t *testing.T) {
+	actual, err := Load(write(t, "spot.toml", tomlConfig))
+	require.NoError(t, err)
+	require.Equal(t, expected(), actual)
+	require.NoError(t, actual.Validate(true))
+}
+
+func TestLoad_RejectsUnknownKeys(t *testing.T) {
+	_, err := Load(write(t, "spot.yml", "period: 5m\nperoid: 5m\n"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "peroid")
+
+	_, err = Load(write(t, "spot.toml", "period = \"5m\"\n[[detectors]]\ntype = \"jenkins\"\nuri = \"https://jenkins\"\n"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "detectors.uri")
+}
+
+func TestLoad_RejectsUnknownExtension(t *testing.T) {
+	_, err := Load(write(t, "spot.json", "{}"))
+	require.EqualError(t, err, "Unsupported config file extension '.json', use .yaml, .yml or .toml")
+}
+
+func TestValidate_ReportsEveryProblem(t *testing.T) {
+	c := &Config{
+		Reminder: "soon",
+		Detectors: []Detector{
+			{Type: "gitlab", URL: "https://gitlab"},
+			{Type: DetectorBamboo, URL: "bamboo", Username: "spot", ClassWhitelist: []string{"a"}, Include: "^a", TemporarilyOffline: "ignore"},
+			{Type: DetectorJenkins, URL: "https://jenkins", GracePeriod: "-1m", Exclude: "(", TemporarilyOffline: "hide"},
+			{Type: DetectorJenkins, URL: "https://jenkins/", Health: &Health{MinDiskSpaceGB: -1, MaxResponseTime: "slow"}},
+			{Type: DetectorBamboo, URL: "https://bamboo", Health: &Health{}, Types: []string{"remote", "cloud"}, Disabled: "hide", Elastic: &Elastic{MaxStartTime: "soon"}},
+			{Type: DetectorJenkins, URL: "https://cloud.jenkins", Cloud: &Cloud{GracePeriod: "later"}, Executors: &Executors{MaxBusyDuration: "-1h"}, Queue: &Queue{}, Reconnect: &Reconnect{MaxAttempts: -1}, Types: []string{"LOCAL"}, Disabled: "ignore", Elastic: &Elastic{}},
+		},
+		Notifiers: []Notifier{
+			{Type: NotifierSlackBot},
+			{Type: NotifierSlack, Name: "slack-bot-1", URL: "https://hooks.slack.com"},
+		},
+		Routes:       []string{"notify=nobody", "bogus=1"},
+		DefaultRoute: []string{"missing"},
+		Silences:     []string{"for=forever"},
+	}
+
+	err := c.Validate(true)
+	require.Error(t, err)
+	require.Equal(t, ValidationError{
+		"period: is required",
+		"reminder: invalid duration 'soon'",
+		"detectors[0].type: must be one of jenkins, bamboo",
+		"detectors[1].url: must be an http:// or https:// URL",
+		"detectors[1]: username and password must be provided together",
+		"detectors[1].classWhitelist: is only supported by jenkins detectors",
+		"detectors[1].include: is only supported by jenkins detectors",
+		"detectors[1].temporarilyOffline: is only supported by jenkins detectors",
+		"detectors[2].gracePeriod: must not be negative",
+		"detectors[2].exclude: invalid regular expression: error parsing regexp: missing closing ): `(`",
+		"detectors[2].temporarilyOffline: must be one of report, downgrade, ignore",
+		"detectors[3].health.minDiskSpaceGB: must not be negative",
+		"detectors[3].health.maxResponseTime: invalid duration 'slow'",
+		"detectors[3]: duplicates detectors[2]",
+		"detectors[4].types: 'cloud' must be one of LOCAL, REMOTE, ELASTIC",
+		"detectors[4].elastic.maxStartTime: invalid duration 'soon'",
+		"detectors[4].disabled: must be one of report, downgrade, ignore",
+		"detectors[4].health: is only supported by jenkins detectors",
+		"detectors[5].types: is only supported by bamboo detectors",
+		"detectors[5].elastic: is only supported by bamboo detectors",
+		"detectors[5].disabled: is only supported by bamboo detectors",
+		"detectors[5].cloud.gracePeriod: invalid duration 'later'",
+		"detectors[5].executors.maxBusyDuration: must not be negative",
+		"detectors[5].queue.maxWait: is required",
+		"detectors[5].reconnect.maxAttempts: must not be negative",
+		"notifiers[0].token: is required",
+		"notifiers[0].channel: is required",
+		"notifiers[1].name: 'slack-bot-1' is already used by notifiers[0]",
+		"routes[0]: unknown notifier 'nobody'",
+		"routes[1]: Unknown route key 'bogus'",
+		"defaultRoute: unknown notifier 'missing'",
+		"silences[0]: Invalid value for silence key 'for': time: invalid duration \"forever\"",
+	}, err)
+}
+
+func TestValidate_Token(t *testing.T) {
+	c := &Config{Detectors: []Detector{
+		{Type: DetectorJenkins, URL: "https://a", Username: "spot", Token: "token"},
+		{Type: DetectorJenkins, URL: "https://b", Username: "spot", Password: "secret", Token: "token"},
+		{Type: DetectorJenkins, URL: "https://c", Token: "env:SPOT_TEST_MISSING_TOKEN"},
+		{Type: DetectorBamboo, URL: "https://d", Username: "spot", Token: "token"},
+	}}
+
+	require.Equal(t, ValidationError{
+		"detectors[1]: password and token must not be provided together",
+		"detectors[2]: username and token must be provided together",
+		"detectors[2].token: Environment variable SPOT_TEST_MISSING_TOKEN is not set",
+		"detectors[3].token: is only supported by jenkins detectors",
+	}, c.Validate(false))
+}
+
+func TestValidate_PeriodNotRequiredWhenRunningOnce(t *testing.T) {
+	c := &Config{Detectors: []Detector{{Type: DetectorJenkins, URL: "http://jenkins"}}}
+
+	require.NoError(t, c.Validate(false))
+	require.Error(t, c.Validate(true))
+}
+
+func TestNotifierNames(t *testing.T) {
+	c := &Config{Notifiers: []Notifier{
+		{Type: NotifierSlack},
+		{Type: NotifierDiscord},
+		{Type: NotifierSlack, Name: "ops"},
+		{Type: NotifierSlack},
+	}}
+
+	require.Equal(t, []string{"slack-1", "discord-1", "ops", "slack-3"}, c.NotifierNames())
+}
+
+func TestConfigure(t *testing.T) {
+	c := expected()
+	require.NoError(t, c.Validate(true))
+
+	w := spot.NewWatchdog(nil, nil)
+	require.NoError(t, c.Configure(w, nil))
+
+	require.Len(t, w.Detectors, 2)
+	require.Equal(t, "[jenkins] https://jenkins", w.Detectors[0].Name())
+	filter := w.Detectors[0].(*jenkins.OfflineAgentDetector).Filter
+	require.Equal(t, []string{"hudson.slaves.SlaveComputer"}, filter.Classes)
+	require.Equal(t, []string{"windows"}, filter.Labels)
+	require.Nil(t, filter.Include)
+	require.Equal(t, "-test$", filter.Exclude.String())
+	require.Equal(t, jenkins.CloudAgents{GracePeriod: 2 * time.Hour}, w.Detectors[0].(*jenkins.OfflineAgentDetector).Cloud)
+	require.Equal(t, &jenkins.ExecutorThresholds{MaxBuildDuration: 20 * time.Hour}, w.Detectors[0].(*jenkins.OfflineAgentDetector).Executors)
+	require.Equal(t, &jenkins.QueueThresholds{MaxWait: 30 * time.Minute}, w.Detectors[0].(*jenkins.OfflineAgentDetector).Queue)
+	require.Equal(t, &jenkins.Remediation{After: 15 * time.Minute, Backoff: 10 * time.Minute}, w.Detectors[0].(*jenkins.OfflineAgentDetector).Reconnect)
+	require.Equal(t, jenkins.TemporarilyOfflineDowngrade, w.Detectors[0].(*jenkins.OfflineAgentDetector).TemporarilyOffline)
+	require.Equal(t, &jenkins.HealthThresholds{MinDiskSpace: 10 * 1024 * 1024 * 1024, MaxClockDifference: 30 * time.Second}, w.Detectors[0].(*jenkins.OfflineAgentDetector).Health)
+
+	require.Equal(t, []string{"REMOTE"}, w.Detectors[1].(*bamboo.OfflineAgentDetector).Types)
+	require.Equal(t, bamboo.DisabledIgnore, w.Detectors[1].(*bamboo.OfflineAgentDetector).Disabled)
+	require.Equal(t, &bamboo.ElasticAgents{MaxStartTime: 20 * time.Minute}, w.Detectors[1].(*bamboo.OfflineAgentDetector).Elastic)
+
+	require.Equal(t, spot.DetectorOptions{Interval: 15 * time.Minute, GracePeriod: 10 * time.Minute}, w.Options[w.Detectors[0].Name()])
+	require.Equal(t, spot.DetectorOptions{}, w.Options[w.Detectors[1].Name()])
+
+	require.IsType(t, &spot.Router{}, w.NotificationHandler)
+	require.Len(t, w.Silences.List(), 1)
+	require.Equal(t, time.Hour, w.ReminderInterval)
+}
+
+func TestConfigure_Reload(t *testing.T) {
+	w := spot.NewWatchdog(nil, nil)
+	require.NoError(t, expected().Configure(w, nil))
+
+	runtime := w.Silences.Add(&spot.Silence{Agent: "mac-*"})
+	kept := w.Silences.List()[0]
+
+	c := expected()
+	c.Detectors = c.Detectors[1:]
+	c.Notifiers = c.Notifiers[1:]
+	c.Silences = append(c.Silences, "agent=linux-*;for=2h")
+	require.NoError(t, c.Validate(true))
+	require.NoError(t, c.Configure(w, nil))
+
+	require.Len(t, w.Detectors, 1)
+	require.Equal(t, "[bamboo] https://bamboo", w.Detectors[0].Name())
+
+	silences := w.Silences.List()
+	require.Len(t, silences, 3)
+	require.Equal(t, runtime, silences[0].ID)
+	require.True(t, kept == silences[1])
+	require.Equal(t, "agent=linux-*;for=2h", silences[2].Spec)
+}
+
+func TestConfigure_SharesRemediatorAcrossReloads(t *testing.T) {
+	c := &Config{Detectors: []Detector{{Type: DetectorJenkins, URL: "https://jenkins", Reconnect: &Reconnect{}}}}
+	w := spot.NewWatchdog(nil, nil)
+	remediator := jenkins.NewRemediator()
+
+	require.NoError(t, c.Configure(w, remediator))
+	first := w.Detectors[0].(*jenkins.OfflineAgentDetector)
+
+	require.NoError(t, c.Configure(w, remediator))
+	reloaded := w.Detectors[0].(*jenkins.OfflineAgentDetector)
+
+	require.False(t, first == reloaded)
+	require.True(t, first.Reconnect.Remediator == remediator)
+	require.True(t, reloaded.Reconnect.Remediator == remediator)
+}
+
+func TestConfigure_Token(t *testing.T) {
+	c := &Config{Detectors: []Detector{{Type: DetectorJenkins, URL: "https://jenkins", Username: "spot", Token: "token"}}}
+
+	w := spot.NewWatchdog(nil, nil)
+	require.NoError(t, c.Configure(w, nil))
+
+	detector := w.Detectors[0].(*jenkins.OfflineAgentDetector)
+	require.Equal(t, "spot", detector.Username)
+	require.Empty(t, detector.Password)
+	require.Equal(t, "token", detector.Token)
+}
+
+func TestConfigure_WithoutNotifiers(t *testing.T) {
+	c := &Config{Detectors: []Detector{{Type: DetectorBamboo, URL: "https://bamboo"}}}
+
+	w := spot.NewWatchdog(nil, nil)
+	require.NoError(t, c.Configure(w, nil))
+	require.Equal(t, discard{}, w.NotificationHandler)
+}
+
+func TestRequiresRestart(t *testing.T) {
+	c := expected()
+	require.Empty(t, c.RequiresRestart(expected()))
+
+	c.Period = "1m"
+	c.Listen = ":8080"
+	c.Reminder = "2h"
+	require.Equal(t, []string{"period", "listen"}, c.RequiresRestart(expected()))
+}
+
+func TestRetryPolicy(t *testing.T) {
+	policy := (&Config{}).RetryPolicy()
+	require.Equal(t, spot.DefaultRetryPolicy, *policy)
+
+	policy = (&Config{Retries: 3, RetryBackoff: "10m"}).RetryPolicy()
+	require.Equal(t, 3, policy.MaxAttempts)
+	require.Equal(t, 10*time.Minute, policy.InitialBackoff)
+	require.Equal(t, 10*time.Minute, policy.MaxBackoff)
+
+	require.Nil(t, (&Config{Retries: 1}).RetryPolicy())
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/hylandsoftware/spot/pkg/spot"
+	"github.com/hylandsoftware/spot/pkg/spot/redact"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+// captureLogs sends all log output through the redacting formatter into a
+// buffer until the returned function is called
+func captureLogs() (*bytes.Buffer, func()) {
+	out := &bytes.Buffer{}
+	logger := logrus.StandardLogger()
+	output, formatter, level := logger.Out, logger.Formatter, logger.Level
+
+	logger.SetOutput(out)
+	logger.SetFormatter(&redact.Formatter{Formatter: &logrus.TextFormatter{DisableColors: true}})
+	logger.SetLevel(logrus.DebugLevel)
+
+	return out, func() {
+		logger.SetOutput(output)
+		logger.SetFormatter(formatter)
+		logger.SetLevel(level)
+	}
+}
+
+func TestSecretsNeverAppearInLogs(t *testing.T) {
+	const (
+		password = "jenkins-pa55word"
+		webhook  = "/services/T000/B000/webhook-s3cret"
+		userinfo = "userinfo-pa55word"
+	)
+
+	jenkins := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"computer":[{"_class":"hudson.slaves.SlaveComputer","displayName":"a","offline":true}]}`))
+	}))
+	defer jenkins.Close()
+
+	slack := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("invalid_payload for " + r.URL.Path))
+	}))
+	defer slack.Close()
+
+	os.Setenv("SPOT_TEST_PASSWORD", password)
+	defer os.Unsetenv("SPOT_TEST_PASSWORD")
+
+	out, restore := captureLogs()
+	defer restore()
+
+	c := &Config{
+		Detectors: []Detector{
+			{Type: DetectorJenkins, URL: jenkins.URL, Username: "spot", Password: "env:SPOT_TEST_PASSWORD"},
+			{Type: DetectorBamboo, URL: fmt.Sprintf("http://spot:%s@127.0.0.1:1", userinfo)},
+		},
+		Notifiers: []Notifier{{Type: NotifierSlack, URL: slack.URL + webhook}},
+	}
+	require.NoError(t, c.Validate(false))
+
+	w := spot.NewWatchdog(nil, nil)
+	require.NoError(t, c.Configure(w, nil))
+
+	err := w.RunChecksAndNotify()
+	require.Error(t, err)
+	logrus.WithError(err).WithField("config", c).Error("Watchdog checks failed")
+
+	logged := out.String()
+	require.Contains(t, logged, "Failed to check for offline agents")
+	require.Contains(t, logged, "Watchdog checks failed")
+
+	for _, secret := range []string{password, "webhook-s3cret", userinfo} {
+		require.NotContains(t, logged, secret)
+	}
+}
+
+func TestConfigure_ReplacesSecretsOnReload(t *testing.T) {
+	c := &Config{Detectors: []Detector{{Type: DetectorJenkins, URL: "https://jenkins", Username: "spot", Password: "first-pa55word"}}}
+	w := spot.NewWatchdog(nil, nil)
+	require.NoError(t, c.Configure(w, nil))
+	require.Equal(t, redact.Mask, redact.String("first-pa55word"))
+
+	c.Detectors[0].Password = "second-pa55word"
+	require.NoError(t, c.Configure(w, nil))
+	require.Equal(t, "first-pa55word", redact.String("first-pa55word"))
+	require.Equal(t, redact.Mask, redact.String("second-pa55word"))
+}
+
+func TestConfigure_MasksShortPasswords(t *testing.T) {
+	c := &Config{Detectors: []Detector{{Type: DetectorJenkins, URL: "https://jenkins", Username: "spot", Password: "Zq9!x"}}}
+	require.NoError(t, c.Configure(spot.NewWatchdog(nil, nil), nil))
+
+	require.Equal(t, "password "+redact.Mask, redact.String("password Zq9!x"))
+}
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	envPrefix  = "env:"
+	filePrefix = "file:"
+)
+
+// resolveSecret returns the value of a secret. Secrets may refer to an
+// environment variable (env:NAME) or to a file (file:/path) whose contents
+// are used with surrounding whitespace removed. Other values are returned
+// as-is.
+func resolveSecret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, envPrefix):
+		name := strings.TrimPrefix(value, envPrefix)
+		result, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("Environment variable %s is not set", name)
+		}
+
+		return result, nil
+	case strings.HasPrefix(value, filePrefix):
+		data, err := ioutil.ReadFile(strings.TrimPrefix(value, filePrefix))
+		if err != nil {
+			return "", fmt.Errorf("Failed to read secret: %s", err.Error())
+		}
+
+		return strings.TrimSpace(string(data)), nil
+	}
+
+	return value, nil
+}
+
+// secretFile returns the file a secret refers to, or an empty string if it
+// does not refer to a file
+func secretFile(value string) string {
+	if strings.HasPrefix(value, filePrefix) {
+		return strings.TrimPrefix(value, filePrefix)
+	}
+
+	return ""
+}
+
+// netrcPath returns the path of the netrc file, which is $NETRC if it is
+// set or .netrc in the home directory otherwise
+func netrcPath() string {
+	if path := os.Getenv("NETRC"); path != "" {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(home, ".netrc")
+}
+
+// lookupNetrc returns the login and password for the host of endpoint from
+// the netrc file at path. Nothing is returned if the file does not exist or
+// has no entry for the host.
+func lookupNetrc(path, endpoint string) (string, string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || path == "" {
+		return "", "", nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", "", nil
+	} else if err != nil {
+		return "", "", fmt.Errorf("Failed to read netrc: %s", err.Error())
+	}
+
+	host := u.Hostname()
+	tokens := strings.Fields(string(data))
+
+	var login, password string
+	var matched, isDefault bool
+
+	for i := 0; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "machine", "default":
+			if matched {
+				return login, password, nil
+			}
+
+			isDefault = tokens[i] == "default"
+			if !isDefault {
+				i++
+				if i >= len(tokens) {
+					return "", "", fmt.Errorf("Failed to parse netrc %s: machine is missing a name", path)
+				}
+			}
+
+			matched = isDefault || strings.EqualFold(tokens[i], host)
+			login, password = "", ""
+		case "login", "password", "account":
+			i++
+			if i >= len(tokens) {
+				return "", "", fmt.Errorf("Failed to parse netrc %s: %s is missing a value", path, tokens[i-1])
+			}
+
+			if tokens[i-1] == "login" {
+				login = tokens[i]
+			} else if tokens[i-1] == "password" {
+				password = tokens[i]
+			}
+		case "macdef":
+			// Macros run until the next blank line, which Fields discards,
+			// so they cannot be skipped reliably. They are only used by ftp
+			// and are expected after the machine entries.
+			if matched {
+				return login, password, nil
+			}
+
+			return "", "", nil
+		}
+	}
+
+	if matched {
+		return login, password, nil
+	}
+
+	return "", "", nil
+}
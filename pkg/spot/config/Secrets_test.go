@@ -0,0 +1,120 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/hylandsoftware/spot/pkg/spot/bamboo"
+	"github.com/stretchr/testify/require"
+)
+
+const netrc = `
+machine jenkins.example.com login spot password s3cret
+machine bamboo.example.com
+  login builder
+  password hunter2
+default login anonymous password guest
+`
+
+func TestResolveSecret(t *testing.T) {
+	os.Setenv("SPOT_TEST_SECRET", "from-env")
+	defer os.Unsetenv("SPOT_TEST_SECRET")
+
+	value, err := resolveSecret("env:SPOT_TEST_SECRET")
+	require.NoError(t, err)
+	require.Equal(t, "from-env", value)
+
+	value, err = resolveSecret("file:" + write(t, "secret", "from-file\n"))
+	require.NoError(t, err)
+	require.Equal(t, "from-file", value)
+
+	value, err = resolveSecret("literal")
+	require.NoError(t, err)
+	require.Equal(t, "literal", value)
+
+	_, err = resolveSecret("env:SPOT_TEST_MISSING")
+	require.EqualError(t, err, "Environment variable SPOT_TEST_MISSING is not set")
+
+	_, err = resolveSecret("file:/does/not/exist")
+	require.Error(t, err)
+}
+
+func TestLookupNetrc(t *testing.T) {
+	path := write(t, ".netrc", netrc)
+
+	for endpoint, expected := range map[string][]string{
+		"https://jenkins.example.com":       {"spot", "s3cret"},
+		"https://BAMBOO.example.com:8085/x": {"builder", "hunter2"},
+		"https://other.example.com":         {"anonymous", "guest"},
+	} {
+		login, password, err := lookupNetrc(path, endpoint)
+		require.NoError(t, err)
+		require.Equal(t, expected, []string{login, password}, endpoint)
+	}
+
+	login, password, err := lookupNetrc(write(t, ".netrc", "machine a login b password c"), "https://jenkins")
+	require.NoError(t, err)
+	require.Empty(t, login)
+	require.Empty(t, password)
+
+	login, _, err = lookupNetrc("/does/not/exist", "https://jenkins")
+	require.NoError(t, err)
+	require.Empty(t, login)
+
+	_, _, err = lookupNetrc(write(t, ".netrc", "machine jenkins login"), "https://jenkins")
+	require.Error(t, err)
+}
+
+func TestDetectorBuild_ResolvesCredentials(t *testing.T) {
+	os.Setenv("NETRC", write(t, ".netrc", netrc))
+	os.Setenv("SPOT_TEST_USER", "env-user")
+	defer os.Unsetenv("NETRC")
+	defer os.Unsetenv("SPOT_TEST_USER")
+
+	d := &Detector{
+		Type:     DetectorBamboo,
+		URL:      "https://bamboo.example.com",
+		Username: "env:SPOT_TEST_USER",
+		Password: "file:" + write(t, "password", "file-password"),
+	}
+
+	detector, err := d.Build()
+	require.NoError(t, err)
+	require.Equal(t, "env-user", detector.(*bamboo.OfflineAgentDetector).Username)
+	require.Equal(t, "file-password", detector.(*bamboo.OfflineAgentDetector).Password)
+
+	d.Username, d.Password = "", ""
+	detector, err = d.Build()
+	require.NoError(t, err)
+	require.Equal(t, "builder", detector.(*bamboo.OfflineAgentDetector).Username)
+	require.Equal(t, "hunter2", detector.(*bamboo.OfflineAgentDetector).Password)
+}
+
+func TestValidate_ReportsUnresolvableSecrets(t *testing.T) {
+	c := &Config{
+		Detectors: []Detector{{Type: DetectorJenkins, URL: "https://jenkins", Username: "spot", Password: "env:SPOT_TEST_MISSING"}},
+		Notifiers: []Notifier{{Type: NotifierSlack, URL: "env:SPOT_TEST_MISSING"}},
+	}
+
+	require.Equal(t, ValidationError{
+		"detectors[0].password: Environment variable SPOT_TEST_MISSING is not set",
+		"notifiers[0].url: Environment variable SPOT_TEST_MISSING is not set",
+	}, c.Validate(false))
+}
+
+func TestSecretFiles(t *testing.T) {
+	os.Setenv("NETRC", "/etc/netrc")
+	defer os.Unsetenv("NETRC")
+
+	c := &Config{
+		Detectors: []Detector{
+			{Username: "spot", Password: "file:/run/secrets/jenkins"},
+			{Username: "env:USER", Password: "env:PASSWORD"},
+		},
+		Notifiers: []Notifier{{Token: "file:/run/secrets/slack"}},
+	}
+	require.Equal(t, []string{"/run/secrets/jenkins", "/run/secrets/slack"}, c.SecretFiles())
+
+	c.Detectors = append(c.Detectors, Detector{})
+	require.Equal(t, []string{"/run/secrets/jenkins", "/run/secrets/slack", "/etc/netrc"}, c.SecretFiles())
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Watcher reloads a config file when its contents or the contents of the
+// secret files it refers to change, or when a reload is requested, e.g. on
+// SIGHUP. Files are polled rather than watched so that files which are
+// replaced through symlinks, like Kubernetes ConfigMap and Secret volumes,
+// are picked up.
+type Watcher struct {
+	path  string
+	files []string
+	load  func() (*Config, error)
+	apply func(*Config) error
+
+	reload chan struct{}
+	digest [sha256.Size]byte
+	log    *logrus.Entry
+}
+
+// NewWatcher constructs a Watcher for the config file at path, which was
+// loaded as current. load is called to load and validate the config when it
+// changes and apply is called with the result. If either fails the previous
+// config is kept.
+func NewWatcher(path string, current *Config, load func() (*Config, error), apply func(*Config) error) *Watcher {
+	result := &Watcher{
+		path:   path,
+		files:  current.SecretFiles(),
+		load:   load,
+		apply:  apply,
+		reload: make(chan struct{}, 1),
+		log:    logrus.WithField("config", path),
+	}
+
+	result.digest, _ = result.read()
+	return result
+}
+
+// read hashes the config file and the secret files. Secret files that
+// cannot be read are hashed as empty so that they are picked up once they
+// appear.
+func (w *Watcher) read() ([sha256.Size]byte, error) {
+	data, err := ioutil.ReadFile(w.path)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+
+	hash := sha256.New()
+	hash.Write(data)
+
+	for _, path := range w.files {
+		secret, _ := ioutil.ReadFile(path)
+		fmt.Fprintf(hash, "\x00%s\x00%d\x00", path, len(secret))
+		hash.Write(secret)
+	}
+
+	result := [sha256.Size]byte{}
+	copy(result[:], hash.Sum(nil))
+	return result, nil
+}
+
+// Reload requests that the config is reloaded even if the file has not
+// changed
+func (w *Watcher) Reload() {
+	select {
+	case w.reload <- struct{}{}:
+	default:
+	}
+}
+
+// Run checks the file for changes every interval and handles reload
+// requests until stop receives a value
+func (w *Watcher) Run(interval time.Duration, stop <-chan bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			w.check(false)
+		case <-w.reload:
+			w.check(true)
+		}
+	}
+}
+
+// check reloads the config if the file changed or force is set, returning
+// true if a new config was applied
+func (w *Watcher) check(force bool) bool {
+	digest, err := w.read()
+	if err != nil {
+		w.log.WithError(err).Warn("Failed to read config")
+		return false
+	}
+
+	if digest == w.digest && !force {
+		return false
+	}
+
+	// Remember the contents even if they are invalid so that the same
+	// problems are not reported on every check
+	w.digest = digest
+	w.log.Info("Reloading config")
+
+	c, err := w.load()
+	if err == nil {
+		err = w.apply(c)
+	}
+
+	if err != nil {
+		w.log.WithError(err).Error("Failed to reload config, keeping the previous config")
+		return false
+	}
+
+	w.files = c.SecretFiles()
+	w.digest, _ = w.read()
+
+	w.log.Info("Config reloaded")
+	return true
+}
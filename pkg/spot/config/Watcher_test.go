@@ -0,0 +1,112 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/hylandsoftware/spot/pkg/spot/jenkins"
+	"github.com/stretchr/testify/require"
+)
+
+func setupWatcher(t *testing.T) (string, *Watcher, *[]string) {
+	path := write(t, "spot.yaml", "period: 1m\n")
+	applied := &[]string{}
+
+	load := func() (*Config, error) {
+		return Load(path)
+	}
+
+	apply := func(c *Config) error {
+		if c.Period == "fail" {
+			return fmt.Errorf("Mock Error")
+		}
+
+		*applied = append(*applied, c.Period)
+		return nil
+	}
+
+	return path, NewWatcher(path, &Config{}, load, apply), applied
+}
+
+func TestWatcher_IgnoresUnchangedFile(t *testing.T) {
+	_, sut, applied := setupWatcher(t)
+
+	require.False(t, sut.check(false))
+	require.Empty(t, *applied)
+}
+
+func TestWatcher_ReloadsChangedFile(t *testing.T) {
+	path, sut, applied := setupWatcher(t)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("period: 2m\n"), 0600))
+	require.True(t, sut.check(false))
+	require.False(t, sut.check(false))
+	require.Equal(t, []string{"2m"}, *applied)
+}
+
+func TestWatcher_ForcedReloadAppliesUnchangedFile(t *testing.T) {
+	_, sut, applied := setupWatcher(t)
+
+	require.True(t, sut.check(true))
+	require.Equal(t, []string{"1m"}, *applied)
+}
+
+func TestWatcher_KeepsPreviousConfigOnError(t *testing.T) {
+	path, sut, applied := setupWatcher(t)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("peroid: 2m\n"), 0600))
+	require.False(t, sut.check(false))
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("period: fail\n"), 0600))
+	require.False(t, sut.check(false))
+
+	require.False(t, sut.check(false))
+	require.Empty(t, *applied)
+}
+
+func TestWatcher_RunHandlesReloadRequests(t *testing.T) {
+	path := write(t, "spot.yaml", "period: 1m\n")
+	applied := make(chan *Config, 1)
+
+	sut := NewWatcher(path, &Config{}, func() (*Config, error) { return Load(path) }, func(c *Config) error {
+		applied <- c
+		return nil
+	})
+
+	stop := make(chan bool)
+	go sut.Run(time.Hour, stop)
+	defer close(stop)
+
+	sut.Reload()
+
+	select {
+	case c := <-applied:
+		require.Equal(t, "1m", c.Period)
+	case <-time.After(time.Second):
+		require.Fail(t, "The config was not reloaded")
+	}
+}
+
+func TestWatcher_ReloadsRotatedSecrets(t *testing.T) {
+	secret := write(t, "token", "old")
+	path := write(t, "spot.yaml", "detectors:\n  - type: jenkins\n    url: https://jenkins\n    username: spot\n    password: file:"+secret+"\n")
+
+	current, err := Load(path)
+	require.NoError(t, err)
+
+	passwords := []string{}
+	sut := NewWatcher(path, current, func() (*Config, error) { return Load(path) }, func(c *Config) error {
+		detector, err := c.Detectors[0].Build()
+		passwords = append(passwords, detector.(*jenkins.OfflineAgentDetector).Password)
+		return err
+	})
+
+	require.False(t, sut.check(false))
+
+	require.NoError(t, ioutil.WriteFile(secret, []byte("new\n"), 0600))
+	require.True(t, sut.check(false))
+	require.False(t, sut.check(false))
+	require.Equal(t, []string{"new"}, passwords)
+}
@@ -0,0 +1,203 @@
+package jenkins
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	crumbAPICall = "crumbIssuer/api/json"
+
+	// requestTimeout is how long a request, including fetching a crumb, may
+	// take before it fails so that an unresponsive jenkins cannot stall the
+	// watchdog
+	requestTimeout = 30 * time.Second
+)
+
+type crumb struct {
+	Field string `json:"crumbRequestField"`
+	Value string `json:"crumb"`
+}
+
+// Client calls the jenkins API. If a username and password or API token are
+// provided, requests use HTTP Basic authentication.
+//
+// Jenkins requires a CSRF crumb for requests other than GET unless they are
+// authenticated with an API token. When authenticating with a password, or
+// anonymously, the client fetches a crumb before the first such request and
+// caches it along with the session cookie it is bound to. If jenkins
+// rejects the crumb, e.g. because the session expired, a new crumb is
+// fetched and the request is retried once.
+type Client struct {
+	Endpoint string
+	Username string
+
+	password string
+	token    string
+
+	api *http.Client
+
+	lock  sync.Mutex
+	crumb *crumb
+}
+
+// NewClient constructs a Client that authenticates with a password, if
+// one is provided
+func NewClient(endpoint, username, password string) *Client {
+	jar, _ := cookiejar.New(nil)
+
+	return &Client{
+		Endpoint: strings.TrimSuffix(endpoint, "/"),
+		Username: username,
+		password: password,
+		api:      &http.Client{Jar: jar, Timeout: requestTimeout},
+	}
+}
+
+// NewTokenClient constructs a Client that authenticates with an API token
+// instead of a password. Requests authenticated with an API token do not
+// need a CSRF crumb.
+func NewTokenClient(endpoint, username, token string) *Client {
+	result := NewClient(endpoint, username, "")
+	result.token = token
+	return result
+}
+
+// UsesToken returns true if the client authenticates with an API token
+func (c *Client) UsesToken() bool {
+	return c.token != ""
+}
+
+func (c *Client) newRequest(method, call string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, fmt.Sprintf("%s/%s", c.Endpoint, call), body)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Username != "" && c.token != "" {
+		req.SetBasicAuth(c.Username, c.token)
+	} else if c.Username != "" && c.password != "" {
+		req.SetBasicAuth(c.Username, c.password)
+	}
+
+	return req, nil
+}
+
+// Get calls the jenkins API and decodes the JSON response into v
+func (c *Client) Get(call string, v interface{}) error {
+	req, err := c.newRequest("GET", call, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.api.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Request failed: %s", resp.Status)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// Post submits a form to the jenkins API, including a CSRF crumb unless
+// the client authenticates with an API token
+func (c *Client) Post(call string, form url.Values) error {
+	retried := false
+
+	for {
+		resp, err := c.post(call, form)
+		if err != nil {
+			return err
+		}
+
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode < http.StatusBadRequest {
+			return nil
+		}
+
+		if resp.StatusCode == http.StatusForbidden && !retried && strings.Contains(string(body), "crumb") {
+			c.lock.Lock()
+			c.crumb = nil
+			c.lock.Unlock()
+
+			retried = true
+			continue
+		}
+
+		return fmt.Errorf("Request failed: %s", resp.Status)
+	}
+}
+
+func (c *Client) post(call string, form url.Values) (*http.Response, error) {
+	req, err := c.newRequest("POST", call, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	if !c.UsesToken() {
+		crumb, err := c.fetchCrumb()
+		if err != nil {
+			return nil, err
+		}
+
+		if crumb.Field != "" {
+			req.Header.Set(crumb.Field, crumb.Value)
+		}
+	}
+
+	return c.api.Do(req)
+}
+
+// fetchCrumb returns the cached crumb, fetching it first if necessary. An
+// empty crumb is returned if CSRF protection is disabled.
+func (c *Client) fetchCrumb() (*crumb, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.crumb != nil {
+		return c.crumb, nil
+	}
+
+	req, err := c.newRequest("GET", crumbAPICall, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.api.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	result := &crumb{}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+			return nil, err
+		}
+	case http.StatusNotFound:
+		// CSRF protection is disabled
+	default:
+		return nil, fmt.Errorf("Failed to fetch a crumb: %s", resp.Status)
+	}
+
+	c.crumb = result
+	return result, nil
+}
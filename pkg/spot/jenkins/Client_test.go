@@ -0,0 +1,157 @@
+package jenkins
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// mockCrumbIssuer issues a new crumb bound to a new session on every
+// request and accepts posts that present the crumb of their session
+func mockCrumbIssuer(mux *http.ServeMux) *int {
+	issued := 0
+
+	mux.HandleFunc("/crumbIssuer/api/json", func(w http.ResponseWriter, r *http.Request) {
+		issued++
+		http.SetCookie(w, &http.Cookie{Name: "JSESSIONID", Value: fmt.Sprintf("session%d", issued), Path: "/"})
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"crumb":"crumb%d","crumbRequestField":"Jenkins-Crumb"}`, issued)
+	})
+
+	return &issued
+}
+
+func validCrumb(r *http.Request) bool {
+	session, err := r.Cookie("JSESSIONID")
+	return err == nil && "crumb"+session.Value[len("session"):] == r.Header.Get("Jenkins-Crumb")
+}
+
+func TestClientGet_UsesBasicAuth(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/api/json", func(w http.ResponseWriter, r *http.Request) {
+		un, pw, ok := r.BasicAuth()
+		require.True(t, ok)
+		require.Equal(t, "fizz", un)
+		require.Equal(t, "buzz", pw)
+		io.WriteString(w, `{"mode":"NORMAL"}`)
+	})
+
+	result := map[string]string{}
+	require.NoError(t, NewClient(server.URL+"/", "fizz", "buzz").Get("api/json", &result))
+	require.Equal(t, "NORMAL", result["mode"])
+}
+
+func TestClientGet_ErrorForNonSuccess(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	err := NewClient(server.URL, "", "").Get("missing", &map[string]string{})
+	require.EqualError(t, err, "Request failed: 404 Not Found")
+}
+
+func TestClient_TimesOut(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/crumbIssuer/api/json", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	})
+
+	sut := NewClient(server.URL, "", "")
+	require.Equal(t, requestTimeout, sut.api.Timeout)
+
+	sut.api.Timeout = 10 * time.Millisecond
+	require.Error(t, sut.Post("computer/a/launchSlaveAgent", url.Values{}))
+}
+
+func TestClientPost_SendsCrumbWithSession(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	issued := mockCrumbIssuer(mux)
+	posts := 0
+	mux.HandleFunc("/computer/a/launchSlaveAgent", func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "POST", r.Method)
+		require.True(t, validCrumb(r))
+		posts++
+	})
+
+	sut := NewClient(server.URL, "fizz", "buzz")
+	require.NoError(t, sut.Post("computer/a/launchSlaveAgent", url.Values{}))
+	require.NoError(t, sut.Post("computer/a/launchSlaveAgent", url.Values{}))
+
+	require.Equal(t, 1, *issued)
+	require.Equal(t, 2, posts)
+}
+
+func TestClientPost_RetriesOnceWhenCrumbExpires(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	issued := mockCrumbIssuer(mux)
+	expired := true
+	mux.HandleFunc("/computer/a/launchSlaveAgent", func(w http.ResponseWriter, r *http.Request) {
+		if expired || !validCrumb(r) {
+			expired = false
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, "No valid crumb was included in the request")
+		}
+	})
+
+	sut := NewClient(server.URL, "fizz", "buzz")
+	require.NoError(t, sut.Post("computer/a/launchSlaveAgent", url.Values{}))
+	require.Equal(t, 2, *issued)
+
+	expired = true
+	mux.HandleFunc("/computer/b/launchSlaveAgent", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, "No valid crumb was included in the request")
+	})
+
+	require.EqualError(t, sut.Post("computer/b/launchSlaveAgent", url.Values{}), "Request failed: 403 Forbidden")
+}
+
+func TestClientPost_TokenSkipsCrumb(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	issued := mockCrumbIssuer(mux)
+	mux.HandleFunc("/computer/a/launchSlaveAgent", func(w http.ResponseWriter, r *http.Request) {
+		un, token, ok := r.BasicAuth()
+		require.True(t, ok)
+		require.Equal(t, "fizz", un)
+		require.Equal(t, "token", token)
+		require.Empty(t, r.Header.Get("Jenkins-Crumb"))
+	})
+
+	sut := NewTokenClient(server.URL, "fizz", "token")
+	require.True(t, sut.UsesToken())
+	require.NoError(t, sut.Post("computer/a/launchSlaveAgent", url.Values{}))
+	require.Equal(t, 0, *issued)
+}
+
+func TestClientPost_WithoutCSRFProtection(t *testing.T) {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/computer/a/launchSlaveAgent", func(w http.ResponseWriter, r *http.Request) {
+		require.Empty(t, r.Header.Get("Jenkins-Crumb"))
+	})
+
+	require.NoError(t, NewClient(server.URL, "", "").Post("computer/a/launchSlaveAgent", url.Values{}))
+}
@@ -0,0 +1,46 @@
+package jenkins
+
+import (
+	"time"
+)
+
+// DefaultCloudClasses returns the classes of the computers the common
+// jenkins cloud plugins provision. The computer API only reports the
+// concrete class of each computer, and not its retention strategy, so the
+// subclasses of hudson.slaves.AbstractCloudComputer have to be listed
+// explicitly.
+func DefaultCloudClasses() []string {
+	return []string{
+		"org.csanchez.jenkins.plugins.kubernetes.KubernetesComputer",
+		"hudson.plugins.ec2.EC2Computer",
+		"com.microsoft.azure.vmagent.AzureVMComputer",
+		"com.google.jenkins.plugins.computeengine.ComputeEngineComputer",
+		"io.jenkins.docker.DockerComputer",
+	}
+}
+
+// CloudAgents controls how agents that a cloud provisions on demand, e.g.
+// kubernetes pods or EC2 instances, are reported. These agents are often
+// offline while they are provisioned or torn down, so they are not
+// reported unless GracePeriod is set.
+type CloudAgents struct {
+	// Classes are the classes of cloud agents. DefaultCloudClasses are used
+	// if it is empty.
+	Classes []string
+	// GracePeriod is how long a cloud agent must be offline before it is
+	// reported. Cloud agents are not reported if it is zero.
+	GracePeriod time.Duration
+}
+
+func (c *CloudAgents) classes() []string {
+	if len(c.Classes) == 0 {
+		return DefaultCloudClasses()
+	}
+
+	return c.Classes
+}
+
+// matches returns true if the node is a cloud agent
+func (c *CloudAgents) matches(n *node) bool {
+	return contains(c.classes(), n.Class)
+}
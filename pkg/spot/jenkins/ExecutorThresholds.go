@@ -0,0 +1,72 @@
+package jenkins
+
+import (
+	"fmt"
+	"time"
+)
+
+type executable struct {
+	URL string `json:"url"`
+	// Timestamp is when the build started in milliseconds since the epoch
+	Timestamp int64 `json:"timestamp"`
+}
+
+type executor struct {
+	Idle              bool        `json:"idle"`
+	CurrentExecutable *executable `json:"currentExecutable"`
+}
+
+// started returns when the executor's current build started, or the zero
+// time if it is not running a build
+func (e *executor) started() time.Time {
+	if e.Idle || e.CurrentExecutable == nil || e.CurrentExecutable.Timestamp <= 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, e.CurrentExecutable.Timestamp*int64(time.Millisecond))
+}
+
+// ExecutorThresholds describes when an agent that is online is reported as
+// stuck. Thresholds that are zero are not checked.
+type ExecutorThresholds struct {
+	// MaxBuildDuration is the longest a single build may run on the agent
+	MaxBuildDuration time.Duration
+	// MaxBusyDuration is the longest every executor of the agent may be
+	// busy at the same time
+	MaxBusyDuration time.Duration
+}
+
+// problems returns a description of each threshold the executors of a node
+// exceed at the time now
+func (e *ExecutorThresholds) problems(executors []executor, now time.Time) []string {
+	result := []string{}
+	if len(executors) == 0 {
+		return result
+	}
+
+	allBusy := true
+	var busy time.Duration
+
+	for _, ex := range executors {
+		started := ex.started()
+		if started.IsZero() {
+			allBusy = false
+			continue
+		}
+
+		running := now.Sub(started).Round(time.Second)
+		if busy == 0 || running < busy {
+			busy = running
+		}
+
+		if e.MaxBuildDuration > 0 && running > e.MaxBuildDuration {
+			result = append(result, fmt.Sprintf("Build %s has been running for %s, above %s", ex.CurrentExecutable.URL, running, e.MaxBuildDuration))
+		}
+	}
+
+	if e.MaxBusyDuration > 0 && allBusy && busy > e.MaxBusyDuration {
+		result = append(result, fmt.Sprintf("All %d executors have been busy for %s, above %s", len(executors), busy, e.MaxBusyDuration))
+	}
+
+	return result
+}
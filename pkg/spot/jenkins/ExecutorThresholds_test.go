@@ -0,0 +1,53 @@
+package jenkins
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var executorsNow = time.Date(2018, 9, 1, 12, 0, 0, 0, time.UTC)
+
+func busy(url string, running time.Duration) executor {
+	return executor{CurrentExecutable: &executable{URL: url, Timestamp: executorsNow.Add(-running).UnixNano() / int64(time.Millisecond)}}
+}
+
+func TestExecutorProblems_NoExecutors(t *testing.T) {
+	sut := &ExecutorThresholds{MaxBuildDuration: time.Hour, MaxBusyDuration: time.Hour}
+
+	require.Empty(t, sut.problems(nil, executorsNow))
+}
+
+func TestExecutorProblems_LongRunningBuild(t *testing.T) {
+	sut := &ExecutorThresholds{MaxBuildDuration: 4 * time.Hour}
+
+	require.Equal(t, []string{
+		"Build http://jenkins/job/a/1/ has been running for 20h0m0s, above 4h0m0s",
+	}, sut.problems([]executor{
+		busy("http://jenkins/job/a/1/", 20*time.Hour),
+		busy("http://jenkins/job/b/1/", time.Hour),
+		{Idle: true},
+	}, executorsNow))
+}
+
+func TestExecutorProblems_AllBusy(t *testing.T) {
+	sut := &ExecutorThresholds{MaxBusyDuration: 2 * time.Hour}
+
+	require.Equal(t, []string{
+		"All 2 executors have been busy for 3h0m0s, above 2h0m0s",
+	}, sut.problems([]executor{
+		busy("http://jenkins/job/a/1/", 5*time.Hour),
+		busy("http://jenkins/job/b/1/", 3*time.Hour),
+	}, executorsNow))
+
+	require.Empty(t, sut.problems([]executor{
+		busy("http://jenkins/job/a/1/", 5*time.Hour),
+		busy("http://jenkins/job/b/1/", time.Hour),
+	}, executorsNow))
+
+	require.Empty(t, sut.problems([]executor{
+		busy("http://jenkins/job/a/1/", 5*time.Hour),
+		{Idle: true},
+	}, executorsNow))
+}
@@ -0,0 +1,70 @@
+package jenkins
+
+import (
+	"regexp"
+)
+
+// DefaultClasses returns the agent classes a Filter without classes
+// accepts
+func DefaultClasses() []string {
+	return []string{
+		"hudson.slaves.SlaveComputer",
+	}
+}
+
+// Filter selects which agents an OfflineAgentDetector considers. Agents
+// must pass every part of the filter that is set.
+type Filter struct {
+	// Classes are the agent classes to consider. DefaultClasses are used if
+	// it is empty.
+	Classes []string
+	// Labels must all be assigned to an agent for it to be considered
+	Labels []string
+	// Include, if set, must match the agent's name
+	Include *regexp.Regexp
+	// Exclude, if set, must not match the agent's name
+	Exclude *regexp.Regexp
+}
+
+func (f *Filter) classes() []string {
+	if len(f.Classes) == 0 {
+		return DefaultClasses()
+	}
+
+	return f.Classes
+}
+
+// skip returns why a node does not pass the filter, or an empty string if
+// it does
+func (f *Filter) skip(n *node) string {
+	if !contains(f.classes(), n.Class) {
+		return "class not whitelisted"
+	}
+
+	labels := n.labels()
+	for _, label := range f.Labels {
+		if !contains(labels, label) {
+			return "label not assigned"
+		}
+	}
+
+	if f.Include != nil && !f.Include.MatchString(n.DisplayName) {
+		return "name not included"
+	}
+
+	if f.Exclude != nil && f.Exclude.MatchString(n.DisplayName) {
+		return "name excluded"
+	}
+
+	return ""
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
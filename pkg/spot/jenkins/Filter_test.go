@@ -0,0 +1,43 @@
+package jenkins
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSkip_DefaultClasses(t *testing.T) {
+	sut := &Filter{}
+
+	require.Empty(t, sut.skip(&node{Class: "hudson.slaves.SlaveComputer"}))
+	require.Equal(t, "class not whitelisted", sut.skip(&node{Class: "hudson.model.Hudson$MasterComputer"}))
+}
+
+func TestSkip_Classes(t *testing.T) {
+	sut := &Filter{Classes: []string{"hudson.slaves.KubernetesSlave"}}
+
+	require.Empty(t, sut.skip(&node{Class: "hudson.slaves.KubernetesSlave"}))
+	require.Equal(t, "class not whitelisted", sut.skip(&node{Class: "hudson.slaves.SlaveComputer"}))
+}
+
+func TestSkip_Labels(t *testing.T) {
+	sut := &Filter{Labels: []string{"windows", "docker"}}
+
+	require.Empty(t, sut.skip(&node{
+		Class:          "hudson.slaves.SlaveComputer",
+		AssignedLabels: []label{{Name: "docker"}, {Name: "windows"}, {Name: "win-1"}},
+	}))
+	require.Equal(t, "label not assigned", sut.skip(&node{
+		Class:          "hudson.slaves.SlaveComputer",
+		AssignedLabels: []label{{Name: "windows"}},
+	}))
+}
+
+func TestSkip_IncludeExclude(t *testing.T) {
+	sut := &Filter{Include: regexp.MustCompile("^win-"), Exclude: regexp.MustCompile("-test$")}
+
+	require.Empty(t, sut.skip(&node{Class: "hudson.slaves.SlaveComputer", DisplayName: "win-1"}))
+	require.Equal(t, "name not included", sut.skip(&node{Class: "hudson.slaves.SlaveComputer", DisplayName: "linux-1"}))
+	require.Equal(t, "name excluded", sut.skip(&node{Class: "hudson.slaves.SlaveComputer", DisplayName: "win-test"}))
+}
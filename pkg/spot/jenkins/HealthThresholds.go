@@ -0,0 +1,90 @@
+package jenkins
+
+import (
+	"fmt"
+	"time"
+)
+
+const bytesPerGB = 1024 * 1024 * 1024
+
+type spaceMonitor struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+type clockMonitor struct {
+	// Diff is the clock difference to the controller in milliseconds
+	Diff int64 `json:"diff"`
+}
+
+type responseTimeMonitor struct {
+	// Average is the average response time in milliseconds
+	Average int64 `json:"average"`
+}
+
+// monitorData holds the node monitor results jenkins tracks for each node.
+// Monitors that are disabled or have not run yet are nil.
+type monitorData struct {
+	DiskSpace    *spaceMonitor        `json:"hudson.node_monitors.DiskSpaceMonitor"`
+	TempSpace    *spaceMonitor        `json:"hudson.node_monitors.TemporarySpaceMonitor"`
+	Clock        *clockMonitor        `json:"hudson.node_monitors.ClockMonitor"`
+	ResponseTime *responseTimeMonitor `json:"hudson.node_monitors.ResponseTimeMonitor"`
+}
+
+// HealthThresholds describes when an agent that is online is reported as
+// degraded. Thresholds that are zero are not checked.
+type HealthThresholds struct {
+	// MinDiskSpace is the least free space in bytes the agent's workspace
+	// may have
+	MinDiskSpace int64
+	// MinTempSpace is the least free space in bytes the agent's temporary
+	// directory may have
+	MinTempSpace int64
+	// MaxClockDifference is how far the agent's clock may drift from the
+	// jenkins controller's clock in either direction
+	MaxClockDifference time.Duration
+	// MaxResponseTime is the longest average time the agent may take to
+	// respond to the controller
+	MaxResponseTime time.Duration
+}
+
+func gigabytes(bytes int64) string {
+	return fmt.Sprintf("%.1f GB", float64(bytes)/bytesPerGB)
+}
+
+// problems returns a description of each threshold the node monitor data
+// exceeds
+func (h *HealthThresholds) problems(data *monitorData) []string {
+	result := []string{}
+	if data == nil {
+		return result
+	}
+
+	if h.MinDiskSpace > 0 && data.DiskSpace != nil && data.DiskSpace.Size < h.MinDiskSpace {
+		result = append(result, fmt.Sprintf("Free disk space on %s is %s, below %s", data.DiskSpace.Path, gigabytes(data.DiskSpace.Size), gigabytes(h.MinDiskSpace)))
+	}
+
+	if h.MinTempSpace > 0 && data.TempSpace != nil && data.TempSpace.Size < h.MinTempSpace {
+		result = append(result, fmt.Sprintf("Free temp space on %s is %s, below %s", data.TempSpace.Path, gigabytes(data.TempSpace.Size), gigabytes(h.MinTempSpace)))
+	}
+
+	if h.MaxClockDifference > 0 && data.Clock != nil {
+		diff := time.Duration(data.Clock.Diff) * time.Millisecond
+		if diff < 0 {
+			diff = -diff
+		}
+
+		if diff > h.MaxClockDifference {
+			result = append(result, fmt.Sprintf("Clock is off by %s, above %s", diff, h.MaxClockDifference))
+		}
+	}
+
+	if h.MaxResponseTime > 0 && data.ResponseTime != nil {
+		average := time.Duration(data.ResponseTime.Average) * time.Millisecond
+		if average > h.MaxResponseTime {
+			result = append(result, fmt.Sprintf("Response time is %s, above %s", average, h.MaxResponseTime))
+		}
+	}
+
+	return result
+}
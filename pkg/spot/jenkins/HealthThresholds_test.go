@@ -0,0 +1,62 @@
+package jenkins
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProblems_NoMonitorData(t *testing.T) {
+	sut := &HealthThresholds{MinDiskSpace: bytesPerGB}
+
+	require.Empty(t, sut.problems(nil))
+	require.Empty(t, sut.problems(&monitorData{}))
+}
+
+func TestProblems_WithinThresholds(t *testing.T) {
+	sut := &HealthThresholds{
+		MinDiskSpace:       10 * bytesPerGB,
+		MinTempSpace:       bytesPerGB,
+		MaxClockDifference: 30 * time.Second,
+		MaxResponseTime:    5 * time.Second,
+	}
+
+	require.Empty(t, sut.problems(&monitorData{
+		DiskSpace:    &spaceMonitor{Path: "/var/jenkins", Size: 20 * bytesPerGB},
+		TempSpace:    &spaceMonitor{Path: "/tmp", Size: 2 * bytesPerGB},
+		Clock:        &clockMonitor{Diff: -29000},
+		ResponseTime: &responseTimeMonitor{Average: 120},
+	}))
+}
+
+func TestProblems_ExceedsThresholds(t *testing.T) {
+	sut := &HealthThresholds{
+		MinDiskSpace:       10 * bytesPerGB,
+		MinTempSpace:       bytesPerGB,
+		MaxClockDifference: 30 * time.Second,
+		MaxResponseTime:    5 * time.Second,
+	}
+
+	require.Equal(t, []string{
+		"Free disk space on /var/jenkins is 2.5 GB, below 10.0 GB",
+		"Free temp space on /tmp is 0.5 GB, below 1.0 GB",
+		"Clock is off by 45s, above 30s",
+		"Response time is 6s, above 5s",
+	}, sut.problems(&monitorData{
+		DiskSpace:    &spaceMonitor{Path: "/var/jenkins", Size: 5 * bytesPerGB / 2},
+		TempSpace:    &spaceMonitor{Path: "/tmp", Size: bytesPerGB / 2},
+		Clock:        &clockMonitor{Diff: -45000},
+		ResponseTime: &responseTimeMonitor{Average: 6000},
+	}))
+}
+
+func TestProblems_ZeroThresholdsAreNotChecked(t *testing.T) {
+	sut := &HealthThresholds{}
+
+	require.Empty(t, sut.problems(&monitorData{
+		DiskSpace:    &spaceMonitor{Path: "/var/jenkins", Size: 0},
+		Clock:        &clockMonitor{Diff: 3600000},
+		ResponseTime: &responseTimeMonitor{Average: 60000},
+	}))
+}
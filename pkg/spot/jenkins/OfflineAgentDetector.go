@@ -1,29 +1,128 @@
 package jenkins
 
 import (
-	"encoding/json"
 	"fmt"
-	"net/http"
 	"strings"
+	"time"
 
+	"github.com/hylandsoftware/spot/pkg/spot"
+	"github.com/hylandsoftware/spot/pkg/spot/redact"
 	"github.com/sirupsen/logrus"
 )
 
 const (
-	nodeAPICall = "computer/api/json?tree=computer[displayName,offline,offlineCauseReason]"
+	nodeAPICall    = "computer/api/json?tree=computer[%s]"
+	nodeFields     = "displayName,offline,temporarilyOffline,launchSupported,offlineCauseReason,offlineCause[user[id,fullName]],assignedLabels[name]"
+	healthFields   = "monitorData[*]"
+	executorFields = "executors[idle,currentExecutable[url,timestamp]]"
 )
 
-var (
-	classWhitelist = []string{
-		"hudson.slaves.SlaveComputer",
-	}
+const (
+	// TemporarilyOfflineReport reports agents that were marked temporarily
+	// offline like any other offline agent. This is the default.
+	TemporarilyOfflineReport = "report"
+	// TemporarilyOfflineDowngrade reports agents that were marked
+	// temporarily offline with spot.SeverityWarning
+	TemporarilyOfflineDowngrade = "downgrade"
+	// TemporarilyOfflineIgnore does not report agents that were marked
+	// temporarily offline
+	TemporarilyOfflineIgnore = "ignore"
 )
 
+type label struct {
+	Name string `json:"name"`
+}
+
+type user struct {
+	ID       string `json:"id"`
+	FullName string `json:"fullName"`
+}
+
+// manualCauses are the classes of offline causes that mean someone took a
+// node offline. Jenkins also marks nodes temporarily offline on its own,
+// e.g. when a node monitor finds that a node is low on disk space.
+var manualCauses = []string{
+	"hudson.slaves.OfflineCause$UserCause",
+	"hudson.slaves.OfflineCause$ByCLI",
+}
+
+type offlineCause struct {
+	Class string `json:"_class"`
+	User  *user  `json:"user"`
+}
+
 type node struct {
-	Class              string `json:"_class"`
-	DisplayName        string `json:"displayName"`
-	Offline            bool   `json:"offline"`
-	OfflineCauseReason string `json:"offlineCauseReason"`
+	Class              string        `json:"_class"`
+	DisplayName        string        `json:"displayName"`
+	Offline            bool          `json:"offline"`
+	TemporarilyOffline bool          `json:"temporarilyOffline"`
+	LaunchSupported    bool          `json:"launchSupported"`
+	OfflineCauseReason string        `json:"offlineCauseReason"`
+	OfflineCause       *offlineCause `json:"offlineCause"`
+	AssignedLabels     []label       `json:"assignedLabels"`
+	MonitorData        *monitorData  `json:"monitorData"`
+	Executors          []executor    `json:"executors"`
+}
+
+// offlineBy returns who marked the node temporarily offline, if known
+func (n *node) offlineBy() string {
+	if n.OfflineCause == nil || n.OfflineCause.User == nil {
+		return ""
+	}
+
+	if n.OfflineCause.User.FullName != "" {
+		return n.OfflineCause.User.FullName
+	}
+
+	return n.OfflineCause.User.ID
+}
+
+// manual returns true if someone marked the node temporarily offline.
+// Nodes whose offline cause is unknown are assumed to be marked by someone.
+func (n *node) manual() bool {
+	if !n.TemporarilyOffline {
+		return false
+	}
+
+	if n.OfflineCause == nil || n.OfflineCause.Class == "" {
+		return true
+	}
+
+	for _, class := range manualCauses {
+		if n.OfflineCause.Class == class {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reason describes why the node is offline, including who marked it
+// temporarily offline
+func (n *node) reason() string {
+	if !n.manual() {
+		return n.OfflineCauseReason
+	}
+
+	result := "Marked temporarily offline"
+	if by := n.offlineBy(); by != "" {
+		result = fmt.Sprintf("%s by %s", result, by)
+	}
+
+	if n.OfflineCauseReason != "" {
+		result = fmt.Sprintf("%s: %s", result, n.OfflineCauseReason)
+	}
+
+	return result
+}
+
+func (n *node) labels() []string {
+	result := []string{}
+	for _, l := range n.AssignedLabels {
+		result = append(result, l.Name)
+	}
+
+	return result
 }
 
 type jenkinsResponse struct {
@@ -31,21 +130,47 @@ type jenkinsResponse struct {
 }
 
 // OfflineAgentDetector is a spot.OfflineAgentDetector for watching
-// Jenkins agents. If a Username and password are provided, API requests
-// will use HTTP Basic authentication with the provided credentials.
+// Jenkins agents. If a Username and password or API token are provided,
+// API requests will use HTTP Basic authentication with the provided
+// credentials.
 type OfflineAgentDetector struct {
 	APIEndpoint string
 	Username    string
 	Password    string
+	// Token is the API token used instead of Password, if any
+	Token string
 
-	api *http.Client
-	log *logrus.Entry
-}
+	// Filter selects which agents are considered
+	Filter Filter
+
+	// Cloud controls how agents provisioned by a cloud are reported
+	Cloud CloudAgents
+
+	// TemporarilyOffline controls how agents that someone deliberately
+	// marked temporarily offline are reported. It is one of
+	// TemporarilyOfflineReport, TemporarilyOfflineDowngrade or
+	// TemporarilyOfflineIgnore. Agents are reported if it is empty. Agents
+	// that jenkins marked temporarily offline on its own are always reported.
+	TemporarilyOffline string
+
+	// Health, if set, also reports agents that are online but exceed one of
+	// its thresholds as degraded
+	Health *HealthThresholds
+
+	// Executors, if set, also reports agents that are online but whose
+	// executors exceed one of its thresholds as stuck
+	Executors *ExecutorThresholds
 
-// UseClassWhitelist sets the class whitelist to filter offline agents by.
-func UseClassWhitelist(whitelist []string) {
-	logrus.WithField("whitelist", whitelist).Warning("The default class whitelist has been overridden")
-	classWhitelist = whitelist
+	// Queue, if set, also reports labels whose builds have been waiting in
+	// the build queue for longer than its thresholds as starved
+	Queue *QueueThresholds
+
+	// Reconnect, if set, reconnects agents that went offline on their own
+	Reconnect *Remediation
+
+	client *Client
+	log    *logrus.Entry
+	now    func() time.Time
 }
 
 // NewDetectorFromArg parses a configuration string into a
@@ -70,7 +195,7 @@ func NewDetectorFromArg(arg string) (*OfflineAgentDetector, error) {
 	case 3:
 		return NewDetector(parts[0], parts[1], parts[2]), nil
 	default:
-		return nil, fmt.Errorf("The format of the config string was not recognized: %s", arg)
+		return nil, fmt.Errorf("The format of the config string for %s was not recognized, expected <url> or <url>,<username>,<password>", redact.String(parts[0]))
 	}
 }
 
@@ -85,39 +210,48 @@ func NewDetector(endpoint, un, pw string) *OfflineAgentDetector {
 		Username:    un,
 		Password:    pw,
 
-		api: &http.Client{},
+		client: NewClient(endpoint, un, pw),
+		now:    time.Now,
 	}
 
 	result.log = logrus.WithField("detector", result.Name())
 	return result
 }
 
+// NewTokenDetector constructs an OfflineAgentDetector that authenticates
+// with an API token instead of a password
+func NewTokenDetector(endpoint, un, token string) *OfflineAgentDetector {
+	result := NewDetector(endpoint, un, "")
+	result.Token = token
+	result.client = NewTokenClient(result.APIEndpoint, un, token)
+	return result
+}
+
 func (j *OfflineAgentDetector) queryAPI() ([]node, error) {
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/%s", j.APIEndpoint, nodeAPICall), nil)
-	if err != nil {
-		return nil, err
+	fields := []string{nodeFields}
+	if j.Health != nil {
+		fields = append(fields, healthFields)
 	}
 
-	if j.Username != "" && j.Password != "" {
-		req.SetBasicAuth(j.Username, j.Password)
+	if j.Executors != nil {
+		fields = append(fields, executorFields)
 	}
 
-	resp, err := j.api.Do(req)
-	if err != nil {
+	response := &jenkinsResponse{}
+	if err := j.client.Get(fmt.Sprintf(nodeAPICall, strings.Join(fields, ",")), response); err != nil {
 		return nil, err
 	}
 
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("Request failed: %s", resp.Status)
-	}
+	return response.Computers, nil
+}
 
-	response := &jenkinsResponse{}
-	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+func (j *OfflineAgentDetector) queryQueue() ([]queueItem, error) {
+	response := &queueResponse{}
+	if err := j.client.Get(queueAPICall, response); err != nil {
 		return nil, err
 	}
 
-	return response.Computers, nil
+	return response.Items, nil
 }
 
 // Name implements spot.OfflineAgentDetector.Name by returning
@@ -128,13 +262,24 @@ func (j *OfflineAgentDetector) Name() string {
 
 // FindOfflineAgents implements spot.OfflineAgentDetector.FindOfflineAgents
 // by querying the jenkins computer API endpoint and returning any nodes
-// that have their Offline property set to true.
-func (j *OfflineAgentDetector) FindOfflineAgents() ([]string, error) {
-	if j.api == nil {
+// that have their Offline property set to true. If Health is set, nodes
+// that are online but unhealthy are returned as degraded. If Executors is
+// set, nodes that are online but busy for too long are returned as stuck.
+// If Queue is set, labels whose builds wait in the queue for too long are
+// returned as starved. If Reconnect is set, offline nodes are reconnected.
+func (j *OfflineAgentDetector) FindOfflineAgents() ([]spot.Agent, error) {
+	return j.CheckOfflineAgents(true)
+}
+
+// CheckOfflineAgents implements spot.RemediatingDetector.CheckOfflineAgents
+// by finding offline agents like FindOfflineAgents, only reconnecting them
+// if remediate is true
+func (j *OfflineAgentDetector) CheckOfflineAgents(remediate bool) ([]spot.Agent, error) {
+	if j.client == nil {
 		return nil, fmt.Errorf("Use spot.NewJenkinsDetector(...) to construct a JenkinsOfflineAgentDetector")
 	}
 
-	offline := []string{}
+	offline := []spot.Agent{}
 	nodes, err := j.queryAPI()
 	if err != nil {
 		return nil, err
@@ -144,30 +289,121 @@ func (j *OfflineAgentDetector) FindOfflineAgents() ([]string, error) {
 		j.log.Warn("No agents found")
 	}
 
+	filter := j.Filter
+	if j.Cloud.GracePeriod > 0 {
+		// Cloud agents are considered even if their class is not whitelisted
+		filter.Classes = append(append([]string{}, filter.classes()...), j.Cloud.classes()...)
+	}
+
 	for _, node := range nodes {
-		whitelisted := false
-		for _, class := range classWhitelist {
-			if node.Class == class {
-				whitelisted = true
-				break
-			}
-		}
+		cloud := j.Cloud.matches(&node)
 
-		if !whitelisted {
+		if cloud && j.Cloud.GracePeriod <= 0 {
+			j.log.WithFields(logrus.Fields{
+				"agent": node.DisplayName,
+				"class": node.Class,
+			}).Debug("Skipping agent (cloud agent)")
+		} else if skip := filter.skip(&node); skip != "" {
 			j.log.WithFields(logrus.Fields{
 				"agent": node.DisplayName,
 				"class": node.Class,
-			}).Debug("Skipping agent (class not whitelisted)")
+			}).Debugf("Skipping agent (%s)", skip)
+		} else if node.manual() && j.TemporarilyOffline == TemporarilyOfflineIgnore {
+			j.log.WithFields(logrus.Fields{
+				"agent":  node.DisplayName,
+				"reason": node.reason(),
+			}).Debug("Skipping agent (temporarily offline)")
 		} else if node.Offline {
+			agent := spot.Agent{
+				Name:   node.DisplayName,
+				Reason: node.reason(),
+				Class:  node.Class,
+				Labels: node.labels(),
+				Manual: node.manual(),
+			}
+
+			if agent.Manual && j.TemporarilyOffline == TemporarilyOfflineDowngrade {
+				agent.Severity = spot.SeverityWarning
+			}
+
+			if cloud {
+				agent.GracePeriod = j.Cloud.GracePeriod
+			}
+
+			if j.Reconnect != nil {
+				agent.Remediation = j.Reconnect.remediate(j.client, &node, j.now(), remediate, j.log)
+			}
+
 			j.log.WithFields(logrus.Fields{
 				"agent":  node.DisplayName,
-				"reason": node.OfflineCauseReason,
+				"reason": agent.Reason,
 			}).Warn("Found an offline agent")
-			offline = append(offline, node.DisplayName)
+			offline = append(offline, agent)
+		} else if degraded, stuck := j.problems(node); len(degraded)+len(stuck) > 0 {
+			agent := spot.Agent{
+				Name:     node.DisplayName,
+				Reason:   strings.Join(append(degraded, stuck...), "; "),
+				Class:    node.Class,
+				Labels:   node.labels(),
+				Degraded: len(degraded) > 0,
+				Stuck:    len(stuck) > 0,
+			}
+
+			j.log.WithFields(logrus.Fields{
+				"agent":  node.DisplayName,
+				"reason": agent.Reason,
+			}).Warn("Found an unhealthy agent")
+			offline = append(offline, agent)
 		} else {
 			j.log.WithField("agent", node.DisplayName).Debug("Node is online")
 		}
 	}
 
+	if j.Reconnect != nil {
+		names := map[string]bool{}
+		for _, agent := range offline {
+			if !agent.Degraded && !agent.Stuck {
+				names[agent.Name] = true
+			}
+		}
+
+		j.Reconnect.forget(j.client, names, j.log)
+	}
+
+	if j.Queue == nil {
+		return offline, nil
+	}
+
+	// The agents found so far are still reported if the queue cannot be
+	// queried
+	items, err := j.queryQueue()
+	if err != nil {
+		return offline, &spot.PartialError{Err: fmt.Errorf("Failed to query the build queue: %s", err.Error())}
+	}
+
+	for _, starved := range j.Queue.starved(items, offline, j.now()) {
+		j.log.WithFields(logrus.Fields{
+			"agent":  starved.Name,
+			"reason": starved.Reason,
+		}).Warn("Found builds starved of executors")
+		offline = append(offline, starved)
+	}
+
 	return offline, nil
 }
+
+// problems returns the health and executor thresholds an online node
+// exceeds, if Health and Executors are set
+func (j *OfflineAgentDetector) problems(n node) ([]string, []string) {
+	degraded, stuck := []string{}, []string{}
+
+	if j.Health != nil {
+		degraded = j.Health.problems(n.MonitorData)
+	}
+
+	if j.Executors != nil {
+		stuck = j.Executors.problems(n.Executors, j.now())
+	}
+
+	return degraded, stuck
+}
@@ -5,8 +5,11 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
 	"testing"
+	"time"
 
+	"github.com/hylandsoftware/spot/pkg/spot"
 	"github.com/stretchr/testify/require"
 )
 
@@ -29,6 +32,15 @@ func mockJenkins(un, pw string) (*mockJenkinsServer, *OfflineAgentDetector) {
 	}, NewDetector(s.URL, un, pw)
 }
 
+func names(agents []spot.Agent) []string {
+	result := []string{}
+	for _, agent := range agents {
+		result = append(result, agent.Name)
+	}
+
+	return result
+}
+
 func TestNewJenkinsDetectorFromArg_ErrorForEmpty(t *testing.T) {
 	_, err := NewDetectorFromArg("")
 
@@ -38,7 +50,8 @@ func TestNewJenkinsDetectorFromArg_ErrorForEmpty(t *testing.T) {
 func TestNewJenkinsDetectorFromArg_ErrorForMalformatted(t *testing.T) {
 	_, err := NewDetectorFromArg("http://foo,bar,baz,fizz,buzz")
 
-	require.EqualError(t, err, fmt.Sprintf("The format of the config string was not recognized: %s", "http://foo,bar,baz,fizz,buzz"))
+	require.EqualError(t, err, fmt.Sprintf("The format of the config string for %s was not recognized, expected <url> or <url>,<username>,<password>", "http://foo"))
+	require.NotContains(t, err.Error(), "baz")
 }
 
 func TestNewJenkinsDetectorFromArg_NoCredentials(t *testing.T) {
@@ -78,7 +91,7 @@ func TestFindOfflineAgents_Query_BadEndpoint(t *testing.T) {
 
 	_, err := sut.FindOfflineAgents()
 
-	require.EqualError(t, err, "parse ://foo/computer/api/json?tree=computer[displayName,offline,offlineCauseReason]: missing protocol scheme")
+	require.EqualError(t, err, `parse "://foo/computer/api/json?tree=computer[displayName,offline,temporarilyOffline,launchSupported,offlineCauseReason,offlineCause[user[id,fullName]],assignedLabels[name]]": missing protocol scheme`)
 }
 
 func TestFindOfflineAgents_Query_NonSuccess(t *testing.T) {
@@ -178,9 +191,9 @@ func TestFindOfflineAgents_MarksOfflineAgents(t *testing.T) {
 	result, err := sut.FindOfflineAgents()
 
 	require.NoError(t, err)
-	require.Contains(t, result, "agent2")
-	require.Contains(t, result, "agent3")
-	require.NotContains(t, result, "agent1")
+	require.Contains(t, names(result), "agent2")
+	require.Contains(t, names(result), "agent3")
+	require.NotContains(t, names(result), "agent1")
 }
 
 func TestFindOfflineAgents_ExcludesNonWhitelistedClasses(t *testing.T) {
@@ -213,7 +226,7 @@ func TestFindOfflineAgents_ExcludesNonWhitelistedClasses(t *testing.T) {
 	result, err := sut.FindOfflineAgents()
 
 	require.NoError(t, err)
-	require.NotContains(t, result, "agent1")
+	require.NotContains(t, names(result), "agent1")
 }
 
 func TestFindOfflineAgents_CustomWhitelistedClasses(t *testing.T) {
@@ -249,10 +262,483 @@ func TestFindOfflineAgents_CustomWhitelistedClasses(t *testing.T) {
 		`)
 	})
 
-	UseClassWhitelist([]string{"hudson.slaves.KubernetesSlave"})
+	sut.Filter.Classes = []string{"hudson.slaves.KubernetesSlave"}
+	result, err := sut.FindOfflineAgents()
+
+	require.NoError(t, err)
+	require.Contains(t, names(result), "agent1")
+	require.NotContains(t, names(result), "agent2")
+}
+
+func TestFindOfflineAgents_FiltersAreIndependent(t *testing.T) {
+	jenkins, windows := mockJenkins("fizz", "buzz")
+	defer jenkins.teardown()
+
+	jenkins.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `
+			{
+				"_class":"hudson.model.ComputerSet",
+				"computer":[
+					{
+						"_class":"hudson.slaves.SlaveComputer",
+						"displayName":"win-1",
+						"offline":true,
+						"assignedLabels":[{"name":"windows"},{"name":"docker"}]
+					},
+					{
+						"_class":"hudson.slaves.SlaveComputer",
+						"displayName":"win-2",
+						"offline":true,
+						"assignedLabels":[{"name":"windows"}]
+					},
+					{
+						"_class":"hudson.slaves.SlaveComputer",
+						"displayName":"linux-1",
+						"offline":true,
+						"assignedLabels":[{"name":"linux"}]
+					}
+				]
+			}
+		`)
+	})
+
+	windows.Filter = Filter{Labels: []string{"windows"}, Exclude: regexp.MustCompile("-2$")}
+	all := NewDetector(jenkins.server.URL, "fizz", "buzz")
+
+	results := make(chan []string, 2)
+	for _, sut := range []*OfflineAgentDetector{windows, all} {
+		go func(sut *OfflineAgentDetector) {
+			result, err := sut.FindOfflineAgents()
+			require.NoError(t, err)
+			results <- names(result)
+		}(sut)
+	}
+
+	require.ElementsMatch(t, [][]string{{"win-1"}, {"win-1", "win-2", "linux-1"}}, [][]string{<-results, <-results})
+}
+
+func TestFindOfflineAgents_IncludesAgentDetails(t *testing.T) {
+	jenkins, sut := mockJenkins("fizz", "buzz")
+	defer jenkins.teardown()
+
+	jenkins.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `
+			{
+				"_class":"hudson.model.ComputerSet",
+				"computer":[
+					{
+						"_class":"hudson.slaves.SlaveComputer",
+						"displayName":"agent1",
+						"offline":true,
+						"offlineCauseReason":"testing",
+						"assignedLabels":[{"name":"agent1"},{"name":"windows"}]
+					}
+				]
+			}
+		`)
+	})
+
+	result, err := sut.FindOfflineAgents()
+
+	require.NoError(t, err)
+	require.Equal(t, []spot.Agent{{
+		Name:   "agent1",
+		Reason: "testing",
+		Class:  "hudson.slaves.SlaveComputer",
+		Labels: []string{"agent1", "windows"},
+	}}, result)
+}
+
+const temporarilyOfflineResponse = `
+	{
+		"_class":"hudson.model.ComputerSet",
+		"computer":[
+			{
+				"_class":"hudson.slaves.SlaveComputer",
+				"displayName":"agent1",
+				"offline":true,
+				"temporarilyOffline":false,
+				"offlineCauseReason":"Connection was broken",
+				"offlineCause":{"_class":"hudson.slaves.OfflineCause$ChannelTermination"}
+			},
+			{
+				"_class":"hudson.slaves.SlaveComputer",
+				"displayName":"agent2",
+				"offline":true,
+				"temporarilyOffline":true,
+				"offlineCauseReason":"patching",
+				"offlineCause":{
+					"_class":"hudson.slaves.OfflineCause$UserCause",
+					"user":{"id":"alice","fullName":"Alice Smith"}
+				}
+			},
+			{
+				"_class":"hudson.slaves.SlaveComputer",
+				"displayName":"agent3",
+				"offline":true,
+				"temporarilyOffline":true,
+				"offlineCauseReason":""
+			},
+			{
+				"_class":"hudson.slaves.SlaveComputer",
+				"displayName":"agent4",
+				"offline":true,
+				"temporarilyOffline":true,
+				"offlineCauseReason":"Disk space is too low",
+				"offlineCause":{"_class":"hudson.node_monitors.DiskSpaceMonitorDescriptor$DiskSpace"}
+			}
+		]
+	}
+`
+
+func TestFindOfflineAgents_TemporarilyOffline(t *testing.T) {
+	jenkins, sut := mockJenkins("fizz", "buzz")
+	defer jenkins.teardown()
+
+	jenkins.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, temporarilyOfflineResponse)
+	})
+
+	for _, policy := range []string{"", TemporarilyOfflineReport} {
+		sut.TemporarilyOffline = policy
+		result, err := sut.FindOfflineAgents()
+
+		require.NoError(t, err)
+		require.Equal(t, []spot.Agent{
+			{Name: "agent1", Reason: "Connection was broken", Class: "hudson.slaves.SlaveComputer", Labels: []string{}},
+			{Name: "agent2", Reason: "Marked temporarily offline by Alice Smith: patching", Class: "hudson.slaves.SlaveComputer", Labels: []string{}, Manual: true},
+			{Name: "agent3", Reason: "Marked temporarily offline", Class: "hudson.slaves.SlaveComputer", Labels: []string{}, Manual: true},
+			{Name: "agent4", Reason: "Disk space is too low", Class: "hudson.slaves.SlaveComputer", Labels: []string{}},
+		}, result)
+	}
+}
+
+func TestFindOfflineAgents_TemporarilyOfflineDowngrade(t *testing.T) {
+	jenkins, sut := mockJenkins("fizz", "buzz")
+	defer jenkins.teardown()
+
+	jenkins.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, temporarilyOfflineResponse)
+	})
+
+	sut.TemporarilyOffline = TemporarilyOfflineDowngrade
+	result, err := sut.FindOfflineAgents()
+
+	require.NoError(t, err)
+	require.Equal(t, []string{"", spot.SeverityWarning, spot.SeverityWarning, ""}, []string{result[0].Severity, result[1].Severity, result[2].Severity, result[3].Severity})
+}
+
+func TestFindOfflineAgents_TemporarilyOfflineIgnore(t *testing.T) {
+	jenkins, sut := mockJenkins("fizz", "buzz")
+	defer jenkins.teardown()
+
+	jenkins.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, temporarilyOfflineResponse)
+	})
+
+	sut.TemporarilyOffline = TemporarilyOfflineIgnore
+	result, err := sut.FindOfflineAgents()
+
+	require.NoError(t, err)
+	require.Equal(t, []string{"agent1", "agent4"}, names(result))
+}
+
+func TestFindOfflineAgents_ReportsDegradedAgents(t *testing.T) {
+	jenkins, sut := mockJenkins("fizz", "buzz")
+	defer jenkins.teardown()
+
+	jenkins.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		require.Contains(t, r.URL.RawQuery, "monitorData[*]")
+
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `
+			{
+				"_class":"hudson.model.ComputerSet",
+				"computer":[
+					{
+						"_class":"hudson.slaves.SlaveComputer",
+						"displayName":"agent1",
+						"offline":false,
+						"monitorData":{
+							"hudson.node_monitors.DiskSpaceMonitor":{"path":"/var/jenkins","size":1073741824},
+							"hudson.node_monitors.ClockMonitor":{"diff":120000},
+							"hudson.node_monitors.ResponseTimeMonitor":null
+						}
+					},
+					{
+						"_class":"hudson.slaves.SlaveComputer",
+						"displayName":"agent2",
+						"offline":false,
+						"monitorData":{
+							"hudson.node_monitors.DiskSpaceMonitor":{"path":"/var/jenkins","size":107374182400}
+						}
+					},
+					{
+						"_class":"hudson.slaves.SlaveComputer",
+						"displayName":"agent3",
+						"offline":true,
+						"offlineCauseReason":"testing",
+						"monitorData":{}
+					}
+				]
+			}
+		`)
+	})
+
+	sut.Health = &HealthThresholds{MinDiskSpace: 10 * bytesPerGB, MaxClockDifference: time.Minute}
 	result, err := sut.FindOfflineAgents()
 
 	require.NoError(t, err)
-	require.Contains(t, result, "agent1")
-	require.NotContains(t, result, "agent2")
+	require.Equal(t, []spot.Agent{
+		{Name: "agent1", Reason: "Free disk space on /var/jenkins is 1.0 GB, below 10.0 GB; Clock is off by 2m0s, above 1m0s", Class: "hudson.slaves.SlaveComputer", Labels: []string{}, Degraded: true},
+		{Name: "agent3", Reason: "testing", Class: "hudson.slaves.SlaveComputer", Labels: []string{}},
+	}, result)
+}
+
+func TestFindOfflineAgents_SkipsMonitorDataWithoutHealth(t *testing.T) {
+	jenkins, sut := mockJenkins("fizz", "buzz")
+	defer jenkins.teardown()
+
+	jenkins.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		require.NotContains(t, r.URL.RawQuery, "monitorData")
+
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"_class":"hudson.model.ComputerSet","computer":[]}`)
+	})
+
+	_, err := sut.FindOfflineAgents()
+	require.NoError(t, err)
+}
+
+const cloudResponse = `
+	{
+		"_class":"hudson.model.ComputerSet",
+		"computer":[
+			{
+				"_class":"hudson.slaves.SlaveComputer",
+				"displayName":"agent1",
+				"offline":true
+			},
+			{
+				"_class":"org.csanchez.jenkins.plugins.kubernetes.KubernetesComputer",
+				"displayName":"pod-1",
+				"offline":true
+			},
+			{
+				"_class":"com.example.CustomCloudComputer",
+				"displayName":"custom-1",
+				"offline":true
+			}
+		]
+	}
+`
+
+func TestFindOfflineAgents_SkipsCloudAgents(t *testing.T) {
+	jenkins, sut := mockJenkins("fizz", "buzz")
+	defer jenkins.teardown()
+
+	jenkins.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, cloudResponse)
+	})
+
+	sut.Filter.Classes = []string{"hudson.slaves.SlaveComputer", "org.csanchez.jenkins.plugins.kubernetes.KubernetesComputer"}
+	result, err := sut.FindOfflineAgents()
+
+	require.NoError(t, err)
+	require.Equal(t, []string{"agent1"}, names(result))
+}
+
+func TestFindOfflineAgents_ReportsCloudAgentsAfterGracePeriod(t *testing.T) {
+	jenkins, sut := mockJenkins("fizz", "buzz")
+	defer jenkins.teardown()
+
+	jenkins.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, cloudResponse)
+	})
+
+	sut.Cloud = CloudAgents{GracePeriod: time.Hour}
+	result, err := sut.FindOfflineAgents()
+
+	require.NoError(t, err)
+	require.Equal(t, []string{"agent1", "pod-1"}, names(result))
+	require.Equal(t, time.Duration(0), result[0].GracePeriod)
+	require.Equal(t, time.Hour, result[1].GracePeriod)
+
+	sut.Cloud.Classes = []string{"com.example.CustomCloudComputer"}
+	result, err = sut.FindOfflineAgents()
+
+	require.NoError(t, err)
+	require.Equal(t, []string{"agent1", "custom-1"}, names(result))
+	require.Equal(t, time.Hour, result[1].GracePeriod)
+}
+
+func TestFindOfflineAgents_ReportsStuckAgents(t *testing.T) {
+	jenkins, sut := mockJenkins("fizz", "buzz")
+	defer jenkins.teardown()
+
+	jenkins.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		require.Contains(t, r.URL.RawQuery, "executors[idle,currentExecutable[url,timestamp]]")
+		require.NotContains(t, r.URL.RawQuery, "monitorData")
+
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `
+			{
+				"_class":"hudson.model.ComputerSet",
+				"computer":[
+					{
+						"_class":"hudson.slaves.SlaveComputer",
+						"displayName":"agent1",
+						"offline":false,
+						"executors":[
+							{"idle":false,"currentExecutable":{"url":"http://jenkins/job/a/1/","timestamp":1535731200000}},
+							{"idle":true,"currentExecutable":null}
+						]
+					},
+					{
+						"_class":"hudson.slaves.SlaveComputer",
+						"displayName":"agent2",
+						"offline":false,
+						"executors":[
+							{"idle":false,"currentExecutable":{"url":"http://jenkins/job/b/1/","timestamp":1535800800000}}
+						]
+					}
+				]
+			}
+		`)
+	})
+
+	sut.now = func() time.Time { return time.Date(2018, 9, 1, 12, 0, 0, 0, time.UTC) }
+	sut.Executors = &ExecutorThresholds{MaxBuildDuration: 4 * time.Hour}
+	result, err := sut.FindOfflineAgents()
+
+	require.NoError(t, err)
+	require.Equal(t, []spot.Agent{
+		{Name: "agent1", Reason: "Build http://jenkins/job/a/1/ has been running for 20h0m0s, above 4h0m0s", Class: "hudson.slaves.SlaveComputer", Labels: []string{}, Stuck: true},
+	}, result)
+}
+
+func TestFindOfflineAgents_ReportsStarvedQueues(t *testing.T) {
+	jenkins, sut := mockJenkins("fizz", "buzz")
+	defer jenkins.teardown()
+
+	jenkins.mux.HandleFunc("/computer/api/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `
+			{
+				"_class":"hudson.model.ComputerSet",
+				"computer":[
+					{
+						"_class":"hudson.slaves.SlaveComputer",
+						"displayName":"win-1",
+						"offline":true,
+						"offlineCauseReason":"testing",
+						"assignedLabels":[{"name":"windows"},{"name":"win-1"}]
+					}
+				]
+			}
+		`)
+	})
+
+	jenkins.mux.HandleFunc("/queue/api/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `
+			{
+				"_class":"hudson.model.Queue",
+				"items":[
+					{
+						"_class":"hudson.model.Queue$BuildableItem",
+						"buildable":true,
+						"blocked":false,
+						"stuck":true,
+						"inQueueSince":1535799600000,
+						"why":"Waiting for next available executor on ‘windows’"
+					}
+				]
+			}
+		`)
+	})
+
+	sut.now = func() time.Time { return time.Date(2018, 9, 1, 12, 0, 0, 0, time.UTC) }
+	sut.Queue = &QueueThresholds{MaxWait: 30 * time.Minute}
+	result, err := sut.FindOfflineAgents()
+
+	require.NoError(t, err)
+	require.Equal(t, []string{"win-1", "queue: windows"}, names(result))
+	require.Equal(t, "1 build waiting for 1h0m0s: Waiting for next available executor on ‘windows’ (offline: win-1)", result[1].Reason)
+	require.True(t, result[1].Starved)
+}
+
+func TestFindOfflineAgents_PartialErrorForQueueFailure(t *testing.T) {
+	jenkins, sut := mockJenkins("fizz", "buzz")
+	defer jenkins.teardown()
+
+	jenkins.mux.HandleFunc("/computer/api/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"_class":"hudson.model.ComputerSet","computer":[{"_class":"hudson.slaves.SlaveComputer","displayName":"win-1","offline":true}]}`)
+	})
+
+	jenkins.mux.HandleFunc("/queue/api/json", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+
+	sut.Queue = &QueueThresholds{MaxWait: 30 * time.Minute}
+	result, err := sut.FindOfflineAgents()
+
+	require.IsType(t, &spot.PartialError{}, err)
+	require.EqualError(t, err, "Failed to query the build queue: Request failed: 403 Forbidden")
+	require.Equal(t, []string{"win-1"}, names(result))
+}
+
+func TestFindOfflineAgents_ReconnectsAgents(t *testing.T) {
+	jenkins, sut := mockJenkins("fizz", "buzz")
+	defer jenkins.teardown()
+
+	offline := true
+	jenkins.mux.HandleFunc("/computer/api/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `
+			{
+				"_class":"hudson.model.ComputerSet",
+				"computer":[
+					{
+						"_class":"hudson.slaves.SlaveComputer",
+						"displayName":"agent1",
+						"offline":%t,
+						"launchSupported":true,
+						"offlineCauseReason":"Connection was broken",
+						"offlineCause":{"_class":"hudson.slaves.OfflineCause$ChannelTermination"}
+					}
+				]
+			}
+		`, offline)
+	})
+
+	launched := 0
+	jenkins.mux.HandleFunc("/crumbIssuer/api/json", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	jenkins.mux.HandleFunc("/computer/agent1/launchSlaveAgent", func(w http.ResponseWriter, r *http.Request) {
+		launched++
+		offline = false
+	})
+
+	sut.Reconnect = &Remediation{}
+	result, err := sut.FindOfflineAgents()
+
+	require.NoError(t, err)
+	require.Equal(t, "Reconnect attempt 1 of 3 requested", result[0].Remediation)
+	require.Equal(t, 1, launched)
+
+	result, err = sut.FindOfflineAgents()
+
+	require.NoError(t, err)
+	require.Empty(t, result)
+	require.Empty(t, sut.Reconnect.Remediator.endpoints)
 }
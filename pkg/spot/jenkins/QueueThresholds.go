@@ -0,0 +1,153 @@
+package jenkins
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hylandsoftware/spot/pkg/spot"
+)
+
+const (
+	queueAPICall = "queue/api/json?tree=items[why,blocked,buildable,stuck,inQueueSince]"
+)
+
+// quotedLabel matches the label or node jenkins quotes in why a queue item
+// is waiting, e.g. "Waiting for next available executor on ‘windows’"
+var quotedLabel = regexp.MustCompile(`‘([^’]+)’`)
+
+type queueItem struct {
+	Why       string `json:"why"`
+	Blocked   bool   `json:"blocked"`
+	Buildable bool   `json:"buildable"`
+	Stuck     bool   `json:"stuck"`
+	// InQueueSince is when the item was queued in milliseconds since the
+	// epoch
+	InQueueSince int64 `json:"inQueueSince"`
+}
+
+type queueResponse struct {
+	Items []queueItem `json:"items"`
+}
+
+// label returns the label or node the item is waiting for, if jenkins
+// names one
+func (q *queueItem) label() string {
+	if match := quotedLabel.FindStringSubmatch(q.Why); match != nil {
+		return match[1]
+	}
+
+	return ""
+}
+
+// QueueThresholds describes when builds waiting in the jenkins queue are
+// reported as starved
+type QueueThresholds struct {
+	// MaxWait is how long a build may wait in the queue for an executor
+	MaxWait time.Duration
+}
+
+type starvedGroup struct {
+	name   string
+	label  string
+	builds int
+	oldest time.Duration
+	whys   []string
+}
+
+// starved groups the queue items that have waited longer than MaxWait by
+// the label they are waiting for, or by why they are waiting if they do
+// not name a label. Each group is returned as a starved agent that names
+// the offline agents with its label. Blocked items are only considered if
+// they name a label, since they are usually waiting for another build.
+func (q *QueueThresholds) starved(items []queueItem, offline []spot.Agent, now time.Time) []spot.Agent {
+	groups := map[string]*starvedGroup{}
+
+	for _, item := range items {
+		label := item.label()
+		if !item.Buildable && !item.Stuck && !(item.Blocked && label != "") {
+			continue
+		}
+
+		waiting := now.Sub(time.Unix(0, item.InQueueSince*int64(time.Millisecond))).Round(time.Second)
+		if item.InQueueSince <= 0 || waiting <= q.MaxWait {
+			continue
+		}
+
+		name := label
+		if name == "" {
+			name = item.Why
+		}
+
+		group, ok := groups[name]
+		if !ok {
+			group = &starvedGroup{name: name, label: label}
+			groups[name] = group
+		}
+
+		group.builds++
+		if waiting > group.oldest {
+			group.oldest = waiting
+		}
+
+		if !contains(group.whys, item.Why) {
+			group.whys = append(group.whys, item.Why)
+		}
+	}
+
+	names := []string{}
+	for name := range groups {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	result := []spot.Agent{}
+	for _, name := range names {
+		group := groups[name]
+
+		reason := fmt.Sprintf("%d builds waiting for up to %s: %s", group.builds, group.oldest, strings.Join(group.whys, "; "))
+		if group.builds == 1 {
+			reason = fmt.Sprintf("1 build waiting for %s: %s", group.oldest, strings.Join(group.whys, "; "))
+		}
+
+		if group.label != "" {
+			if agents := offlineWithLabel(offline, group.label); len(agents) > 0 {
+				reason = fmt.Sprintf("%s (offline: %s)", reason, strings.Join(agents, ", "))
+			}
+		}
+
+		agent := spot.Agent{
+			Name:    fmt.Sprintf("queue: %s", group.name),
+			Reason:  reason,
+			Starved: true,
+		}
+
+		if group.label != "" {
+			agent.Labels = []string{group.label}
+		}
+
+		result = append(result, agent)
+	}
+
+	return result
+}
+
+// offlineWithLabel returns the names of the offline agents that have a
+// label. Jenkins assigns every agent a label with its own name.
+func offlineWithLabel(offline []spot.Agent, label string) []string {
+	result := []string{}
+	for _, agent := range offline {
+		if agent.Degraded || agent.Stuck || agent.Starved {
+			continue
+		}
+
+		if agent.Name == label || contains(agent.Labels, label) {
+			result = append(result, agent.Name)
+		}
+	}
+
+	return result
+}
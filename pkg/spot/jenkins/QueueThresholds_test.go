@@ -0,0 +1,55 @@
+package jenkins
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hylandsoftware/spot/pkg/spot"
+	"github.com/stretchr/testify/require"
+)
+
+var queueNow = time.Date(2018, 9, 1, 12, 0, 0, 0, time.UTC)
+
+func queued(why string, waiting time.Duration) queueItem {
+	return queueItem{Why: why, Buildable: true, InQueueSince: queueNow.Add(-waiting).UnixNano() / int64(time.Millisecond)}
+}
+
+func TestQueueItemLabel(t *testing.T) {
+	require.Equal(t, "windows", (&queueItem{Why: "Waiting for next available executor on ‘windows’"}).label())
+	require.Equal(t, "linux&&docker", (&queueItem{Why: "There are no nodes with the label ‘linux&&docker’"}).label())
+	require.Empty(t, (&queueItem{Why: "Build #5 is already in progress (ETA: 3 min 0 sec)"}).label())
+}
+
+func TestStarved_IgnoresShortWaits(t *testing.T) {
+	sut := &QueueThresholds{MaxWait: 30 * time.Minute}
+
+	require.Empty(t, sut.starved([]queueItem{
+		queued("Waiting for next available executor on ‘windows’", 10*time.Minute),
+	}, nil, queueNow))
+}
+
+func TestStarved_GroupsByLabel(t *testing.T) {
+	sut := &QueueThresholds{MaxWait: 30 * time.Minute}
+	blocked := queued("Build #5 is already in progress (ETA: 3 min 0 sec)", 2*time.Hour)
+	blocked.Buildable = false
+	blocked.Blocked = true
+
+	result := sut.starved([]queueItem{
+		queued("Waiting for next available executor on ‘windows’", 45*time.Minute),
+		queued("Waiting for next available executor on ‘windows’", time.Hour),
+		queued("All nodes of label ‘windows’ are offline", 40*time.Minute),
+		queued("Waiting for next available executor on ‘linux’", 35*time.Minute),
+		queued("Waiting for next available executor", 50*time.Minute),
+		blocked,
+	}, []spot.Agent{
+		{Name: "win-1", Labels: []string{"windows", "win-1"}},
+		{Name: "win-2", Labels: []string{"windows", "win-2"}, Degraded: true},
+		{Name: "linux-1", Labels: []string{"linux-1"}},
+	}, queueNow)
+
+	require.Equal(t, []spot.Agent{
+		{Name: "queue: Waiting for next available executor", Reason: "1 build waiting for 50m0s: Waiting for next available executor", Starved: true},
+		{Name: "queue: linux", Reason: "1 build waiting for 35m0s: Waiting for next available executor on ‘linux’", Labels: []string{"linux"}, Starved: true},
+		{Name: "queue: windows", Reason: "3 builds waiting for up to 1h0m0s: Waiting for next available executor on ‘windows’; All nodes of label ‘windows’ are offline (offline: win-1)", Labels: []string{"windows"}, Starved: true},
+	}, result)
+}
@@ -0,0 +1,174 @@
+package jenkins
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	launchAPICall = "computer/%s/launchSlaveAgent"
+
+	// DefaultReconnectAttempts is how often an agent is reconnected if
+	// MaxAttempts is not set
+	DefaultReconnectAttempts = 3
+
+	// DefaultReconnectBackoff is how long to wait after the first attempt
+	// if Backoff is not set
+	DefaultReconnectBackoff = 5 * time.Minute
+)
+
+// launchableCauses are the offline causes of agents that went offline on
+// their own and may come back if they are launched again
+var launchableCauses = []string{
+	"hudson.slaves.OfflineCause$ChannelTermination",
+	"hudson.slaves.OfflineCause$LaunchFailed",
+}
+
+type remediationState struct {
+	since    time.Time
+	attempts int
+	next     time.Time
+	last     string
+}
+
+// Remediator keeps track of the agents being reconnected by jenkins endpoint
+// and agent name. Detectors are rebuilt whenever the config is reloaded, so
+// a Remediator that outlives them keeps reloading from resetting the
+// attempts.
+type Remediator struct {
+	lock      sync.Mutex
+	endpoints map[string]map[string]*remediationState
+}
+
+// NewRemediator constructs a Remediator that does not track any agents yet
+func NewRemediator() *Remediator {
+	return &Remediator{endpoints: map[string]map[string]*remediationState{}}
+}
+
+// Remediation reconnects offline agents the way someone clicking "Launch
+// agent" in jenkins would. Only agents that jenkins can launch and that
+// went offline on their own, rather than being marked temporarily offline,
+// are reconnected.
+type Remediation struct {
+	// After is how long an agent must be offline before it is reconnected
+	After time.Duration
+	// MaxAttempts is how often an agent is reconnected before giving up.
+	// DefaultReconnectAttempts is used if it is zero.
+	MaxAttempts int
+	// Backoff is how long to wait after the first attempt before trying
+	// again. It doubles after every attempt. DefaultReconnectBackoff is used
+	// if it is zero.
+	Backoff time.Duration
+
+	// Remediator keeps track of the attempts. A Remediator of its own is
+	// used if it is nil.
+	Remediator *Remediator
+}
+
+func (r *Remediation) remediator() *Remediator {
+	if r.Remediator == nil {
+		r.Remediator = NewRemediator()
+	}
+
+	return r.Remediator
+}
+
+func (r *Remediation) maxAttempts() int {
+	if r.MaxAttempts <= 0 {
+		return DefaultReconnectAttempts
+	}
+
+	return r.MaxAttempts
+}
+
+func (r *Remediation) backoff() time.Duration {
+	if r.Backoff <= 0 {
+		return DefaultReconnectBackoff
+	}
+
+	return r.Backoff
+}
+
+// launchable returns true if the node went offline on its own and jenkins
+// can launch it
+func launchable(n *node) bool {
+	if n.TemporarilyOffline || !n.LaunchSupported {
+		return false
+	}
+
+	return n.OfflineCause == nil || contains(launchableCauses, n.OfflineCause.Class)
+}
+
+// remediate reconnects an offline node if it is due and attempt is true,
+// and returns a description of what has been done so far, if anything
+func (r *Remediation) remediate(client *Client, n *node, now time.Time, attempt bool, log *logrus.Entry) string {
+	remediator := r.remediator()
+	remediator.lock.Lock()
+	defer remediator.lock.Unlock()
+
+	agents, ok := remediator.endpoints[client.Endpoint]
+	if !ok {
+		agents = map[string]*remediationState{}
+		remediator.endpoints[client.Endpoint] = agents
+	}
+
+	state, ok := agents[n.DisplayName]
+	if !ok {
+		state = &remediationState{since: now}
+		agents[n.DisplayName] = state
+	}
+
+	if !attempt || !launchable(n) || state.attempts >= r.maxAttempts() || now.Sub(state.since) < r.After || now.Before(state.next) {
+		return state.last
+	}
+
+	state.attempts++
+	state.next = now.Add(r.backoff() << uint(state.attempts-1))
+
+	l := log.WithFields(logrus.Fields{
+		"agent":   n.DisplayName,
+		"attempt": state.attempts,
+	})
+
+	if err := client.Post(fmt.Sprintf(launchAPICall, url.PathEscape(n.DisplayName)), url.Values{}); err != nil {
+		l.WithError(err).Error("Failed to reconnect agent")
+		state.last = fmt.Sprintf("Reconnect attempt %d of %d failed: %s", state.attempts, r.maxAttempts(), err.Error())
+	} else {
+		l.Info("Reconnecting agent")
+		state.last = fmt.Sprintf("Reconnect attempt %d of %d requested", state.attempts, r.maxAttempts())
+	}
+
+	return state.last
+}
+
+// forget stops tracking the agents of a jenkins endpoint that are no longer
+// offline
+func (r *Remediation) forget(client *Client, offline map[string]bool, log *logrus.Entry) {
+	remediator := r.remediator()
+	remediator.lock.Lock()
+	defer remediator.lock.Unlock()
+
+	agents := remediator.endpoints[client.Endpoint]
+	for name, state := range agents {
+		if offline[name] {
+			continue
+		}
+
+		if state.attempts > 0 {
+			log.WithFields(logrus.Fields{
+				"agent":    name,
+				"attempts": state.attempts,
+			}).Info("Agent reconnected")
+		}
+
+		delete(agents, name)
+	}
+
+	if len(agents) == 0 {
+		delete(remediator.endpoints, client.Endpoint)
+	}
+}
@@ -0,0 +1,148 @@
+package jenkins
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+)
+
+var remediationNow = time.Date(2018, 9, 1, 12, 0, 0, 0, time.UTC)
+
+func disconnected(name string) *node {
+	return &node{
+		DisplayName:     name,
+		Offline:         true,
+		LaunchSupported: true,
+		OfflineCause:    &offlineCause{Class: "hudson.slaves.OfflineCause$ChannelTermination"},
+	}
+}
+
+func mockLaunch(status int) (*httptest.Server, *Client, *[]string) {
+	launched := []string{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		launched = append(launched, r.URL.EscapedPath())
+		w.WriteHeader(status)
+	})
+
+	server := httptest.NewServer(mux)
+	return server, NewTokenClient(server.URL, "fizz", "token"), &launched
+}
+
+func TestLaunchable(t *testing.T) {
+	require.True(t, launchable(disconnected("a")))
+	require.True(t, launchable(&node{Offline: true, LaunchSupported: true}))
+	require.False(t, launchable(&node{Offline: true, LaunchSupported: false}))
+	require.False(t, launchable(&node{Offline: true, LaunchSupported: true, TemporarilyOffline: true}))
+	require.False(t, launchable(&node{Offline: true, LaunchSupported: true, OfflineCause: &offlineCause{Class: "hudson.slaves.OfflineCause$UserCause"}}))
+}
+
+func TestRemediate_WaitsBeforeReconnecting(t *testing.T) {
+	server, client, launched := mockLaunch(http.StatusOK)
+	defer server.Close()
+
+	sut := &Remediation{After: 10 * time.Minute}
+	log := logrus.WithField("detector", "test")
+
+	require.Empty(t, sut.remediate(client, disconnected("agent 1"), remediationNow, true, log))
+	require.Empty(t, sut.remediate(client, disconnected("agent 1"), remediationNow.Add(5*time.Minute), true, log))
+	require.Empty(t, *launched)
+
+	require.Equal(t, "Reconnect attempt 1 of 3 requested", sut.remediate(client, disconnected("agent 1"), remediationNow.Add(10*time.Minute), true, log))
+	require.Equal(t, []string{"/computer/agent%201/launchSlaveAgent"}, *launched)
+}
+
+func TestRemediate_BacksOffAndGivesUp(t *testing.T) {
+	server, client, launched := mockLaunch(http.StatusInternalServerError)
+	defer server.Close()
+
+	sut := &Remediation{MaxAttempts: 2, Backoff: time.Minute}
+	log := logrus.WithField("detector", "test")
+
+	require.Equal(t, "Reconnect attempt 1 of 2 failed: Request failed: 500 Internal Server Error", sut.remediate(client, disconnected("a"), remediationNow, true, log))
+	require.Equal(t, "Reconnect attempt 1 of 2 failed: Request failed: 500 Internal Server Error", sut.remediate(client, disconnected("a"), remediationNow.Add(30*time.Second), true, log))
+	require.Equal(t, "Reconnect attempt 2 of 2 failed: Request failed: 500 Internal Server Error", sut.remediate(client, disconnected("a"), remediationNow.Add(time.Minute), true, log))
+	require.Equal(t, "Reconnect attempt 2 of 2 failed: Request failed: 500 Internal Server Error", sut.remediate(client, disconnected("a"), remediationNow.Add(time.Hour), true, log))
+	require.Len(t, *launched, 2)
+}
+
+func TestRemediate_BacksOffByDefault(t *testing.T) {
+	server, client, launched := mockLaunch(http.StatusInternalServerError)
+	defer server.Close()
+
+	sut := &Remediation{}
+	log := logrus.WithField("detector", "test")
+
+	sut.remediate(client, disconnected("a"), remediationNow, true, log)
+	sut.remediate(client, disconnected("a"), remediationNow.Add(time.Minute), true, log)
+	require.Len(t, *launched, 1)
+
+	sut.remediate(client, disconnected("a"), remediationNow.Add(DefaultReconnectBackoff), true, log)
+	require.Len(t, *launched, 2)
+}
+
+func TestRemediate_OnlyReconnectsWhenAllowed(t *testing.T) {
+	server, client, launched := mockLaunch(http.StatusOK)
+	defer server.Close()
+
+	sut := &Remediation{}
+	log := logrus.WithField("detector", "test")
+
+	require.Empty(t, sut.remediate(client, disconnected("a"), remediationNow, false, log))
+	require.Empty(t, *launched)
+
+	require.Equal(t, "Reconnect attempt 1 of 3 requested", sut.remediate(client, disconnected("a"), remediationNow, true, log))
+	require.Len(t, *launched, 1)
+}
+
+func TestRemediate_KeepsAttemptsAcrossReloads(t *testing.T) {
+	server, client, launched := mockLaunch(http.StatusOK)
+	defer server.Close()
+
+	log := logrus.WithField("detector", "test")
+
+	remediator := NewRemediator()
+	first := &Remediation{MaxAttempts: 1, Remediator: remediator}
+	require.Equal(t, "Reconnect attempt 1 of 1 requested", first.remediate(client, disconnected("a"), remediationNow, true, log))
+
+	reloaded := &Remediation{MaxAttempts: 1, Remediator: remediator}
+	require.Equal(t, "Reconnect attempt 1 of 1 requested", reloaded.remediate(client, disconnected("a"), remediationNow.Add(time.Hour), true, log))
+	require.Len(t, *launched, 1)
+}
+
+func TestRemediate_ForgetsRecoveredAgents(t *testing.T) {
+	server, client, launched := mockLaunch(http.StatusOK)
+	defer server.Close()
+
+	sut := &Remediation{MaxAttempts: 1}
+	log := logrus.WithField("detector", "test")
+
+	sut.remediate(client, disconnected("a"), remediationNow, true, log)
+	sut.remediate(client, disconnected("b"), remediationNow, true, log)
+	sut.forget(client, map[string]bool{"b": true}, log)
+
+	require.Equal(t, "Reconnect attempt 1 of 1 requested", sut.remediate(client, disconnected("a"), remediationNow, true, log))
+	require.Equal(t, "Reconnect attempt 1 of 1 requested", sut.remediate(client, disconnected("b"), remediationNow, true, log))
+	require.Len(t, *launched, 3)
+}
+
+func TestRemediate_SkipsAgentsThatCannotBeLaunched(t *testing.T) {
+	server, client, launched := mockLaunch(http.StatusOK)
+	defer server.Close()
+
+	sut := &Remediation{}
+	n := disconnected("a")
+	n.TemporarilyOffline = true
+
+	require.Empty(t, sut.remediate(client, n, remediationNow, true, logrus.WithField("detector", "test")))
+	require.Empty(t, *launched)
+}
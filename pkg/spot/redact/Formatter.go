@@ -0,0 +1,166 @@
+// Package redact keeps secrets like passwords and tokens out of log output
+package redact
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// Mask replaces secrets in redacted strings
+	Mask = "[REDACTED]"
+
+	// shortLength is the length below which masking a secret is likely to
+	// mask unrelated output as well
+	shortLength = 6
+)
+
+var (
+	lock sync.RWMutex
+	// sources holds the secrets registered by each source. Secrets
+	// registered with Secret have no source.
+	sources = map[string][]string{}
+	// secrets are the secrets of all sources, longest first
+	secrets = []string{}
+
+	userinfo = regexp.MustCompile(`(://[^/@\s:]*):[^/@\s]*@`)
+)
+
+// Secret registers values that must never be logged for the lifetime of
+// the process. Secrets should be registered as soon as they are resolved.
+// Empty values are ignored.
+func Secret(values ...string) {
+	warnShort(values)
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	for _, value := range values {
+		if !contains(sources[""], value) {
+			sources[""] = append(sources[""], value)
+		}
+	}
+
+	update()
+}
+
+// Replace replaces the secrets registered by source with values, e.g. once
+// a reloaded config has been applied. Calling it without values forgets the
+// secrets of source.
+func Replace(source string, values ...string) {
+	warnShort(values)
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if len(values) == 0 {
+		delete(sources, source)
+	} else {
+		sources[source] = values
+	}
+
+	update()
+}
+
+// warnShort warns about secrets that are short enough to be masked in
+// unrelated output. They are masked nonetheless since they must never be
+// logged. It must be called without holding the lock since logging redacts.
+func warnShort(values []string) {
+	for _, value := range values {
+		if value != "" && len(value) < shortLength {
+			logrus.Warnf("A secret is shorter than %d characters, so unrelated log output may be masked as well", shortLength)
+		}
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// update rebuilds the secrets from every source. The caller must hold the
+// lock.
+func update() {
+	seen := map[string]bool{}
+	secrets = []string{}
+
+	for _, values := range sources {
+		for _, value := range values {
+			if value == "" || seen[value] {
+				continue
+			}
+
+			seen[value] = true
+			secrets = append(secrets, value)
+		}
+	}
+
+	// Mask longer secrets first so that secrets containing other secrets
+	// are masked completely
+	sort.Slice(secrets, func(i, j int) bool {
+		return len(secrets[i]) > len(secrets[j])
+	})
+}
+
+// String masks every registered secret in s, as well as the password of
+// every URL even if it was never registered
+func String(s string) string {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	for _, secret := range secrets {
+		s = strings.Replace(s, secret, Mask, -1)
+	}
+
+	return userinfo.ReplaceAllString(s, "${1}:"+Mask+"@")
+}
+
+// value redacts a log field. Values that do not contain secrets are
+// returned unchanged so that formatters can still render them natively.
+func value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case string:
+		return String(v)
+	case error:
+		if s := v.Error(); String(s) != s {
+			return fmt.Errorf("%s", String(s))
+		}
+
+		return v
+	default:
+		if s := fmt.Sprint(v); String(s) != s {
+			return String(s)
+		}
+
+		return v
+	}
+}
+
+// Formatter is a logrus.Formatter that redacts the message and fields of
+// every entry before formatting it with the wrapped Formatter
+type Formatter struct {
+	logrus.Formatter
+}
+
+// Format implements logrus.Formatter
+func (f *Formatter) Format(entry *logrus.Entry) ([]byte, error) {
+	redacted := *entry
+	redacted.Message = String(entry.Message)
+	redacted.Data = make(logrus.Fields, len(entry.Data))
+
+	for k, v := range entry.Data {
+		redacted.Data[k] = value(v)
+	}
+
+	return f.Formatter.Format(&redacted)
+}
@@ -1,15 +1,127 @@
 package spot
 
 import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
 	log "github.com/sirupsen/logrus"
 )
 
+// Agent describes a build agent that was found to be offline
+type Agent struct {
+	// Name is the display name of the agent
+	Name string
+	// Reason is an optional, human-readable explanation of why the agent
+	// is offline as reported by the build system
+	Reason string
+	// Class is the type of the agent as reported by the build system, if any
+	Class string
+	// Labels are the labels assigned to the agent by the build system, if any
+	Labels []string
+	// Manual is true if someone deliberately took the agent offline, e.g.
+	// for maintenance, rather than it disconnecting on its own
+	Manual bool
+	// Severity is how urgently the agent needs attention. It is empty unless
+	// the detector downgraded the agent to SeverityWarning.
+	Severity string
+	// Degraded is true if the agent is online but unhealthy, e.g. it is low
+	// on disk space. Reason describes what is wrong with it.
+	Degraded bool
+	// Stuck is true if the agent is online but its executors are stuck on
+	// long-running builds. Reason describes which builds.
+	Stuck bool
+	// Starved is true if the entry is not an agent but a label whose builds
+	// have been waiting in the build queue for too long. Reason describes
+	// the waiting builds and the offline agents with the label.
+	Starved bool
+	// Remediation describes what was done to bring the agent back online,
+	// if anything. Recovered agents describe what they came back after.
+	Remediation string
+	// GracePeriod, if set, is how long the agent must be offline before it
+	// is reported, overriding the grace period of its detector
+	GracePeriod time.Duration
+}
+
+const (
+	// SeverityCritical is the severity of agents that were not downgraded
+	SeverityCritical = "critical"
+	// SeverityWarning is the severity of agents that are offline but do not
+	// need urgent attention, e.g. agents under maintenance
+	SeverityWarning = "warning"
+)
+
+// String returns the name of the agent so that templates written against
+// lists of agent names continue to work
+func (a Agent) String() string {
+	return a.Name
+}
+
+// Tags returns the markers that notifiers show next to the name of the
+// agent, e.g. "degraded", so that every notifier describes agents alike
+func (a Agent) Tags() []string {
+	tags := []string{}
+	for _, tag := range []struct {
+		name string
+		set  bool
+	}{
+		{"manual", a.Manual},
+		{SeverityWarning, a.Severity == SeverityWarning},
+		{"degraded", a.Degraded},
+		{"stuck", a.Stuck},
+		{"starved", a.Starved},
+	} {
+		if tag.set {
+			tags = append(tags, tag.name)
+		}
+	}
+
+	return tags
+}
+
+// Details returns the reason of the agent followed by its remediation, if
+// any, or an empty string if there are neither
+func (a Agent) Details() string {
+	details := []string{}
+	for _, detail := range []string{a.Reason, a.Remediation} {
+		if detail != "" {
+			details = append(details, detail)
+		}
+	}
+
+	return strings.Join(details, " - ")
+}
+
 // Watchdog holds a reference to a set of detectors and a Notification handler
 type Watchdog struct {
 	Detectors           []OfflineAgentDetector
 	NotificationHandler Notifier
 
+	// ReminderInterval is how often to remind the notification handler about
+	// agents that are still offline. Reminders are disabled when it is zero.
+	ReminderInterval time.Duration
+
+	// Retries retries notifications that failed in a way that may succeed
+	// later. Failed notifications are not retried when it is nil.
+	Retries *RetryQueue
+
+	// Silences suppresses notifications about matching agents. Silenced
+	// agents are reported once they are no longer silenced.
+	Silences *Silencer
+
+	// Options holds per-detector settings keyed by detector name
+	Options map[string]DetectorOptions
+
 	cache OfflineAgentCache
+
+	// runLock serializes checks and reconfiguration
+	runLock sync.Mutex
+
+	stateLock   sync.Mutex
+	status      map[string]*DetectorStatus
+	transitions []Transition
+	lastCycle   time.Time
 }
 
 // NewWatchdog constructs a Watchdog
@@ -17,51 +129,221 @@ func NewWatchdog(detectors []OfflineAgentDetector, handler Notifier) *Watchdog {
 	return &Watchdog{
 		Detectors:           detectors,
 		NotificationHandler: handler,
+		Silences:            NewSilencer(),
+
+		cache:  NewInMemoryOfflineAgentCache(),
+		status: map[string]*DetectorStatus{},
+	}
+}
+
+// Offline returns every agent that is currently offline, keyed by detector
+func (w *Watchdog) Offline() map[string][]OfflineAgent {
+	return w.cache.List()
+}
+
+// Acknowledge stops reminders about an offline agent until it recovers,
+// returning false if the agent is not offline
+func (w *Watchdog) Acknowledge(detector, agent string) bool {
+	return w.cache.Acknowledge(detector, agent)
+}
+
+// Reconfigure replaces the detectors, notification handler, detector
+// options and reminder interval once any running check completes. Offline
+// agents of detectors that are still configured are kept while those of
+// detectors that were removed are forgotten.
+func (w *Watchdog) Reconfigure(detectors []OfflineAgentDetector, handler Notifier, options map[string]DetectorOptions, reminder time.Duration) {
+	w.runLock.Lock()
+	defer w.runLock.Unlock()
+
+	kept := map[string]bool{}
+	for _, d := range detectors {
+		kept[d.Name()] = true
+	}
+
+	for _, d := range w.Detectors {
+		if !kept[d.Name()] {
+			log.WithField("detector", d.Name()).Info("Detector removed")
+			w.cache.Forget(d.Name())
+			forgetDetectorMetrics(d.Name())
+		}
+	}
 
-		cache: NewInMemoryOfflineAgentCache(),
+	w.stateLock.Lock()
+	for name := range w.status {
+		if !kept[name] {
+			delete(w.status, name)
+		}
 	}
+
+	w.Detectors = detectors
+	w.stateLock.Unlock()
+
+	w.NotificationHandler = handler
+	w.Options = options
+	w.ReminderInterval = reminder
+}
+
+// RunChecks polls all detectors and updates the offline agent cache,
+// returning the set of agents that are newly offline, due for a reminder
+// or have recovered since the last check. The returned agents are marked
+// as reported without notifying anyone, and detectors do not remediate
+// them.
+func (w *Watchdog) RunChecks() *Changes {
+	w.runLock.Lock()
+	defer w.runLock.Unlock()
+
+	changes := w.check(false)
+	w.cache.Commit(changes)
+
+	return changes
 }
 
-// RunChecks polls all detectors. If any detector returns one or more offline
-// agent, they are added to the map that is returned
-func (w *Watchdog) RunChecks() map[string][]string {
-	found := map[string][]string{}
+// check polls all detectors and updates the offline agent cache without
+// committing the changes. RemediatingDetectors only remediate offline
+// agents if remediate is true.
+func (w *Watchdog) check(remediate bool) *Changes {
+	found := map[string][]Agent{}
 
 	log.Info("Running Watchdog Task")
 	for _, v := range w.Detectors {
 		l := log.WithField("detector", v.Name())
 
+		if !w.due(v.Name(), time.Now()) {
+			l.Debug("Skipping detector until its next interval")
+			continue
+		}
+
 		l.Debug("Checking for offline agents")
 
-		if offline, err := v.FindOfflineAgents(); err != nil {
+		start := time.Now()
+		offline, err := find(v, remediate)
+		w.recordCheck(v.Name(), start, offline, err)
+
+		if err != nil && !partial(err) {
 			l.WithError(err).Error("Failed to check for offline agents")
-		} else if len(offline) > 0 {
-			l.WithField("offline", offline).Warn("One or more agents are offline")
+		} else {
+			if err != nil {
+				l.WithError(err).Error("Failed to check for some offline agents")
+			}
+
+			if len(offline) > 0 {
+				l.WithField("offline", offline).Warn("One or more agents are offline")
+			}
+
 			found[v.Name()] = offline
 		}
 
 		l.Debug("Check Complete")
 	}
 
-	return w.cache.Update(found)
+	before := w.cache.List()
+	changes := w.cache.Update(found, w.ReminderInterval)
+	w.recordTransitions(found, before, w.cache.List())
+
+	// The remediation of a recovered agent is what brought it back, or
+	// what was attempted before it came back on its own
+	for _, recovered := range changes.Recovered {
+		for i := range recovered {
+			if recovered[i].Remediation != "" {
+				recovered[i].Remediation = fmt.Sprintf("Back online after: %s", recovered[i].Remediation)
+			}
+		}
+	}
+
+	return changes
+}
+
+// find returns the offline agents of a detector, letting it remediate them
+// if it is a RemediatingDetector and remediate is true
+func find(d OfflineAgentDetector, remediate bool) ([]Agent, error) {
+	if r, ok := d.(RemediatingDetector); ok {
+		return r.CheckOfflineAgents(remediate)
+	}
+
+	return d.FindOfflineAgents()
 }
 
 // RunChecksAndNotify calls w.RunChecks. If Any offline agents are returned
-// a notification is sent
+// a notification is sent. If the notification handler is a FollowUpNotifier
+// it is also told about reminders and recovered agents.
+//
+// Agents are only marked as reported once their notification has been
+// delivered. Silenced agents are not reported until their silence ends. If
+// Retries is set, notifications that fail in a retryable way are queued
+// and retried in the background instead of returning an error.
 func (w *Watchdog) RunChecksAndNotify() error {
-	toNotify := w.RunChecks()
+	w.runLock.Lock()
+	defer w.runLock.Unlock()
+
+	changes := w.check(true)
+
+	if w.Silences != nil {
+		w.cache.Release(w.Silences.filter(changes))
+	}
+
+	w.cache.Release(w.deferGracePeriod(changes))
 
-	if len(toNotify) > 0 {
-		if w.NotificationHandler == nil {
-			log.Error("No notification handler")
-			return nil
+	if changes.Empty() {
+		log.Info("No newly offline agents")
+		return nil
+	}
+
+	if w.NotificationHandler == nil {
+		log.Error("No notification handler")
+		w.cache.Commit(changes)
+		return nil
+	}
+
+	deliveries := []struct {
+		kind      string
+		message   string
+		agents    map[string][]Agent
+		delivered *Changes
+	}{
+		{deliveryNotify, "Sending Notification", changes.Offline, &Changes{Offline: changes.Offline}},
+		{deliveryRemind, "Sending Reminder", changes.Reminders, &Changes{Reminders: changes.Reminders}},
+		{deliveryRecover, "Sending Recovery Notification", changes.Recovered, &Changes{}},
+	}
+
+	var result error
+	for _, d := range deliveries {
+		if len(d.agents) == 0 {
+			continue
 		}
 
-		log.Info("Sending Notification")
-		return w.NotificationHandler.Notify(toNotify)
+		if err := w.deliver(d.kind, d.message, d.agents, d.delivered); err != nil && result == nil {
+			result = err
+		}
+	}
+
+	return result
+}
+
+// deliver sends one kind of notification and commits the agents it
+// reported to the cache once it has been delivered or given up on
+func (w *Watchdog) deliver(kind, message string, agents map[string][]Agent, delivered *Changes) error {
+	handler := w.NotificationHandler
+	if _, ok := handler.(FollowUpNotifier); ok || kind == deliveryNotify {
+		log.Info(message)
 	}
 
-	log.Info("No newly offline agents")
+	_, err := deliver(kind, handler, agents)
+	if err == nil || w.Retries == nil {
+		w.cache.Commit(delivered)
+		return err
+	}
+
+	if ok, _ := retryable(err); !ok {
+		w.cache.Commit(delivered)
+		return err
+	}
+
+	w.Retries.Enqueue(kind, err, func(previous error) error {
+		return redeliver(kind, handler, agents, previous)
+	}, func(error) {
+		w.cache.Commit(delivered)
+	})
+
 	return nil
 }
 
@@ -73,19 +355,100 @@ type OfflineAgentDetector interface {
 	// to be used.
 	Name() string
 
-	/// FindOfflineAgents returns a string array of agents that are offline.
-	FindOfflineAgents() ([]string, error)
+	/// FindOfflineAgents returns the agents that are offline.
+	FindOfflineAgents() ([]Agent, error)
+}
+
+// RemediatingDetector is an OfflineAgentDetector that also tries to bring
+// the offline agents it finds back online. The watchdog only lets it do so
+// on checks that notify about the agents, so not while warming up.
+type RemediatingDetector interface {
+	OfflineAgentDetector
+
+	// CheckOfflineAgents returns the agents that are offline like
+	// FindOfflineAgents, only remediating them if remediate is true
+	CheckOfflineAgents(remediate bool) ([]Agent, error)
+}
+
+// OfflineAgent is an agent that is known to be offline along with what
+// has been reported about it
+type OfflineAgent struct {
+	Agent
+
+	// Since is when the agent was first found to be offline
+	Since time.Time
+	// Notified is true once a notification about the agent was delivered
+	Notified bool
+	// LastNotified is when a notification or reminder about the agent was
+	// last delivered. It is updated whenever one is committed.
+	LastNotified time.Time
+	// Acknowledged is true if someone has acknowledged that the agent is
+	// offline. Acknowledged agents are not reminded about.
+	Acknowledged bool
+}
+
+// Changes describes the result of an OfflineAgentCache update. Each map is
+// keyed by detector name.
+type Changes struct {
+	// Offline contains agents that are newly offline
+	Offline map[string][]Agent
+	// Reminders contains agents that are still offline and are due for a reminder
+	Reminders map[string][]Agent
+	// Recovered contains agents that were offline and are now back online
+	Recovered map[string][]Agent
+}
+
+// Empty returns true if there is nothing to notify about
+func (c *Changes) Empty() bool {
+	return len(c.Offline) == 0 && len(c.Reminders) == 0 && len(c.Recovered) == 0
 }
 
 // OfflineAgentCache remembers what agents are still offline
 type OfflineAgentCache interface {
-	// Update updates the cache and returns a map of systems to agents that are newly offline
-	Update(offline map[string][]string) map[string][]string
+	// Update updates the cache with the offline agents for each detector that
+	// was checked. Detectors that are not present in the map are left as-is.
+	//
+	// Offline agents that have not been reported yet are returned until they
+	// are committed. Agents that were last reported longer than
+	// reminderInterval ago are returned as reminders unless the interval is
+	// zero. Agents that were returned are not returned again until they are
+	// committed. Only agents that were reported are returned as recovered.
+	Update(offline map[string][]Agent, reminderInterval time.Duration) *Changes
+
+	// Commit marks the offline agents and reminders in a set of changes as
+	// reported
+	Commit(delivered *Changes)
+
+	// Release marks the offline agents and reminders in a set of changes as
+	// not reported so that they are returned again by the next update
+	Release(undelivered *Changes)
+
+	// Acknowledge stops reminders for an offline agent until it recovers,
+	// returning false if the agent is not offline
+	Acknowledge(system, agent string) bool
+
+	// Forget removes every agent of a detector that is no longer watched
+	Forget(system string)
+
+	// List returns every agent that is currently offline, keyed by detector
+	List() map[string][]OfflineAgent
 }
 
 // Notifier provides a way to warn interested parties about offline agents.
 type Notifier interface {
 	// Notify takes an map of detector names to array of offline agents and
 	// sends a notification, optionally returning an error.
-	Notify(agents map[string][]string) error
+	Notify(agents map[string][]Agent) error
+}
+
+// FollowUpNotifier is a Notifier that can also follow up on a previous
+// notification when agents remain offline or come back online.
+type FollowUpNotifier interface {
+	Notifier
+
+	// Remind takes a map of detector names to agents that are still offline
+	Remind(agents map[string][]Agent) error
+
+	// Recover takes a map of detector names to agents that are back online
+	Recover(agents map[string][]Agent) error
 }
@@ -3,6 +3,7 @@ package spot
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -17,16 +18,25 @@ func (d *mockDetector) Name() string {
 	return fmt.Sprintf("[MockDetector] %s", args.String(0))
 }
 
-func (d *mockDetector) FindOfflineAgents() ([]string, error) {
+func (d *mockDetector) FindOfflineAgents() ([]Agent, error) {
 	args := d.Called()
-	return args.Get(0).([]string), args.Error(1)
+	return args.Get(0).([]Agent), args.Error(1)
+}
+
+type mockRemediatingDetector struct {
+	mockDetector
+}
+
+func (d *mockRemediatingDetector) CheckOfflineAgents(remediate bool) ([]Agent, error) {
+	args := d.Called(remediate)
+	return args.Get(0).([]Agent), args.Error(1)
 }
 
 type mockNotifier struct {
 	mock.Mock
 }
 
-func setup(agents []string, e error) (*mockDetector, *mockNotifier, *Watchdog) {
+func setup(agents []Agent, e error) (*mockDetector, *mockNotifier, *Watchdog) {
 	detector := &mockDetector{}
 	notifier := &mockNotifier{}
 
@@ -38,20 +48,49 @@ func setup(agents []string, e error) (*mockDetector, *mockNotifier, *Watchdog) {
 	return detector, notifier, sut
 }
 
-func (n *mockNotifier) Notify(agents map[string][]string) error {
+func (n *mockNotifier) Notify(agents map[string][]Agent) error {
+	args := n.Called(agents)
+
+	return args.Error(0)
+}
+
+type mockFollowUpNotifier struct {
+	mockNotifier
+}
+
+func (n *mockFollowUpNotifier) Remind(agents map[string][]Agent) error {
+	args := n.Called(agents)
+
+	return args.Error(0)
+}
+
+func (n *mockFollowUpNotifier) Recover(agents map[string][]Agent) error {
 	args := n.Called(agents)
 
 	return args.Error(0)
 }
 
+func TestAgent_TagsAndDetails(t *testing.T) {
+	require.Empty(t, Agent{Name: "a"}.Tags())
+	require.Equal(t, []string{"degraded", "stuck"}, Agent{Degraded: true, Stuck: true}.Tags())
+	require.Equal(t, []string{"starved"}, Agent{Starved: true}.Tags())
+	require.Equal(t, []string{"manual", "warning"}, Agent{Manual: true, Severity: SeverityWarning}.Tags())
+	require.Empty(t, Agent{Severity: SeverityCritical}.Tags())
+
+	require.Empty(t, Agent{Name: "a"}.Details())
+	require.Equal(t, "Disconnected", Agent{Reason: "Disconnected"}.Details())
+	require.Equal(t, "Reconnect requested", Agent{Remediation: "Reconnect requested"}.Details())
+	require.Equal(t, "Disconnected - Reconnect requested", Agent{Reason: "Disconnected", Remediation: "Reconnect requested"}.Details())
+}
+
 func TestWatchdogRunChecksAndNotify_NoAgents(t *testing.T) {
-	d, n, sut := setup([]string{}, nil)
+	d, n, sut := setup([]Agent{}, nil)
 
 	err := sut.RunChecksAndNotify()
 
 	require.Nil(t, err)
 	d.AssertCalled(t, "FindOfflineAgents")
-	n.AssertNotCalled(t, "Notify", map[string][]string{})
+	n.AssertNotCalled(t, "Notify", map[string][]Agent{})
 }
 
 func TestWatchdogRunChecksAndNotify_Error(t *testing.T) {
@@ -61,38 +100,38 @@ func TestWatchdogRunChecksAndNotify_Error(t *testing.T) {
 
 	require.Nil(t, err)
 	d.AssertCalled(t, "FindOfflineAgents")
-	n.AssertNotCalled(t, "Notify", map[string][]string{})
+	n.AssertNotCalled(t, "Notify", map[string][]Agent{})
 }
 
 func TestWatchdogRunChecksAndNotify_FoundAgents(t *testing.T) {
-	offline := []string{"b", "c"}
+	offline := agents("b", "c")
 
 	d, n, sut := setup(offline, nil)
 	d.On("Name").Return("a")
-	n.On("Notify", map[string][]string{"[MockDetector] a": {"b", "c"}}).Return(nil)
+	n.On("Notify", map[string][]Agent{"[MockDetector] a": agents("b", "c")}).Return(nil)
 
 	err := sut.RunChecksAndNotify()
 
 	require.Nil(t, err)
 	d.AssertCalled(t, "FindOfflineAgents")
-	n.AssertCalled(t, "Notify", map[string][]string{"[MockDetector] a": {"b", "c"}})
+	n.AssertCalled(t, "Notify", map[string][]Agent{"[MockDetector] a": agents("b", "c")})
 }
 
 func TestWatchdogRunChecks_DoesNotCallNotificationHandler(t *testing.T) {
-	offline := []string{"b", "c"}
+	offline := agents("b", "c")
 
 	d, n, sut := setup(offline, nil)
 	d.On("Name").Return("a")
 
 	result := sut.RunChecks()
 
-	require.Equal(t, result, map[string][]string{"[MockDetector] a": {"b", "c"}})
+	require.Equal(t, result.Offline, map[string][]Agent{"[MockDetector] a": agents("b", "c")})
 	d.AssertCalled(t, "FindOfflineAgents")
-	n.AssertNotCalled(t, "Notify", mock.AnythingOfType("map[string][]string"))
+	n.AssertNotCalled(t, "Notify", mock.AnythingOfType("map[string][]spot.Agent"))
 }
 
 func TestWatchdogRunChecksAndNotify_NilNotificationHandler(t *testing.T) {
-	offline := []string{"b", "c"}
+	offline := agents("b", "c")
 
 	d, _, sut := setup(offline, nil)
 	sut.NotificationHandler = nil
@@ -104,16 +143,16 @@ func TestWatchdogRunChecksAndNotify_NilNotificationHandler(t *testing.T) {
 }
 
 func TestWatchdogRunChecksAndNotify_ConcatsAllOfflineForNotification(t *testing.T) {
-	d, n, sut := setup([]string{"foo", "bar"}, nil)
+	d, n, sut := setup(agents("foo", "bar"), nil)
 	d.On("Name").Return("a")
 
 	d2 := &mockDetector{}
 	d2.On("Name").Return("d")
-	d2.On("FindOfflineAgents").Return([]string{"fizz", "buzz"}, nil)
+	d2.On("FindOfflineAgents").Return(agents("fizz", "buzz"), nil)
 
 	sut.Detectors = append(sut.Detectors, d2)
 
-	expected := map[string][]string{"[MockDetector] a": {"foo", "bar"}, "[MockDetector] d": {"fizz", "buzz"}}
+	expected := map[string][]Agent{"[MockDetector] a": agents("foo", "bar"), "[MockDetector] d": agents("fizz", "buzz")}
 
 	n.On("Notify", expected).Return(nil)
 
@@ -123,3 +162,324 @@ func TestWatchdogRunChecksAndNotify_ConcatsAllOfflineForNotification(t *testing.
 	d.AssertCalled(t, "FindOfflineAgents")
 	n.AssertCalled(t, "Notify", expected)
 }
+
+func TestWatchdogRunChecksAndNotify_SendsRecoveryToFollowUpNotifier(t *testing.T) {
+	d := &mockDetector{}
+	d.On("Name").Return("a")
+	d.On("FindOfflineAgents").Return(agents("b", "c"), nil).Once()
+	d.On("FindOfflineAgents").Return(agents("c"), nil).Once()
+
+	n := &mockFollowUpNotifier{}
+	n.On("Notify", map[string][]Agent{"[MockDetector] a": agents("b", "c")}).Return(nil)
+	n.On("Recover", map[string][]Agent{"[MockDetector] a": agents("b")}).Return(nil)
+
+	sut := NewWatchdog([]OfflineAgentDetector{d}, n)
+
+	require.NoError(t, sut.RunChecksAndNotify())
+	require.NoError(t, sut.RunChecksAndNotify())
+
+	n.AssertExpectations(t)
+	n.AssertNotCalled(t, "Remind", mock.Anything)
+}
+
+func TestWatchdogRunChecksAndNotify_SendsRemindersToFollowUpNotifier(t *testing.T) {
+	d := &mockDetector{}
+	d.On("Name").Return("a")
+	d.On("FindOfflineAgents").Return(agents("b"), nil)
+
+	n := &mockFollowUpNotifier{}
+	n.On("Notify", map[string][]Agent{"[MockDetector] a": agents("b")}).Return(nil)
+	n.On("Remind", map[string][]Agent{"[MockDetector] a": agents("b")}).Return(nil)
+
+	sut := NewWatchdog([]OfflineAgentDetector{d}, n)
+	sut.ReminderInterval = time.Nanosecond
+
+	require.NoError(t, sut.RunChecksAndNotify())
+	time.Sleep(time.Millisecond)
+	require.NoError(t, sut.RunChecksAndNotify())
+
+	n.AssertExpectations(t)
+}
+
+func TestWatchdog_OnlyRemediatesWhenNotifying(t *testing.T) {
+	d := &mockRemediatingDetector{}
+	d.On("Name").Return("a")
+	d.On("CheckOfflineAgents", false).Return(agents("b"), nil).Once()
+	d.On("CheckOfflineAgents", true).Return(agents("b"), nil).Once()
+
+	sut := NewWatchdog([]OfflineAgentDetector{d}, &mockNotifier{})
+
+	sut.RunChecks()
+	require.NoError(t, sut.RunChecksAndNotify())
+
+	d.AssertExpectations(t)
+	d.AssertNotCalled(t, "FindOfflineAgents")
+}
+
+func TestWatchdogRunChecksAndNotify_RecoveryDescribesRemediation(t *testing.T) {
+	remediated := Agent{Name: "b", Remediation: "Reconnect attempt 1 of 3 requested"}
+
+	d := &mockDetector{}
+	d.On("Name").Return("a")
+	d.On("FindOfflineAgents").Return([]Agent{remediated}, nil).Once()
+	d.On("FindOfflineAgents").Return([]Agent{}, nil).Once()
+
+	n := &mockFollowUpNotifier{}
+	n.On("Notify", map[string][]Agent{"[MockDetector] a": {remediated}}).Return(nil)
+	n.On("Recover", map[string][]Agent{"[MockDetector] a": {{Name: "b", Remediation: "Back online after: Reconnect attempt 1 of 3 requested"}}}).Return(nil)
+
+	sut := NewWatchdog([]OfflineAgentDetector{d}, n)
+
+	require.NoError(t, sut.RunChecksAndNotify())
+	require.NoError(t, sut.RunChecksAndNotify())
+
+	n.AssertExpectations(t)
+}
+
+func TestWatchdogRunChecksAndNotify_DetectorErrorIsNotARecovery(t *testing.T) {
+	d := &mockDetector{}
+	d.On("Name").Return("a")
+	d.On("FindOfflineAgents").Return(agents("b"), nil).Once()
+	d.On("FindOfflineAgents").Return([]Agent(nil), fmt.Errorf("Mock Error")).Once()
+
+	n := &mockFollowUpNotifier{}
+	n.On("Notify", map[string][]Agent{"[MockDetector] a": agents("b")}).Return(nil)
+
+	sut := NewWatchdog([]OfflineAgentDetector{d}, n)
+
+	require.NoError(t, sut.RunChecksAndNotify())
+	require.NoError(t, sut.RunChecksAndNotify())
+
+	n.AssertNotCalled(t, "Recover", mock.Anything)
+}
+
+func TestWatchdogRunChecksAndNotify_RetriesFailedNotifications(t *testing.T) {
+	d := &mockDetector{}
+	d.On("Name").Return("a")
+	d.On("FindOfflineAgents").Return(agents("b"), nil)
+
+	expected := map[string][]Agent{"[MockDetector] a": agents("b")}
+
+	n := &mockNotifier{}
+	n.On("Notify", expected).Return(&RetryableError{Err: fmt.Errorf("Mock Error")}).Once()
+	n.On("Notify", expected).Return(nil).Once()
+
+	sut := NewWatchdog([]OfflineAgentDetector{d}, n)
+	sut.Retries = NewRetryQueue(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour, MaxBackoff: time.Hour})
+	defer sut.Retries.Stop()
+
+	require.NoError(t, sut.RunChecksAndNotify())
+	require.Equal(t, 1, sut.Retries.Len())
+
+	// While the retry is queued, the agent is not reported again
+	require.True(t, sut.RunChecks().Empty())
+
+	sut.Retries.lock.Lock()
+	sut.Retries.jobs[0].next = time.Now()
+	sut.Retries.lock.Unlock()
+	sut.Retries.wake <- true
+	sut.Retries.Wait()
+
+	n.AssertNumberOfCalls(t, "Notify", 2)
+	require.True(t, sut.RunChecks().Empty())
+}
+
+func TestWatchdogRunChecksAndNotify_RecoversAgentsAfterLateRetry(t *testing.T) {
+	d := &mockDetector{}
+	d.On("Name").Return("a")
+	d.On("FindOfflineAgents").Return(agents("b"), nil).Once()
+	d.On("FindOfflineAgents").Return(agents(), nil)
+
+	expected := map[string][]Agent{"[MockDetector] a": agents("b")}
+
+	n := &mockFollowUpNotifier{}
+	n.On("Notify", expected).Return(&RetryableError{Err: fmt.Errorf("Mock Error")}).Once()
+	n.On("Notify", expected).Return(nil).Once()
+	n.On("Recover", expected).Return(nil).Once()
+
+	sut := NewWatchdog([]OfflineAgentDetector{d}, n)
+	sut.Retries = NewRetryQueue(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Hour, MaxBackoff: time.Hour})
+	defer sut.Retries.Stop()
+
+	require.NoError(t, sut.RunChecksAndNotify())
+
+	// The agent recovers while its notification is queued for retry, so
+	// the recovery waits for the retry
+	require.NoError(t, sut.RunChecksAndNotify())
+	n.AssertNotCalled(t, "Recover", mock.Anything)
+
+	sut.Retries.lock.Lock()
+	sut.Retries.jobs[0].next = time.Now()
+	sut.Retries.lock.Unlock()
+	sut.Retries.wake <- true
+	sut.Retries.Wait()
+
+	require.NoError(t, sut.RunChecksAndNotify())
+
+	n.AssertExpectations(t)
+}
+
+func TestWatchdogRunChecksAndNotify_ReturnsErrorWithoutRetries(t *testing.T) {
+	d, n, sut := setup(agents("b"), nil)
+	n.On("Notify", map[string][]Agent{"[MockDetector] a": agents("b")}).Return(&RetryableError{Err: fmt.Errorf("Mock Error")})
+
+	require.EqualError(t, sut.RunChecksAndNotify(), "Mock Error")
+	require.True(t, sut.RunChecks().Empty())
+
+	d.AssertCalled(t, "FindOfflineAgents")
+}
+
+func TestWatchdogRunChecksAndNotify_ReportsSilencedAgentsWhenSilenceEnds(t *testing.T) {
+	d, n, sut := setup(agents("win-1", "linux-1"), nil)
+	n.On("Notify", map[string][]Agent{"[MockDetector] a": agents("linux-1")}).Return(nil).Once()
+	n.On("Notify", map[string][]Agent{"[MockDetector] a": agents("win-1")}).Return(nil).Once()
+
+	silence, err := ParseSilence("agent=win-*;for=1h")
+	require.NoError(t, err)
+
+	sut.Silences = NewSilencer()
+	id := sut.Silences.Add(silence)
+
+	require.NoError(t, sut.RunChecksAndNotify())
+	require.NoError(t, sut.RunChecksAndNotify())
+	n.AssertNumberOfCalls(t, "Notify", 1)
+
+	sut.Silences.Remove(id)
+	require.NoError(t, sut.RunChecksAndNotify())
+
+	n.AssertExpectations(t)
+	d.AssertNumberOfCalls(t, "FindOfflineAgents", 3)
+}
+
+func TestWatchdogRunChecks_MarksAgentsAsReported(t *testing.T) {
+	d := &mockDetector{}
+	d.On("Name").Return("a")
+	d.On("FindOfflineAgents").Return(agents("b"), nil).Once()
+	d.On("FindOfflineAgents").Return(agents(), nil).Once()
+
+	n := &mockFollowUpNotifier{}
+	n.On("Recover", map[string][]Agent{"[MockDetector] a": agents("b")}).Return(nil)
+
+	sut := NewWatchdog([]OfflineAgentDetector{d}, n)
+
+	sut.RunChecks()
+	require.NoError(t, sut.RunChecksAndNotify())
+
+	n.AssertExpectations(t)
+	n.AssertNotCalled(t, "Notify", mock.Anything)
+}
+
+func TestWatchdogRunChecks_ReportsAgentsOfPartialErrors(t *testing.T) {
+	d := &mockDetector{}
+	d.On("Name").Return("a")
+	d.On("FindOfflineAgents").Return(agents("b", "c"), &PartialError{Err: fmt.Errorf("Mock Error")})
+
+	sut := NewWatchdog([]OfflineAgentDetector{d}, nil)
+	sut.RunChecks()
+
+	status := sut.Status()
+	require.Equal(t, 2, status[0].Offline)
+	require.Equal(t, "Mock Error", status[0].Error)
+	offline := sut.Offline()["[MockDetector] a"]
+	require.Len(t, offline, 2)
+	require.Equal(t, []string{"b", "c"}, []string{offline[0].Name, offline[1].Name})
+}
+
+func TestWatchdogStatus_RecordsChecksAndTransitions(t *testing.T) {
+	d := &mockDetector{}
+	d.On("Name").Return("a")
+	d.On("FindOfflineAgents").Return(agents("b"), nil).Once()
+	d.On("FindOfflineAgents").Return([]Agent(nil), fmt.Errorf("Mock Error")).Once()
+	d.On("FindOfflineAgents").Return(agents("c"), nil).Once()
+
+	sut := NewWatchdog([]OfflineAgentDetector{d}, nil)
+
+	status := sut.Status()
+	require.Len(t, status, 1)
+	require.True(t, status[0].LastCheck.IsZero())
+
+	sut.RunChecks()
+	status = sut.Status()
+	require.False(t, status[0].LastCheck.IsZero())
+	require.Equal(t, 1, status[0].Offline)
+	require.Empty(t, status[0].Error)
+
+	sut.RunChecks()
+	status = sut.Status()
+	require.Equal(t, 1, status[0].Offline)
+	require.Equal(t, "Mock Error", status[0].Error)
+	require.Len(t, sut.Transitions(), 1)
+
+	sut.RunChecks()
+	transitions := sut.Transitions()
+	require.Len(t, transitions, 3)
+	require.Equal(t, TransitionOffline, transitions[2].Kind)
+	require.Equal(t, "b", transitions[2].Agent.Name)
+
+	kinds := map[string]string{transitions[0].Agent.Name: transitions[0].Kind, transitions[1].Agent.Name: transitions[1].Kind}
+	require.Equal(t, map[string]string{"b": TransitionRecovered, "c": TransitionOffline}, kinds)
+}
+
+func TestWatchdogRunChecks_SkipsDetectorsUntilTheirInterval(t *testing.T) {
+	d, _, sut := setup(agents("b"), nil)
+	sut.Options = map[string]DetectorOptions{"[MockDetector] a": {Interval: time.Hour}}
+
+	sut.RunChecks()
+	sut.RunChecks()
+
+	d.AssertNumberOfCalls(t, "FindOfflineAgents", 1)
+}
+
+func TestWatchdogRunChecksAndNotify_WaitsForGracePeriod(t *testing.T) {
+	_, n, sut := setup(agents("b"), nil)
+	sut.Options = map[string]DetectorOptions{"[MockDetector] a": {GracePeriod: 20 * time.Millisecond}}
+	n.On("Notify", map[string][]Agent{"[MockDetector] a": agents("b")}).Return(nil)
+
+	require.NoError(t, sut.RunChecksAndNotify())
+	n.AssertNotCalled(t, "Notify", mock.Anything)
+
+	time.Sleep(25 * time.Millisecond)
+	require.NoError(t, sut.RunChecksAndNotify())
+	n.AssertNumberOfCalls(t, "Notify", 1)
+}
+
+func TestWatchdogRunChecksAndNotify_AgentGracePeriodOverridesDetector(t *testing.T) {
+	offline := []Agent{{Name: "b"}, {Name: "c", GracePeriod: time.Hour}}
+	_, n, sut := setup(offline, nil)
+	sut.Options = map[string]DetectorOptions{"[MockDetector] a": {GracePeriod: 20 * time.Millisecond}}
+	n.On("Notify", map[string][]Agent{"[MockDetector] a": offline[:1]}).Return(nil)
+
+	require.NoError(t, sut.RunChecksAndNotify())
+	n.AssertNotCalled(t, "Notify", mock.Anything)
+
+	time.Sleep(25 * time.Millisecond)
+	require.NoError(t, sut.RunChecksAndNotify())
+	n.AssertNumberOfCalls(t, "Notify", 1)
+}
+
+func TestWatchdogReconfigure_KeepsCacheOfUnchangedDetectors(t *testing.T) {
+	a, _, sut := setup(agents("b"), nil)
+	sut.RunChecks()
+
+	removed := &mockDetector{}
+	removed.On("Name").Return("c")
+	removed.On("FindOfflineAgents").Return(agents("d"), nil)
+	sut.Reconfigure([]OfflineAgentDetector{a, removed}, nil, nil, time.Hour)
+	sut.RunChecks()
+
+	added := &mockDetector{}
+	added.On("Name").Return("e")
+	added.On("FindOfflineAgents").Return([]Agent{}, nil)
+	n := &mockNotifier{}
+	sut.Reconfigure([]OfflineAgentDetector{a, added}, n, nil, 0)
+
+	offline := sut.Offline()
+	require.Len(t, offline, 1)
+	require.True(t, offline["[MockDetector] a"][0].Notified)
+
+	require.Equal(t, n, sut.NotificationHandler)
+	require.Equal(t, []string{"[MockDetector] a", "[MockDetector] e"}, []string{sut.Status()[0].Name, sut.Status()[1].Name})
+
+	require.NoError(t, sut.RunChecksAndNotify())
+	n.AssertNotCalled(t, "Notify", mock.Anything)
+}